@@ -2,10 +2,13 @@ package cli
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"mime/multipart"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/spf13/cobra"
 	"github.com/theblitlabs/deviceid"
 	"github.com/theblitlabs/gologger"
@@ -13,6 +16,7 @@ import (
 	"github.com/theblitlabs/parity-client/internal/client"
 	"github.com/theblitlabs/parity-client/internal/config"
 	"github.com/theblitlabs/parity-client/internal/proxy"
+	"github.com/theblitlabs/parity-client/pkg/requestsig"
 )
 
 type DockerConfig struct {
@@ -36,68 +40,71 @@ type DockerTask struct {
 	Command []string `json:"command,omitempty"`
 }
 
-type ResourceConfig struct {
-	Memory    string `json:"memory,omitempty"`
-	CPUShares int64  `json:"cpu_shares,omitempty"`
-	Timeout   string `json:"timeout,omitempty"`
-}
-
-type TaskRequest struct {
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	Image       string   `json:"image"`
-	Command     []string `json:"command"`
-}
-
-func getCreatorAddress() (string, error) {
+// loadSigner returns a request signer backed by the authenticated wallet key.
+func loadSigner() (*requestsig.Signer, error) {
 	ks, err := keystore.NewAdapter(nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to create keystore: %v", err)
+		return nil, fmt.Errorf("failed to create keystore: %v", err)
 	}
 
 	privateKey, err := ks.LoadPrivateKey()
 	if err != nil {
-		return "", fmt.Errorf("failed to load private key: %v", err)
+		return nil, fmt.Errorf("failed to load private key: %v", err)
 	}
 
-	address := crypto.PubkeyToAddress(privateKey.PublicKey)
-	return address.Hex(), nil
+	return requestsig.NewSigner(privateKey), nil
 }
 
 func RunChain(port int, cmd *cobra.Command) {
 	log := gologger.Get().With().Str("component", "chain").Logger()
 
-	if err := client.IsPortAvailable(port); err != nil {
-		log.Error().Err(err).Int("port", port).Msg("Port is not available")
-		return
-	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	configPath, _ := cmd.Flags().GetString("config-path")
+	if err := RunChainContext(ctx, port, configPath); err != nil {
+		log.Error().Err(err).Msg("Chain proxy server failed")
+	}
+}
+
+// RunChainContext runs the chain proxy until ctx is cancelled, draining
+// in-flight requests before it returns.
+func RunChainContext(ctx context.Context, port int, configPath string) error {
 	configManager := config.NewConfigManager(configPath)
 	cfg, err := configManager.GetConfig()
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to load config")
-		return
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// The socket itself is checked when the server binds it, since a stale
+	// file has to be removed first.
+	if !cfg.Server.Socket {
+		if err := client.IsPortAvailable(port); err != nil {
+			return err
+		}
 	}
 
 	deviceIDManager := deviceid.NewManager(deviceid.Config{})
 	deviceID, err := deviceIDManager.VerifyDeviceID()
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to verify device ID")
-		return
+		return fmt.Errorf("failed to verify device ID: %w", err)
 	}
 
-	creatorAddress, err := getCreatorAddress()
+	signer, err := loadSigner()
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to get creator address. Please authenticate first using 'auth' command")
-		return
+		return fmt.Errorf("failed to load wallet key, please authenticate first using 'auth' command: %w", err)
 	}
 
-	server := proxy.NewServer(cfg, deviceID, creatorAddress, port)
-	if err := server.Start(); err != nil {
-		log.Error().Err(err).Msg("Failed to start chain proxy server")
-		return
+	server, err := proxy.NewServer(cfg, deviceID, signer, port)
+	if err != nil {
+		return fmt.Errorf("failed to create chain proxy server: %w", err)
 	}
+
+	if err := server.Run(ctx); err != nil {
+		return fmt.Errorf("failed to run chain proxy server: %w", err)
+	}
+
+	return nil
 }
 
 func NewMultipartWriter(body *bytes.Buffer) *multipart.Writer {
@@ -10,6 +10,7 @@ import (
 	"github.com/theblitlabs/parity-client/cmd/cli"
 	"github.com/theblitlabs/parity-client/internal/commands"
 	"github.com/theblitlabs/parity-client/internal/config"
+	"github.com/theblitlabs/parity-client/internal/requestid"
 	"github.com/theblitlabs/parity-client/internal/utils"
 )
 
@@ -41,6 +42,17 @@ var rootCmd = &cobra.Command{
 		if configPath == "" {
 			configPath = utils.GetDefaultConfigPath()
 		}
+
+		// Subcommands tag every call they make with one request ID so the
+		// proxy and runner logs can be matched to this invocation. The proxy
+		// itself only forwards the IDs of the requests it serves.
+		invocationID := ""
+		if cmd.HasParent() {
+			invocationID = requestid.New()
+			log := gologger.Get()
+			log.Debug().Str("request_id", invocationID).Str("command", cmd.CommandPath()).Msg("Starting command")
+		}
+		requestid.InstallDefault(invocationID)
 	},
 }
 
@@ -0,0 +1,153 @@
+// Package accesslog writes one JSON object per proxied request to a file
+// that is rotated by size.
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxSize    = 100 << 20
+	defaultMaxBackups = 5
+)
+
+// Entry is one access log line.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Route      string    `json:"route"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	LatencyMS  float64   `json:"latency_ms"`
+	Upstream   string    `json:"upstream,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+}
+
+// Logger appends entries to a file. When the file would grow past maxSize
+// it is renamed to path.1, older backups shift up, and anything beyond
+// maxBackups is removed. A nil Logger discards entries.
+type Logger struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// New opens or creates the log at path. Zero maxSize and maxBackups fall
+// back to 100 MiB and 5 backups. An empty path returns a nil Logger.
+func New(path string, maxSize int64, maxBackups int) (*Logger, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if maxSize <= 0 {
+		maxSize = defaultMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = defaultMaxBackups
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create access log directory: %w", err)
+	}
+
+	l := &Logger{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Log writes e as a single line.
+func (l *Logger) Log(e Entry) error {
+	if l == nil {
+		return nil
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return os.ErrClosed
+	}
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+// Close closes the current file.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *Logger) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open access log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to stat access log: %w", err)
+	}
+
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close access log: %w", err)
+	}
+	l.file = nil
+
+	_ = os.Remove(l.backup(l.maxBackups))
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(l.backup(i), l.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to rotate access log: %w", err)
+		}
+	}
+	if err := os.Rename(l.path, l.backup(1)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to rotate access log: %w", err)
+	}
+
+	return l.open()
+}
+
+func (l *Logger) backup(n int) string {
+	return fmt.Sprintf("%s.%d", l.path, n)
+}
@@ -0,0 +1,115 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	walletsdk "github.com/theblitlabs/go-wallet-sdk"
+	"github.com/theblitlabs/parity-client/internal/adapters/keystore"
+	"github.com/theblitlabs/parity-client/internal/adapters/wallet"
+	"github.com/theblitlabs/parity-client/internal/config"
+)
+
+// Report is the wallet's token balance and, when the device has staked, its
+// stake. Amounts are in the token's smallest unit.
+type Report struct {
+	WalletAddress string `json:"wallet_address"`
+	TokenBalance  string `json:"token_balance"`
+	TokenSymbol   string `json:"token_symbol"`
+	Stake         *Stake `json:"stake,omitempty"`
+}
+
+// Stake describes the device's active stake and the stake contract holding it.
+type Stake struct {
+	Amount          string `json:"amount"`
+	DeviceID        string `json:"device_id"`
+	WalletAddress   string `json:"wallet_address"`
+	ContractAddress string `json:"contract_address"`
+	ContractBalance string `json:"contract_balance"`
+}
+
+// NewWalletAdapter connects to the configured chain with the private key saved
+// by 'parity-client auth'.
+func NewWalletAdapter(cfg *config.Config) (*wallet.Adapter, error) {
+	keystoreAdapter, err := keystore.NewAdapter(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create keystore: %w", err)
+	}
+
+	privateKey, err := keystoreAdapter.LoadPrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("no private key found - please authenticate first using 'parity auth': %w", err)
+	}
+
+	walletAdapter, err := wallet.NewAdapter(walletsdk.ClientConfig{
+		RPCURL:       cfg.BlockchainNetwork.RPC,
+		ChainID:      cfg.BlockchainNetwork.ChainID,
+		PrivateKey:   common.Bytes2Hex(crypto.FromECDSA(privateKey)),
+		TokenAddress: common.HexToAddress(cfg.BlockchainNetwork.TokenAddress),
+		StakeAddress: common.HexToAddress(cfg.BlockchainNetwork.StakeWalletAddress),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Ethereum client: %w", err)
+	}
+
+	return walletAdapter, nil
+}
+
+// Fetch reads the token balance of walletAdapter's address and the stake
+// held for deviceID.
+func Fetch(ctx context.Context, walletAdapter *wallet.Adapter, cfg *config.Config, deviceID string) (*Report, error) {
+	tokenAddr := common.HexToAddress(cfg.BlockchainNetwork.TokenAddress)
+	stakeAddr := common.HexToAddress(cfg.BlockchainNetwork.StakeWalletAddress)
+
+	token, err := walletAdapter.NewParityToken(tokenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token contract: %w", err)
+	}
+
+	tokenBalance, err := walletAdapter.GetTokenBalance(ctx, token, walletAdapter.GetAddress())
+	if err != nil {
+		return nil, callError(ctx, "token balance", err)
+	}
+
+	report := &Report{
+		WalletAddress: walletAdapter.GetAddress().Hex(),
+		TokenBalance:  tokenBalance.String(),
+		TokenSymbol:   cfg.BlockchainNetwork.TokenSymbol,
+	}
+
+	stakeWallet, err := walletAdapter.NewStakeWallet(stakeAddr, tokenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stake wallet contract: %w", err)
+	}
+
+	stakeInfo, err := walletAdapter.GetStakeInfo(ctx, stakeWallet, deviceID)
+	if err != nil {
+		return nil, callError(ctx, "stake info", err)
+	}
+	if !stakeInfo.Exists {
+		return report, nil
+	}
+
+	contractBalance, err := walletAdapter.GetTokenBalance(ctx, token, stakeAddr)
+	if err != nil {
+		return nil, callError(ctx, "contract balance", err)
+	}
+
+	report.Stake = &Stake{
+		Amount:          stakeInfo.Amount.String(),
+		DeviceID:        stakeInfo.DeviceID,
+		WalletAddress:   stakeInfo.WalletAddress.Hex(),
+		ContractAddress: cfg.BlockchainNetwork.StakeWalletAddress,
+		ContractBalance: contractBalance.String(),
+	}
+	return report, nil
+}
+
+func callError(ctx context.Context, what string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("timed out while getting %s: %w", what, ctxErr)
+	}
+	return fmt.Errorf("failed to get %s: %w", what, err)
+}
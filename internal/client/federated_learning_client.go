@@ -91,10 +91,13 @@ type SubmitModelUpdateRequest struct {
 	Metadata     map[string]interface{} `json:"metadata"`
 }
 
-func NewFederatedLearningClient(baseURL string) *FederatedLearningClient {
+// NewFederatedLearningClient returns a client for the server at baseURL
+// that sends its requests over transport, or http.DefaultTransport when it
+// is nil.
+func NewFederatedLearningClient(baseURL string, transport http.RoundTripper) *FederatedLearningClient {
 	return &FederatedLearningClient{
 		baseURL: baseURL,
-		client:  &http.Client{Timeout: 30 * time.Second},
+		client:  &http.Client{Timeout: 30 * time.Second, Transport: transport},
 	}
 }
 
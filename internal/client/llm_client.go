@@ -51,12 +51,15 @@ type ModelsResponse struct {
 	Count  int         `json:"count"`
 }
 
-func NewLLMClient(serverURL, clientID string) *LLMClient {
+// NewLLMClient returns a client for the runner at serverURL that sends its
+// requests over transport, or http.DefaultTransport when it is nil.
+func NewLLMClient(serverURL, clientID string, transport http.RoundTripper) *LLMClient {
 	return &LLMClient{
 		serverURL: serverURL,
 		clientID:  clientID,
 		client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: transport,
 		},
 	}
 }
@@ -1,10 +1,23 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/theblitlabs/parity-client/internal/config"
+	"github.com/theblitlabs/parity-client/internal/requestid"
+	"github.com/theblitlabs/parity-client/internal/utils"
 )
 
+// socketBaseURL is the base URL used for requests sent over the proxy's Unix
+// socket. The host is ignored by the dialer.
+const socketBaseURL = "http://unix"
+
 func IsPortAvailable(port int) error {
 	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
@@ -15,3 +28,106 @@ func IsPortAvailable(port int) error {
 	}
 	return nil
 }
+
+// IsSocketAvailable reports whether the proxy can listen on the Unix socket
+// at path. A leftover socket file that nothing is listening on is removed.
+func IsSocketAvailable(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("socket %s is not available: %v", path, err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("socket %s is not available: file exists and is not a socket", path)
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("socket %s is not available: another process is listening on it", path)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale socket %s: %v", path, err)
+	}
+	return nil
+}
+
+// ProxySocketPath returns the Unix socket the proxy listens on when
+// SERVER_SOCKET is enabled.
+func ProxySocketPath(cfg *config.Config) string {
+	if cfg != nil && cfg.Server.SocketPath != "" {
+		return cfg.Server.SocketPath
+	}
+	return utils.GetDefaultSocketPath()
+}
+
+// ProxyEndpoint is how CLI commands reach the local proxy.
+type ProxyEndpoint struct {
+	BaseURL string
+	Client  *http.Client
+	// Socket is the Unix socket path, or empty when BaseURL is a TCP address.
+	Socket string
+}
+
+// NewProxyEndpoint prefers the proxy's Unix socket when one exists and falls
+// back to SERVER_HOST:SERVER_PORT, over HTTPS when the proxy has a certificate.
+// TCP requests go over transport, or http.DefaultTransport when it is nil.
+// cfg may be nil, in which case only the default socket and localhost:3000
+// are tried.
+func NewProxyEndpoint(cfg *config.Config, timeout time.Duration, transport http.RoundTripper) *ProxyEndpoint {
+	path := ProxySocketPath(cfg)
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		return &ProxyEndpoint{
+			BaseURL: socketBaseURL,
+			Client:  &http.Client{Timeout: timeout, Transport: socketTransport(path)},
+			Socket:  path,
+		}
+	}
+
+	host, port := "localhost", 3000
+	if cfg != nil {
+		if cfg.Server.Host != "" && cfg.Server.Host != "0.0.0.0" && cfg.Server.Host != "::" {
+			host = cfg.Server.Host
+		}
+		if cfg.Server.Port != 0 {
+			port = cfg.Server.Port
+		}
+	}
+
+	scheme := "http://"
+	if cfg != nil && cfg.Server.TLSCertFile != "" {
+		scheme = "https://"
+	}
+
+	return &ProxyEndpoint{
+		BaseURL: scheme + net.JoinHostPort(host, fmt.Sprint(port)),
+		Client:  &http.Client{Timeout: timeout, Transport: transport},
+	}
+}
+
+// Address describes the endpoint for messages shown to the user.
+func (e *ProxyEndpoint) Address() string {
+	if e.Socket != "" {
+		return "unix://" + e.Socket
+	}
+	return e.BaseURL
+}
+
+func socketTransport(path string) http.RoundTripper {
+	base := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+		MaxIdleConns:    10,
+		IdleConnTimeout: 90 * time.Second,
+	}
+
+	// Keep forwarding the invocation ID installed on the default transport.
+	if def, ok := http.DefaultTransport.(*requestid.Transport); ok {
+		return requestid.NewTransport(base, def.Fallback)
+	}
+	return base
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrTaskNotFound is returned when a runner does not know the task, so the
+// caller can ask another runner.
+var ErrTaskNotFound = errors.New("task not found")
+
+type TaskClient struct {
+	serverURL string
+	client    *http.Client
+}
+
+// TaskArtifact is an output a runner published to IPFS: the path the task
+// wrote it to in its container and its CID.
+type TaskArtifact struct {
+	Path string `json:"path"`
+	CID  string `json:"cid"`
+}
+
+type TaskResponse struct {
+	ID        string         `json:"id"`
+	Status    string         `json:"status"`
+	Outputs   []string       `json:"outputs,omitempty"`
+	Artifacts []TaskArtifact `json:"artifacts,omitempty"`
+}
+
+// NewTaskClient returns a client for the runner at serverURL that sends its
+// requests over transport, or http.DefaultTransport when it is nil.
+func NewTaskClient(serverURL string, transport http.RoundTripper) *TaskClient {
+	return &TaskClient{
+		serverURL: serverURL,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: transport,
+		},
+	}
+}
+
+func (c *TaskClient) GetTask(ctx context.Context, taskID string) (*TaskResponse, error) {
+	endpoint := fmt.Sprintf("%s/api/v1/tasks/%s", c.serverURL, url.PathEscape(taskID))
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task: %w", err)
+	}
+	defer func() {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			log.Printf("Error closing response body: %v", closeErr)
+		}
+	}()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrTaskNotFound, taskID)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get task failed with status: %d", resp.StatusCode)
+	}
+
+	var response TaskResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, nil
+}
@@ -1,9 +1,12 @@
 package commands
 
 import (
+	"fmt"
+
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/theblitlabs/parity-client/cmd/cli"
+	"github.com/theblitlabs/parity-client/internal/localauth"
 )
 
 var authCmd = &cobra.Command{
@@ -14,9 +17,85 @@ var authCmd = &cobra.Command{
 	},
 }
 
+var authTokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Manage API tokens for the local proxy",
+	Long: `Create, list and revoke bearer tokens that callers must present to the local proxy.
+
+Tokens are stored hashed in ~/.parity/api_tokens.json next to the keystore.
+Send them as "Authorization: Bearer <token>".`,
+}
+
+var authTokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a new API token",
+	Example: `  # Create a token for a CI script
+  parity-client auth token create --name ci-runner`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, _ := cmd.Flags().GetString("name")
+
+		plain, token, err := localauth.DefaultStore().Create(name)
+		if err != nil {
+			return fmt.Errorf("failed to create API token: %w", err)
+		}
+
+		fmt.Printf("API token created\n")
+		fmt.Printf("ID:    %s\n", token.ID)
+		if token.Name != "" {
+			fmt.Printf("Name:  %s\n", token.Name)
+		}
+		fmt.Printf("Token: %s\n", plain)
+		fmt.Printf("\nStore this token now, it will not be shown again.\n")
+		return nil
+	},
+}
+
+var authTokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API tokens",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tokens, err := localauth.DefaultStore().List()
+		if err != nil {
+			return fmt.Errorf("failed to list API tokens: %w", err)
+		}
+
+		if len(tokens) == 0 {
+			fmt.Println("No API tokens")
+			return nil
+		}
+
+		fmt.Printf("%-10s %-24s %s\n", "ID", "NAME", "CREATED")
+		for _, token := range tokens {
+			fmt.Printf("%-10s %-24s %s\n", token.ID, token.Name, token.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		return nil
+	},
+}
+
+var authTokenRevokeCmd = &cobra.Command{
+	Use:   "revoke [token-id]",
+	Short: "Revoke an API token",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := localauth.DefaultStore().Revoke(args[0]); err != nil {
+			return fmt.Errorf("failed to revoke API token: %w", err)
+		}
+
+		fmt.Printf("API token %s revoked\n", args[0])
+		return nil
+	},
+}
+
 func init() {
 	authCmd.Flags().StringP("private-key", "k", "", "Private key in hex format")
 	if err := authCmd.MarkFlagRequired("private-key"); err != nil {
 		log.Error().Err(err).Msg("Failed to mark private-key flag as required")
 	}
+
+	authTokenCreateCmd.Flags().String("name", "", "Descriptive name for the token")
+
+	authTokenCmd.AddCommand(authTokenCreateCmd)
+	authTokenCmd.AddCommand(authTokenListCmd)
+	authTokenCmd.AddCommand(authTokenRevokeCmd)
+	authCmd.AddCommand(authTokenCmd)
 }
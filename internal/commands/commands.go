@@ -1,6 +1,13 @@
 package commands
 
-import "github.com/spf13/cobra"
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/spf13/cobra"
+	"github.com/theblitlabs/parity-client/internal/config"
+	"github.com/theblitlabs/parity-client/internal/tlsconfig"
+)
 
 func AddCommands(rootCmd *cobra.Command) {
 	rootCmd.AddCommand(authCmd)
@@ -9,6 +16,21 @@ func AddCommands(rootCmd *cobra.Command) {
 	rootCmd.AddCommand(llmCmd)
 	rootCmd.AddCommand(flCmd)
 	rootCmd.AddCommand(storageCmd)
+	rootCmd.AddCommand(taskCmd)
 	rootCmd.AddCommand(healthCmd)
 	rootCmd.AddCommand(GetReputationCommand())
 }
+
+// outboundTransport returns the transport for calls to the runner, the
+// federated learning server and the proxy, using the TLS_* settings in cfg.
+// A nil cfg gives a nil transport, which means http.DefaultTransport.
+func outboundTransport(cfg *config.Config) (http.RoundTripper, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	transport, err := tlsconfig.Transport(cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid outbound TLS settings: %w", err)
+	}
+	return transport, nil
+}
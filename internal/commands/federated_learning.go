@@ -615,7 +615,11 @@ func createFLClient(cfg *config.Config) (*client.FederatedLearningClient, error)
 	if serverURL == "" {
 		return nil, fmt.Errorf("federated learning server URL not configured")
 	}
-	return client.NewFederatedLearningClient(serverURL), nil
+	transport, err := outboundTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewFederatedLearningClient(serverURL, transport), nil
 }
 
 func getCreatorAddress(cfg *config.Config) (string, error) {
@@ -8,6 +8,8 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/theblitlabs/gologger"
+	"github.com/theblitlabs/parity-client/internal/client"
+	"github.com/theblitlabs/parity-client/internal/config"
 )
 
 var healthCmd = &cobra.Command{
@@ -25,27 +27,44 @@ var (
 
 func init() {
 	healthCmd.Flags().BoolVar(&healthDetailed, "detailed", false, "Get detailed health information")
-	healthCmd.Flags().StringVar(&healthEndpoint, "endpoint", "http://localhost:3000", "Health check endpoint URL")
+	healthCmd.Flags().StringVar(&healthEndpoint, "endpoint", "", "Health check endpoint URL (default: the proxy's Unix socket if present, otherwise http://SERVER_HOST:SERVER_PORT)")
 	healthCmd.Flags().DurationVar(&healthTimeout, "timeout", 10*time.Second, "Timeout for health check request")
 }
 
 func runHealthCheck(cmd *cobra.Command, args []string) {
 	logger := gologger.Get().With().Str("component", "health-cmd").Logger()
 
+	configPath, _ := cmd.Flags().GetString("config-path")
+	cfg, err := config.NewConfigManager(configPath).GetConfig()
+	if err != nil {
+		logger.Debug().Err(err).Msg("Failed to load config, using default proxy address and TLS settings")
+		cfg = nil
+	}
+	transport, err := outboundTransport(cfg)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to configure outbound TLS")
+		fmt.Printf("❌ Health check failed: %v\n", err)
+		return
+	}
+
+	endpoint := &client.ProxyEndpoint{
+		BaseURL: healthEndpoint,
+		Client:  &http.Client{Timeout: healthTimeout, Transport: transport},
+	}
+	if healthEndpoint == "" {
+		endpoint = client.NewProxyEndpoint(cfg, healthTimeout, transport)
+	}
+
 	var url string
 	if healthDetailed {
-		url = fmt.Sprintf("%s/health/detailed", healthEndpoint)
+		url = fmt.Sprintf("%s/health/detailed", endpoint.BaseURL)
 	} else {
-		url = fmt.Sprintf("%s/health", healthEndpoint)
+		url = fmt.Sprintf("%s/health", endpoint.BaseURL)
 	}
 
-	logger.Info().Str("url", url).Msg("Checking health status")
-
-	client := &http.Client{
-		Timeout: healthTimeout,
-	}
+	logger.Info().Str("endpoint", endpoint.Address()).Str("url", url).Msg("Checking health status")
 
-	resp, err := client.Get(url)
+	resp, err := endpoint.Client.Get(url)
 	if err != nil {
 		logger.Error().Err(err).Msg("Failed to connect to health endpoint")
 		fmt.Printf("❌ Health check failed: %v\n", err)
@@ -72,7 +72,11 @@ var submitCmd = &cobra.Command{
 		log.Info().Str("server_url", cfg.Runner.ServerURL).Msg("Using server URL")
 
 		clientID := "parity-client-" + strconv.FormatInt(time.Now().Unix(), 10)
-		llmClient := client.NewLLMClient(cfg.Runner.ServerURL, clientID)
+		transport, err := outboundTransport(cfg)
+		if err != nil {
+			return err
+		}
+		llmClient := client.NewLLMClient(cfg.Runner.ServerURL, clientID, transport)
 
 		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
@@ -142,7 +146,11 @@ var listCmd = &cobra.Command{
 		}
 
 		clientID := "parity-client-" + strconv.FormatInt(time.Now().Unix(), 10)
-		llmClient := client.NewLLMClient(cfg.Runner.ServerURL, clientID)
+		transport, err := outboundTransport(cfg)
+		if err != nil {
+			return err
+		}
+		llmClient := client.NewLLMClient(cfg.Runner.ServerURL, clientID, transport)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
@@ -200,7 +208,11 @@ var statusCmd = &cobra.Command{
 		}
 
 		clientID := "parity-client-" + strconv.FormatInt(time.Now().Unix(), 10)
-		llmClient := client.NewLLMClient(cfg.Runner.ServerURL, clientID)
+		transport, err := outboundTransport(cfg)
+		if err != nil {
+			return err
+		}
+		llmClient := client.NewLLMClient(cfg.Runner.ServerURL, clientID, transport)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
@@ -248,7 +260,11 @@ var listModelsCmd = &cobra.Command{
 		}
 
 		clientID := "parity-client-" + strconv.FormatInt(time.Now().Unix(), 10)
-		llmClient := client.NewLLMClient(cfg.Runner.ServerURL, clientID)
+		transport, err := outboundTransport(cfg)
+		if err != nil {
+			return err
+		}
+		llmClient := client.NewLLMClient(cfg.Runner.ServerURL, clientID, transport)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
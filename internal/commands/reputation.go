@@ -10,10 +10,14 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/theblitlabs/deviceid"
+	"github.com/theblitlabs/parity-client/internal/client"
 	"github.com/theblitlabs/parity-client/internal/config"
 	"github.com/theblitlabs/parity-client/internal/utils"
 )
 
+// reputationTimeout bounds calls made through the local proxy.
+const reputationTimeout = 30 * time.Second
+
 type RunnerStatus struct {
 	RunnerID        string                 `json:"runner_id"`
 	WalletAddress   string                 `json:"wallet_address"`
@@ -108,10 +112,15 @@ ban status, and overall network standing. This is the primary command for networ
 			}
 		}
 
-		serverURL := fmt.Sprintf("http://%s:%d", cfg.Server.Host, cfg.Server.Port)
+		transport, err := outboundTransport(cfg)
+		if err != nil {
+			return err
+		}
+		proxy := client.NewProxyEndpoint(cfg, reputationTimeout, transport)
+		serverURL := proxy.BaseURL
 		url := fmt.Sprintf("%s/api/v1/reputation/eligibility/%s", serverURL, runnerID)
 
-		resp, err := http.Get(url)
+		resp, err := proxy.Client.Get(url)
 		if err != nil {
 			return fmt.Errorf("failed to check eligibility: %w", err)
 		}
@@ -166,10 +175,15 @@ and current standing in the network. Shows eligibility, ban status, and quality
 			}
 		}
 
-		serverURL := fmt.Sprintf("http://%s:%d", cfg.Server.Host, cfg.Server.Port)
+		transport, err := outboundTransport(cfg)
+		if err != nil {
+			return err
+		}
+		proxy := client.NewProxyEndpoint(cfg, reputationTimeout, transport)
+		serverURL := proxy.BaseURL
 		url := fmt.Sprintf("%s/api/v1/reputation/runner/%s", serverURL, runnerID)
 
-		resp, err := http.Get(url)
+		resp, err := proxy.Client.Get(url)
 		if err != nil {
 			return fmt.Errorf("failed to get reputation: %w", err)
 		}
@@ -206,10 +220,15 @@ banned runners, average reputation, and network quality indicators.`,
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
-		serverURL := fmt.Sprintf("http://%s:%d", cfg.Server.Host, cfg.Server.Port)
+		transport, err := outboundTransport(cfg)
+		if err != nil {
+			return err
+		}
+		proxy := client.NewProxyEndpoint(cfg, reputationTimeout, transport)
+		serverURL := proxy.BaseURL
 		url := fmt.Sprintf("%s/api/v1/reputation/network/stats", serverURL)
 
-		resp, err := http.Get(url)
+		resp, err := proxy.Client.Get(url)
 		if err != nil {
 			return fmt.Errorf("failed to get network stats: %w", err)
 		}
@@ -263,10 +282,15 @@ Available types: overall, docker, llm, federated-learning`,
 
 		limit, _ := cmd.Flags().GetInt("limit")
 
-		serverURL := fmt.Sprintf("http://%s:%d", cfg.Server.Host, cfg.Server.Port)
+		transport, err := outboundTransport(cfg)
+		if err != nil {
+			return err
+		}
+		proxy := client.NewProxyEndpoint(cfg, reputationTimeout, transport)
+		serverURL := proxy.BaseURL
 		url := fmt.Sprintf("%s/api/v1/reputation/leaderboard/%s?limit=%d", serverURL, leaderboardType, limit)
 
-		resp, err := http.Get(url)
+		resp, err := proxy.Client.Get(url)
 		if err != nil {
 			return fmt.Errorf("failed to get leaderboard: %w", err)
 		}
@@ -320,10 +344,15 @@ failures, quality changes, and any malicious behavior reports.`,
 
 		limit, _ := cmd.Flags().GetInt("limit")
 
-		serverURL := fmt.Sprintf("http://%s:%d", cfg.Server.Host, cfg.Server.Port)
+		transport, err := outboundTransport(cfg)
+		if err != nil {
+			return err
+		}
+		proxy := client.NewProxyEndpoint(cfg, reputationTimeout, transport)
+		serverURL := proxy.BaseURL
 		url := fmt.Sprintf("%s/api/v1/reputation/events/%s?limit=%d", serverURL, runnerID, limit)
 
-		resp, err := http.Get(url)
+		resp, err := proxy.Client.Get(url)
 		if err != nil {
 			return fmt.Errorf("failed to get events: %w", err)
 		}
@@ -574,7 +603,11 @@ var monitoringAssignmentsCmd = &cobra.Command{
 	Long:  "Display all current peer monitoring assignments in the network",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		serverURL := getServerURL()
-		resp, err := http.Get(fmt.Sprintf("%s/api/v1/monitoring/assignments", serverURL))
+		httpClient, err := monitoringClient()
+		if err != nil {
+			return err
+		}
+		resp, err := httpClient.Get(fmt.Sprintf("%s/api/v1/monitoring/assignments", serverURL))
 		if err != nil {
 			return fmt.Errorf("failed to get monitoring assignments: %w", err)
 		}
@@ -634,7 +667,11 @@ var monitoringStatsCmd = &cobra.Command{
 	Long:  "Display overall peer monitoring network statistics and health",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		serverURL := getServerURL()
-		resp, err := http.Get(fmt.Sprintf("%s/api/v1/monitoring/stats", serverURL))
+		httpClient, err := monitoringClient()
+		if err != nil {
+			return err
+		}
+		resp, err := httpClient.Get(fmt.Sprintf("%s/api/v1/monitoring/stats", serverURL))
 		if err != nil {
 			return fmt.Errorf("failed to get monitoring stats: %w", err)
 		}
@@ -681,7 +718,11 @@ var monitoringMetricsCmd = &cobra.Command{
 	RunE: func(cmd *cobra.Command, args []string) error {
 		runnerID := args[0]
 		serverURL := getServerURL()
-		resp, err := http.Get(fmt.Sprintf("%s/api/v1/monitoring/metrics/%s", serverURL, runnerID))
+		httpClient, err := monitoringClient()
+		if err != nil {
+			return err
+		}
+		resp, err := httpClient.Get(fmt.Sprintf("%s/api/v1/monitoring/metrics/%s", serverURL, runnerID))
 		if err != nil {
 			return fmt.Errorf("failed to get monitoring metrics: %w", err)
 		}
@@ -767,6 +808,20 @@ func getServerURL() string {
 	return "http://localhost:8082" // Default fallback
 }
 
+// monitoringClient returns a client for the server getServerURL picks,
+// using the configured outbound TLS settings.
+func monitoringClient() (*http.Client, error) {
+	cfg, err := loadReputationConfig()
+	if err != nil {
+		cfg = nil
+	}
+	transport, err := outboundTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
 func loadReputationConfig() (*config.Config, error) {
 	configPath := ".env"
 	configManager := config.NewConfigManager(configPath)
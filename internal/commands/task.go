@@ -0,0 +1,350 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/theblitlabs/gologger"
+	"github.com/theblitlabs/parity-client/internal/client"
+	"github.com/theblitlabs/parity-client/internal/config"
+	"github.com/theblitlabs/parity-client/internal/docker/service"
+	"github.com/theblitlabs/parity-client/internal/imagepolicy"
+	"github.com/theblitlabs/parity-client/internal/storage"
+	"github.com/theblitlabs/parity-client/internal/task"
+	"github.com/theblitlabs/parity-client/internal/utils"
+)
+
+var taskCmd = &cobra.Command{
+	Use:   "task",
+	Short: "Work with submitted compute tasks",
+	Long:  `Check task images against the image policy and retrieve the files tasks produce`,
+}
+
+var artifactsCmd = &cobra.Command{
+	Use:   "artifacts",
+	Short: "Manage task output artifacts",
+	Long:  `Retrieve the output files runners publish to IPFS for finished tasks`,
+}
+
+var downloadArtifactsCmd = &cobra.Command{
+	Use:   "download [task-id]",
+	Short: "Download and verify a task's output artifacts",
+	Long: `Download every output a runner published for the task from IPFS into a
+local directory, placing each at its path in the task container, and check
+that the downloaded content matches its CID.`,
+	Args: cobra.ExactArgs(1),
+	Example: `  # Download outputs to ./<task-id>
+  parity-client task artifacts download 3f2a9c1e-...
+
+  # Download to a specific directory from a specific runner
+  parity-client task artifacts download 3f2a9c1e-... --output ./results --runner http://runner-a:8080`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runDownloadArtifacts(cmd, args); err != nil {
+			log := gologger.Get()
+			log.Error().Err(err).Msg("Download artifacts failed")
+			os.Exit(1)
+		}
+	},
+}
+
+func runDownloadArtifacts(cmd *cobra.Command, args []string) error {
+	log := gologger.Get()
+
+	taskID := args[0]
+	outputDir, _ := cmd.Flags().GetString("output")
+	runnerURL, _ := cmd.Flags().GetString("runner")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	if taskID == "" {
+		return fmt.Errorf("task ID is required")
+	}
+	if outputDir == "" {
+		outputDir = taskID
+	}
+
+	configPath, _ := cmd.Flags().GetString("config-path")
+	if configPath == "" {
+		configPath = utils.GetDefaultConfigPath()
+	}
+
+	configManager := config.NewConfigManager(configPath)
+	cfg, err := configManager.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	found, err := findTask(ctx, cfg, runnerURL, taskID)
+	if err != nil {
+		return err
+	}
+	if len(found.Artifacts) == 0 {
+		return fmt.Errorf("task %s has no published artifacts (status: %s)", taskID, found.Status)
+	}
+
+	blockchainService, err := storage.NewBlockchainService(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize blockchain storage service: %w", err)
+	}
+
+	failed := 0
+	for _, artifact := range found.Artifacts {
+		dest, err := downloadArtifact(ctx, blockchainService, artifact, outputDir)
+		if err != nil {
+			log.Error().Err(err).
+				Str("path", artifact.Path).
+				Str("cid", artifact.CID).
+				Msg("Failed to retrieve artifact")
+			fmt.Printf("FAILED    %s (%s): %v\n", artifact.Path, artifact.CID, err)
+			failed++
+			continue
+		}
+		fmt.Printf("Verified  %s -> %s (%s)\n", artifact.Path, dest, artifact.CID)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d artifacts could not be retrieved", failed, len(found.Artifacts))
+	}
+
+	fmt.Printf("\nDownloaded %d artifacts to %s\n", len(found.Artifacts), outputDir)
+	return nil
+}
+
+// findTask asks runnerURL, or else each configured runner in turn, for the
+// task until one of them knows it.
+func findTask(ctx context.Context, cfg *config.Config, runnerURL, taskID string) (*client.TaskResponse, error) {
+	var runners []string
+	if runnerURL != "" {
+		runners = []string{runnerURL}
+	} else {
+		for _, u := range strings.Split(cfg.Runner.UpstreamURLs(), ",") {
+			if u = strings.TrimSpace(u); u != "" {
+				runners = append(runners, u)
+			}
+		}
+	}
+	if len(runners) == 0 {
+		return nil, fmt.Errorf("runner server URL not configured. Please set RUNNER_SERVER_URL in your config or pass --runner")
+	}
+
+	transport, err := outboundTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, runner := range runners {
+		found, err := client.NewTaskClient(strings.TrimSuffix(runner, "/"), transport).GetTask(ctx, taskID)
+		if err == nil {
+			return found, nil
+		}
+		lastErr = err
+		if !errors.Is(err, client.ErrTaskNotFound) {
+			log := gologger.Get()
+			log.Warn().Err(err).Str("runner", runner).Msg("Failed to get task from runner")
+		}
+	}
+	return nil, fmt.Errorf("failed to get task %s: %w", taskID, lastErr)
+}
+
+// downloadArtifact downloads artifact to its container path under
+// outputDir, verifying every block against its CID, and removes what it
+// wrote when that fails. It returns where the artifact was written.
+func downloadArtifact(ctx context.Context, blockchainService *storage.BlockchainService, artifact client.TaskArtifact, outputDir string) (string, error) {
+	if err := utils.ValidateCID("cid", artifact.CID); err != nil {
+		return "", err
+	}
+
+	rel := strings.TrimPrefix(path.Clean("/"+artifact.Path), "/")
+	if rel == "" {
+		rel = artifact.CID
+	}
+	dest := filepath.Join(outputDir, filepath.FromSlash(rel))
+
+	if err := checkArtifactParents(outputDir, rel); err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return "", fmt.Errorf("%s already exists", dest)
+	}
+
+	if err := blockchainService.DownloadPath(ctx, artifact.CID, dest); err != nil {
+		if removeErr := os.RemoveAll(dest); removeErr != nil {
+			log := gologger.Get()
+			log.Error().Err(removeErr).Str("path", dest).Msg("Failed to remove unverified artifact")
+		}
+		return "", err
+	}
+	return dest, nil
+}
+
+// checkArtifactParents fails when a directory on the way from outputDir to
+// rel is a symlink, which would let an artifact path from a runner write
+// outside outputDir.
+func checkArtifactParents(outputDir, rel string) error {
+	dir := outputDir
+	parts := strings.Split(rel, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", dir, err)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is a symlink; refusing to download through it", dir)
+		}
+	}
+	return nil
+}
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [image]",
+	Short: "Check a task image against the image policy",
+	Long: `Check an image, or the image of a task request file, against the image
+policy the proxy enforces, without contacting the proxy or a runner. Size and
+label rules are checked when the image is present in the local container
+runtime; nothing is pulled.`,
+	Args: cobra.MaximumNArgs(1),
+	Example: `  # Lint an image reference
+  parity-client task lint python:3.12
+
+  # Lint the image of a task request
+  parity-client task lint --file task.json
+
+  # Lint against another policy file
+  parity-client task lint ghcr.io/org/app:1.4 --policy ./image_policy.json`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := runLint(cmd, args); err != nil {
+			log := gologger.Get()
+			log.Error().Err(err).Msg("Task lint failed")
+			os.Exit(1)
+		}
+	},
+}
+
+func runLint(cmd *cobra.Command, args []string) error {
+	log := gologger.Get()
+
+	taskFile, _ := cmd.Flags().GetString("file")
+	policyPath, _ := cmd.Flags().GetString("policy")
+	if policyPath == "" {
+		policyPath = imagepolicy.DefaultPath()
+	}
+
+	var image string
+	switch {
+	case len(args) == 1 && taskFile != "":
+		return fmt.Errorf("pass either an image or --file, not both")
+	case len(args) == 1:
+		image = args[0]
+	case taskFile != "":
+		data, err := os.ReadFile(taskFile)
+		if err != nil {
+			return fmt.Errorf("failed to read task file: %w", err)
+		}
+		var req task.Request
+		if err := json.Unmarshal(data, &req); err != nil {
+			return fmt.Errorf("invalid task file %s: %w", taskFile, err)
+		}
+		if req.Build != nil {
+			return fmt.Errorf("task %s builds its image from source; lint the built image instead", taskFile)
+		}
+		image = req.Image
+	default:
+		return fmt.Errorf("an image or --file is required")
+	}
+
+	if err := utils.ValidateDockerImage(image); err != nil {
+		return err
+	}
+
+	policy, err := imagepolicy.Load(policyPath)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		fmt.Printf("No image policy at %s; every image is allowed\n", policyPath)
+		return nil
+	}
+
+	violations := policy.CheckReference(image)
+	if policy.NeedsImage() {
+		var containerCfg config.ContainerConfig
+		configPath, _ := cmd.Flags().GetString("config-path")
+		if configPath == "" {
+			configPath = utils.GetDefaultConfigPath()
+		}
+		if cfg, err := config.NewConfigManager(configPath).GetConfig(); err == nil {
+			containerCfg = cfg.Container
+		}
+
+		info, err := inspectLocalImage(containerCfg, image)
+		switch {
+		case errors.Is(err, service.ErrImageNotFound):
+			fmt.Printf("Note: %s is not present locally; size and label rules were not checked\n", image)
+		case err != nil:
+			return err
+		default:
+			violations = append(violations, policy.CheckImage(info)...)
+		}
+	}
+
+	fmt.Printf("Image: %s\n", image)
+	fmt.Printf("Policy: %s\n", policyPath)
+	if len(violations) == 0 {
+		fmt.Printf("OK: the image satisfies the image policy\n")
+		return nil
+	}
+
+	fmt.Printf("\n%d violations:\n", len(violations))
+	for _, v := range violations {
+		fmt.Printf("  - %s\n", v)
+	}
+	policyErr := &imagepolicy.Error{Image: image, Violations: violations}
+	log.Debug().Strs("violations", policyErr.Messages()).Msg("Image policy violations")
+	return policyErr
+}
+
+// inspectLocalImage looks image up in the configured container runtime
+// without pulling it.
+func inspectLocalImage(containerCfg config.ContainerConfig, image string) (*service.ImageInfo, error) {
+	runtime, err := service.NewRuntime(containerCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create container runtime: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	info, err := runtime.InspectImage(ctx, image)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect %s: %w", image, err)
+	}
+	return info, nil
+}
+
+func init() {
+	downloadArtifactsCmd.Flags().StringP("output", "o", "", "Directory to download artifacts into (default: ./<task-id>)")
+	downloadArtifactsCmd.Flags().String("runner", "", "Runner server URL to ask for the task (default: the configured runners)")
+	downloadArtifactsCmd.Flags().DurationP("timeout", "t", 30*time.Minute, "Timeout duration")
+
+	lintCmd.Flags().StringP("file", "f", "", "Task request JSON file to lint the image of")
+	lintCmd.Flags().String("policy", "", "Image policy file (default: ~/.parity/image_policy.json)")
+
+	artifactsCmd.AddCommand(downloadArtifactsCmd)
+	taskCmd.AddCommand(artifactsCmd)
+	taskCmd.AddCommand(lintCmd)
+}
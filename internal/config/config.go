@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -13,12 +14,35 @@ type Config struct {
 	BlockchainNetwork BlockchainNetworkConfig `mapstructure:"BLOCKCHAIN_NETWORK"`
 	Runner            RunnerConfig            `mapstructure:"RUNNER"`
 	FederatedLearning FederatedLearningConfig `mapstructure:"FL"`
+	Jobs              JobsConfig              `mapstructure:"JOBS"`
+	Upstream          UpstreamConfig          `mapstructure:"UPSTREAM"`
+	Limits            LimitsConfig            `mapstructure:"LIMITS"`
+	TLS               TLSConfig               `mapstructure:"TLS"`
+	Container         ContainerConfig         `mapstructure:"CONTAINER"`
 }
 
 type ServerConfig struct {
-	Host     string `mapstructure:"HOST"`
-	Port     int    `mapstructure:"PORT"`
-	Endpoint string `mapstructure:"ENDPOINT"`
+	Host              string        `mapstructure:"HOST"`
+	Port              int           `mapstructure:"PORT"`
+	Endpoint          string        `mapstructure:"ENDPOINT"`
+	ReadTimeout       time.Duration `mapstructure:"READ_TIMEOUT"`
+	ReadHeaderTimeout time.Duration `mapstructure:"READ_HEADER_TIMEOUT"`
+	WriteTimeout      time.Duration `mapstructure:"WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `mapstructure:"IDLE_TIMEOUT"`
+	ShutdownTimeout   time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"`
+	AuthRequired      bool          `mapstructure:"AUTH_REQUIRED"`
+	AllowedIPs        string        `mapstructure:"ALLOWED_IPS"`
+	AllowedHosts      string        `mapstructure:"ALLOWED_HOSTS"`
+	CORSOrigins       string        `mapstructure:"CORS_ALLOWED_ORIGINS"`
+	CORSMaxAge        time.Duration `mapstructure:"CORS_MAX_AGE"`
+	AccessLog         string        `mapstructure:"ACCESS_LOG"`
+	AccessLogMaxSize  int64         `mapstructure:"ACCESS_LOG_MAX_SIZE"`
+	AccessLogBackups  int           `mapstructure:"ACCESS_LOG_MAX_BACKUPS"`
+	Socket            bool          `mapstructure:"SOCKET"`
+	SocketPath        string        `mapstructure:"SOCKET_PATH"`
+	TLSCertFile       string        `mapstructure:"TLS_CERT_FILE"`
+	TLSKeyFile        string        `mapstructure:"TLS_KEY_FILE"`
+	TLSClientCAFile   string        `mapstructure:"TLS_CLIENT_CA_FILE"`
 }
 
 type BlockchainNetworkConfig struct {
@@ -39,9 +63,63 @@ type FederatedLearningConfig struct {
 }
 
 type RunnerConfig struct {
-	ServerURL   string `mapstructure:"SERVER_URL"`
-	WebhookPort int    `mapstructure:"WEBHOOK_PORT"`
-	APIPrefix   string `mapstructure:"API_PREFIX"`
+	ServerURL      string        `mapstructure:"SERVER_URL"`
+	ServerURLs     string        `mapstructure:"SERVER_URLS"`
+	LoadBalancing  string        `mapstructure:"LOAD_BALANCING"`
+	HealthInterval time.Duration `mapstructure:"HEALTH_INTERVAL"`
+	WebhookPort    int           `mapstructure:"WEBHOOK_PORT"`
+	APIPrefix      string        `mapstructure:"API_PREFIX"`
+	EncryptionKeys string        `mapstructure:"ENCRYPTION_KEYS"`
+}
+
+// UpstreamURLs returns the runner servers the proxy balances across:
+// SERVER_URLS when set, otherwise SERVER_URL.
+func (c RunnerConfig) UpstreamURLs() string {
+	if strings.TrimSpace(c.ServerURLs) != "" {
+		return c.ServerURLs
+	}
+	return c.ServerURL
+}
+
+type JobsConfig struct {
+	Workers           int           `mapstructure:"WORKERS"`
+	QueueSize         int           `mapstructure:"QUEUE_SIZE"`
+	Retention         time.Duration `mapstructure:"RETENTION"`
+	IdempotencyWindow time.Duration `mapstructure:"IDEMPOTENCY_WINDOW"`
+}
+
+type UpstreamConfig struct {
+	Timeout          time.Duration `mapstructure:"TIMEOUT"`
+	RouteTimeouts    string        `mapstructure:"ROUTE_TIMEOUTS"`
+	Retries          int           `mapstructure:"RETRIES"`
+	RetryBackoff     time.Duration `mapstructure:"RETRY_BACKOFF"`
+	RetryMaxBackoff  time.Duration `mapstructure:"RETRY_MAX_BACKOFF"`
+	BreakerThreshold int           `mapstructure:"BREAKER_THRESHOLD"`
+	BreakerCooldown  time.Duration `mapstructure:"BREAKER_COOLDOWN"`
+}
+
+type LimitsConfig struct {
+	Rate               float64 `mapstructure:"RATE"`
+	Burst              int     `mapstructure:"BURST"`
+	RouteRates         string  `mapstructure:"ROUTE_RATES"`
+	MaxJSONBody        int64   `mapstructure:"MAX_JSON_BODY"`
+	MaxUploadBody      int64   `mapstructure:"MAX_UPLOAD_BODY"`
+	MaxPassthroughBody int64   `mapstructure:"MAX_PASSTHROUGH_BODY"`
+}
+
+// TLSConfig applies to outbound HTTPS calls to the runner, the federated
+// learning server and other services.
+type TLSConfig struct {
+	CAFile         string `mapstructure:"CA_FILE"`
+	ClientCertFile string `mapstructure:"CLIENT_CERT_FILE"`
+	ClientKeyFile  string `mapstructure:"CLIENT_KEY_FILE"`
+}
+
+// ContainerConfig selects the container runtime images are read from.
+type ContainerConfig struct {
+	Runtime   string `mapstructure:"RUNTIME"`
+	Host      string `mapstructure:"RUNTIME_HOST"`
+	Namespace string `mapstructure:"RUNTIME_NAMESPACE"`
 }
 
 type ConfigManager struct {
@@ -96,9 +174,27 @@ func loadConfigFile(path string) (*Config, error) {
 	}
 
 	v.SetDefault("SERVER", map[string]interface{}{
-		"HOST":     v.GetString("SERVER_HOST"),
-		"PORT":     v.GetInt("SERVER_PORT"),
-		"ENDPOINT": v.GetString("SERVER_ENDPOINT"),
+		"HOST":                   v.GetString("SERVER_HOST"),
+		"PORT":                   v.GetInt("SERVER_PORT"),
+		"ENDPOINT":               v.GetString("SERVER_ENDPOINT"),
+		"READ_TIMEOUT":           v.GetDuration("SERVER_READ_TIMEOUT"),
+		"READ_HEADER_TIMEOUT":    v.GetDuration("SERVER_READ_HEADER_TIMEOUT"),
+		"WRITE_TIMEOUT":          v.GetDuration("SERVER_WRITE_TIMEOUT"),
+		"IDLE_TIMEOUT":           v.GetDuration("SERVER_IDLE_TIMEOUT"),
+		"SHUTDOWN_TIMEOUT":       v.GetDuration("SERVER_SHUTDOWN_TIMEOUT"),
+		"AUTH_REQUIRED":          v.GetBool("SERVER_AUTH_REQUIRED"),
+		"ALLOWED_IPS":            v.GetString("SERVER_ALLOWED_IPS"),
+		"ALLOWED_HOSTS":          v.GetString("SERVER_ALLOWED_HOSTS"),
+		"CORS_ALLOWED_ORIGINS":   v.GetString("SERVER_CORS_ALLOWED_ORIGINS"),
+		"CORS_MAX_AGE":           v.GetDuration("SERVER_CORS_MAX_AGE"),
+		"ACCESS_LOG":             v.GetString("SERVER_ACCESS_LOG"),
+		"ACCESS_LOG_MAX_SIZE":    v.GetInt64("SERVER_ACCESS_LOG_MAX_SIZE"),
+		"ACCESS_LOG_MAX_BACKUPS": v.GetInt("SERVER_ACCESS_LOG_MAX_BACKUPS"),
+		"SOCKET":                 v.GetBool("SERVER_SOCKET"),
+		"SOCKET_PATH":            v.GetString("SERVER_SOCKET_PATH"),
+		"TLS_CERT_FILE":          v.GetString("SERVER_TLS_CERT_FILE"),
+		"TLS_KEY_FILE":           v.GetString("SERVER_TLS_KEY_FILE"),
+		"TLS_CLIENT_CA_FILE":     v.GetString("SERVER_TLS_CLIENT_CA_FILE"),
 	})
 
 	v.SetDefault("BLOCKCHAIN_NETWORK", map[string]interface{}{
@@ -112,9 +208,13 @@ func loadConfigFile(path string) (*Config, error) {
 	})
 
 	v.SetDefault("RUNNER", map[string]interface{}{
-		"SERVER_URL":   v.GetString("RUNNER_SERVER_URL"),
-		"WEBHOOK_PORT": v.GetInt("RUNNER_WEBHOOK_PORT"),
-		"API_PREFIX":   v.GetString("RUNNER_API_PREFIX"),
+		"SERVER_URL":      v.GetString("RUNNER_SERVER_URL"),
+		"SERVER_URLS":     v.GetString("RUNNER_SERVER_URLS"),
+		"LOAD_BALANCING":  v.GetString("RUNNER_LOAD_BALANCING"),
+		"HEALTH_INTERVAL": v.GetDuration("RUNNER_HEALTH_INTERVAL"),
+		"WEBHOOK_PORT":    v.GetInt("RUNNER_WEBHOOK_PORT"),
+		"API_PREFIX":      v.GetString("RUNNER_API_PREFIX"),
+		"ENCRYPTION_KEYS": v.GetString("RUNNER_ENCRYPTION_KEYS"),
 	})
 
 	v.SetDefault("FL", map[string]interface{}{
@@ -124,6 +224,44 @@ func loadConfigFile(path string) (*Config, error) {
 		"LOG_LEVEL":       v.GetString("FL_LOG_LEVEL"),
 	})
 
+	v.SetDefault("JOBS", map[string]interface{}{
+		"WORKERS":            v.GetInt("JOBS_WORKERS"),
+		"QUEUE_SIZE":         v.GetInt("JOBS_QUEUE_SIZE"),
+		"RETENTION":          v.GetDuration("JOBS_RETENTION"),
+		"IDEMPOTENCY_WINDOW": v.GetDuration("JOBS_IDEMPOTENCY_WINDOW"),
+	})
+
+	v.SetDefault("UPSTREAM", map[string]interface{}{
+		"TIMEOUT":           v.GetDuration("UPSTREAM_TIMEOUT"),
+		"ROUTE_TIMEOUTS":    v.GetString("UPSTREAM_ROUTE_TIMEOUTS"),
+		"RETRIES":           v.GetInt("UPSTREAM_RETRIES"),
+		"RETRY_BACKOFF":     v.GetDuration("UPSTREAM_RETRY_BACKOFF"),
+		"RETRY_MAX_BACKOFF": v.GetDuration("UPSTREAM_RETRY_MAX_BACKOFF"),
+		"BREAKER_THRESHOLD": v.GetInt("UPSTREAM_BREAKER_THRESHOLD"),
+		"BREAKER_COOLDOWN":  v.GetDuration("UPSTREAM_BREAKER_COOLDOWN"),
+	})
+
+	v.SetDefault("LIMITS", map[string]interface{}{
+		"RATE":                 v.GetFloat64("LIMITS_RATE"),
+		"BURST":                v.GetInt("LIMITS_BURST"),
+		"ROUTE_RATES":          v.GetString("LIMITS_ROUTE_RATES"),
+		"MAX_JSON_BODY":        v.GetInt64("LIMITS_MAX_JSON_BODY"),
+		"MAX_UPLOAD_BODY":      v.GetInt64("LIMITS_MAX_UPLOAD_BODY"),
+		"MAX_PASSTHROUGH_BODY": v.GetInt64("LIMITS_MAX_PASSTHROUGH_BODY"),
+	})
+
+	v.SetDefault("TLS", map[string]interface{}{
+		"CA_FILE":          v.GetString("TLS_CA_FILE"),
+		"CLIENT_CERT_FILE": v.GetString("TLS_CLIENT_CERT_FILE"),
+		"CLIENT_KEY_FILE":  v.GetString("TLS_CLIENT_KEY_FILE"),
+	})
+
+	v.SetDefault("CONTAINER", map[string]interface{}{
+		"RUNTIME":           v.GetString("CONTAINER_RUNTIME"),
+		"RUNTIME_HOST":      v.GetString("CONTAINER_RUNTIME_HOST"),
+		"RUNTIME_NAMESPACE": v.GetString("CONTAINER_RUNTIME_NAMESPACE"),
+	})
+
 	var config Config
 	if err := v.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("unable to decode into config struct: %w", err)
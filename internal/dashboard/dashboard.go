@@ -0,0 +1,36 @@
+// Package dashboard embeds the single-page web dashboard served by the proxy
+// under /ui.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// Prefix is the path the dashboard is mounted under.
+const Prefix = "/ui/"
+
+//go:embed static
+var static embed.FS
+
+// Handler serves the dashboard assets. Requests for /ui are redirected to
+// /ui/ so relative asset paths resolve.
+func Handler() http.Handler {
+	assets, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+
+	files := http.StripPrefix(Prefix, http.FileServer(http.FS(assets)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ui" {
+			http.Redirect(w, r, Prefix, http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; style-src 'self'; script-src 'self'; frame-ancestors 'none'")
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,267 @@
+"use strict";
+
+const tokenKey = "parity-client-token";
+let identity = {};
+
+function $(id) {
+  return document.getElementById(id);
+}
+
+async function api(path, options = {}) {
+  const headers = Object.assign({}, options.headers);
+  const token = localStorage.getItem(tokenKey);
+  if (token) {
+    headers["Authorization"] = "Bearer " + token;
+  }
+  if (options.body !== undefined) {
+    headers["Content-Type"] = "application/json";
+    options.body = JSON.stringify(options.body);
+  }
+
+  const resp = await fetch("/api/" + path, Object.assign({}, options, { headers }));
+  const text = await resp.text();
+  const data = text ? JSON.parse(text) : null;
+  if (!resp.ok) {
+    throw new Error((data && data.message) || resp.status + " " + resp.statusText);
+  }
+  return data;
+}
+
+function showError(err) {
+  const box = $("error");
+  if (!err) {
+    box.hidden = true;
+    return;
+  }
+  box.textContent = err.message || String(err);
+  box.hidden = false;
+}
+
+function guarded(fn) {
+  return async (...args) => {
+    try {
+      showError(null);
+      await fn(...args);
+    } catch (err) {
+      showError(err);
+    }
+  };
+}
+
+function cell(text, className) {
+  const td = document.createElement("td");
+  td.textContent = text === undefined || text === null ? "" : String(text);
+  if (className) {
+    td.className = className;
+  }
+  return td;
+}
+
+function fillTable(tbody, rows, columns) {
+  tbody.replaceChildren();
+  for (const row of rows) {
+    const tr = document.createElement("tr");
+    for (const column of columns) {
+      const value = column(row);
+      tr.appendChild(value instanceof Node ? wrapCell(value) : cell(value));
+    }
+    tbody.appendChild(tr);
+  }
+}
+
+function wrapCell(node) {
+  const td = document.createElement("td");
+  td.appendChild(node);
+  return td;
+}
+
+function truncate(s, n) {
+  return s && s.length > n ? s.slice(0, n) + "…" : s;
+}
+
+// Wallet
+
+const loadWallet = guarded(async () => {
+  const report = await api("local/wallet");
+  const entries = [
+    ["Wallet", report.wallet_address],
+    ["Balance", report.token_balance + " " + report.token_symbol],
+  ];
+  if (report.stake) {
+    entries.push(
+      ["Staked", report.stake.amount],
+      ["Device", report.stake.device_id],
+      ["Stake contract", report.stake.contract_address],
+      ["Contract balance", report.stake.contract_balance],
+    );
+  } else {
+    entries.push(["Stake", "No active stake"]);
+  }
+
+  const dl = $("wallet-details");
+  dl.replaceChildren();
+  for (const [term, value] of entries) {
+    const dt = document.createElement("dt");
+    dt.textContent = term;
+    const dd = document.createElement("dd");
+    dd.textContent = value;
+    dl.append(dt, dd);
+  }
+});
+
+// Tasks
+
+const loadJobs = guarded(async () => {
+  const list = await api("local/jobs");
+  fillTable($("jobs"), list.jobs, [
+    (j) => j.id,
+    (j) => j.title,
+    (j) => j.image,
+    (j) => j.phase + (j.error ? ": " + j.error : ""),
+    (j) => j.task_id,
+    (j) => new Date(j.updated_at).toLocaleString(),
+  ]);
+});
+
+const submitTask = guarded(async (event) => {
+  event.preventDefault();
+  const form = event.target;
+  const command = form.command.value.trim();
+  // Keep one key per form submission so a retried request is not queued twice.
+  form.dataset.idempotencyKey = form.dataset.idempotencyKey || crypto.randomUUID();
+  await api("tasks", {
+    method: "POST",
+    headers: { "Idempotency-Key": form.dataset.idempotencyKey },
+    body: {
+      title: form.title.value,
+      description: form.description.value,
+      image: form.image.value,
+      command: command ? command.split(/\s+/) : [],
+    },
+  });
+  form.reset();
+  delete form.dataset.idempotencyKey;
+  await loadJobs();
+});
+
+// LLM
+
+const loadModels = guarded(async () => {
+  const resp = await api("local/llm/models");
+  const select = $("models");
+  select.replaceChildren();
+  for (const model of resp.models || []) {
+    const option = document.createElement("option");
+    option.value = model.model_name;
+    option.textContent = model.model_name + (model.is_loaded ? "" : " (loading)");
+    select.appendChild(option);
+  }
+});
+
+const loadPrompts = guarded(async () => {
+  const list = await api("local/llm/prompts?limit=20");
+  fillTable($("prompts"), list.prompts || [], [
+    (p) => p.id,
+    (p) => p.model_name,
+    (p) => p.status,
+    (p) => p.created_at,
+    (p) => truncate(p.response, 200),
+  ]);
+});
+
+const submitPrompt = guarded(async (event) => {
+  event.preventDefault();
+  const form = event.target;
+  await api("local/llm/prompts", {
+    method: "POST",
+    body: { model: form.model.value, prompt: form.prompt.value },
+  });
+  form.prompt.value = "";
+  await loadPrompts();
+});
+
+// Federated learning
+
+const startSession = guarded(async (id) => {
+  await api("local/fl/sessions/" + encodeURIComponent(id) + "/start", { method: "POST", body: {} });
+  await loadSessions();
+});
+
+const loadSessions = guarded(async () => {
+  const mine = $("fl-mine").checked && identity.creator_address;
+  const query = mine ? "?creator=" + encodeURIComponent(identity.creator_address) : "";
+  const list = await api("local/fl/sessions" + query);
+  fillTable($("sessions"), list.sessions || [], [
+    (s) => s.id,
+    (s) => s.name,
+    (s) => s.model_type,
+    (s) => s.status,
+    (s) => s.current_round + "/" + s.total_rounds,
+    (s) => s.participant_count + "/" + s.min_participants,
+    (s) => {
+      if (s.status !== "pending") {
+        return "";
+      }
+      const button = document.createElement("button");
+      button.textContent = "Start";
+      button.addEventListener("click", () => startSession(s.id));
+      return button;
+    },
+  ]);
+});
+
+// Navigation
+
+const loaders = {
+  wallet: loadWallet,
+  tasks: loadJobs,
+  llm: () => Promise.all([loadModels(), loadPrompts()]),
+  fl: loadSessions,
+};
+
+function showTab(name) {
+  for (const button of document.querySelectorAll("nav button")) {
+    button.classList.toggle("active", button.dataset.tab === name);
+  }
+  for (const section of document.querySelectorAll("main section")) {
+    section.hidden = section.id !== name;
+  }
+  loaders[name]();
+}
+
+const loadIdentity = guarded(async () => {
+  identity = await api("local/info");
+  $("identity").textContent = identity.creator_address + " · device " + identity.device_id;
+});
+
+document.addEventListener("DOMContentLoaded", async () => {
+  $("token").value = localStorage.getItem(tokenKey) || "";
+  $("token-form").addEventListener("submit", (event) => {
+    event.preventDefault();
+    const token = $("token").value.trim();
+    if (token) {
+      localStorage.setItem(tokenKey, token);
+    } else {
+      localStorage.removeItem(tokenKey);
+    }
+    loadIdentity();
+  });
+
+  for (const button of document.querySelectorAll("nav button")) {
+    button.addEventListener("click", () => showTab(button.dataset.tab));
+  }
+
+  $("wallet-refresh").addEventListener("click", loadWallet);
+  $("jobs-refresh").addEventListener("click", loadJobs);
+  $("task-form").addEventListener("submit", submitTask);
+  $("task-form").addEventListener("input", (event) => {
+    delete event.currentTarget.dataset.idempotencyKey;
+  });
+  $("prompts-refresh").addEventListener("click", loadPrompts);
+  $("prompt-form").addEventListener("submit", submitPrompt);
+  $("sessions-refresh").addEventListener("click", loadSessions);
+  $("fl-mine").addEventListener("change", loadSessions);
+
+  await loadIdentity();
+  showTab("wallet");
+});
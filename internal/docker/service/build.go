@@ -0,0 +1,456 @@
+package service
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/theblitlabs/parity-client/internal/metrics"
+)
+
+// BuildRepository is the repository of images built from task sources. The
+// localhost domain keeps every runtime from looking for them in a registry.
+const BuildRepository = "localhost/parity-build"
+
+// BuildContext is a build context spooled to a temporary tar file, so it can
+// be hashed for the image tag and then streamed to the runtime.
+type BuildContext struct {
+	path   string
+	digest string
+}
+
+// NewBuildContextFromDir packs dir into a BuildContext, leaving out the
+// paths its .dockerignore excludes other than dockerfile and .dockerignore
+// itself, which the builder always needs. Entries are written in sorted
+// order with their modification times and owners cleared, so the same
+// files always produce the same digest.
+func NewBuildContextFromDir(dir, dockerfile string) (*BuildContext, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid build context: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("invalid build context: %s is not a directory", dir)
+	}
+
+	ignore, err := readDockerignore(dir)
+	if err != nil {
+		return nil, err
+	}
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	ignore.keep = []string{".dockerignore", strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(dockerfile)), "/")}
+
+	return spool(func(w io.Writer) error {
+		return packDirectory(w, dir, ignore)
+	})
+}
+
+// NewBuildContextFromArchive spools a build context uploaded as a tar,
+// which may be gzip-compressed.
+func NewBuildContextFromArchive(r io.Reader) (*BuildContext, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(2)
+
+	var src io.Reader = br
+	if len(head) == 2 && head[0] == 0x1f && head[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("invalid build context archive: %w", err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+
+	return spool(func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+}
+
+func spool(write func(w io.Writer) error) (*BuildContext, error) {
+	file, err := os.CreateTemp("", "parity-build-context-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create build context file: %w", err)
+	}
+
+	hasher := sha256.New()
+	writeErr := write(io.MultiWriter(file, hasher))
+	closeErr := file.Close()
+	if writeErr == nil {
+		writeErr = closeErr
+	}
+	if writeErr != nil {
+		_ = os.Remove(file.Name())
+		return nil, fmt.Errorf("failed to write build context: %w", writeErr)
+	}
+
+	return &BuildContext{path: file.Name(), digest: hex.EncodeToString(hasher.Sum(nil))}, nil
+}
+
+// Digest returns the hex SHA-256 of the context tar.
+func (c *BuildContext) Digest() string {
+	return c.digest
+}
+
+// Open returns the context tar for reading.
+func (c *BuildContext) Open() (io.ReadCloser, error) {
+	return os.Open(c.path)
+}
+
+// Close removes the spooled context.
+func (c *BuildContext) Close() error {
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// BuildTag returns the content-derived tag for building buildContext with
+// opts, ignoring opts.Tag: the same sources, Dockerfile, build args and
+// target always map to the same image name.
+func BuildTag(buildContext *BuildContext, opts BuildOptions) string {
+	keys := make([]string, 0, len(opts.Args))
+	for key := range opts.Args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "context=%s\ndockerfile=%s\ntarget=%s\n", buildContext.Digest(), opts.Dockerfile, opts.Target)
+	for _, key := range keys {
+		fmt.Fprintf(hasher, "arg=%s=%s\n", key, opts.Args[key])
+	}
+
+	return BuildRepository + ":" + hex.EncodeToString(hasher.Sum(nil))[:32]
+}
+
+// BuildImage builds buildContext into the image opts.Tag, unless the runtime
+// already has an image with that tag from an earlier build of the same
+// sources. Build output is passed to log line by line.
+func (s *DockerService) BuildImage(ctx context.Context, opts BuildOptions, buildContext *BuildContext, log BuildLogFunc) (err error) {
+	if _, err := s.runtime.InspectImage(ctx, opts.Tag); err == nil {
+		s.log.Info().Str("image", opts.Tag).Msg("Reusing image built from the same sources")
+		if log != nil {
+			log("Using existing image " + opts.Tag + " built from the same sources")
+		}
+		return nil
+	}
+
+	src, err := buildContext.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open build context: %w", err)
+	}
+	defer src.Close()
+
+	s.log.Info().
+		Str("image", opts.Tag).
+		Str("dockerfile", opts.Dockerfile).
+		Str("target", opts.Target).
+		Msg("Building Docker image")
+
+	started := time.Now()
+	defer func() {
+		metrics.DockerOperationDuration.Observe(time.Since(started).Seconds(), "build", metrics.Result(err))
+	}()
+
+	if log == nil {
+		log = func(string) {}
+	}
+	return s.runtime.BuildImage(ctx, opts, src, log)
+}
+
+// lineWriter splits what is written to it into lines for a BuildLogFunc.
+type lineWriter struct {
+	log BuildLogFunc
+	buf bytes.Buffer
+}
+
+func newLineWriter(log BuildLogFunc) *lineWriter {
+	return &lineWriter{log: log}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	for {
+		i := bytes.IndexByte(w.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := strings.TrimRight(string(w.buf.Next(i+1)), "\r\n")
+		if w.log != nil {
+			w.log(line)
+		}
+	}
+}
+
+// Flush passes on a final line that did not end in a newline.
+func (w *lineWriter) Flush() {
+	if w.buf.Len() > 0 && w.log != nil {
+		w.log(strings.TrimRight(w.buf.String(), "\r\n"))
+	}
+	w.buf.Reset()
+}
+
+func packDirectory(w io.Writer, dir string, ignore *dockerignore) error {
+	var paths []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ignore.excludes(rel) {
+			// Directories are still walked when a later ! pattern could
+			// bring back something inside them.
+			if d.IsDir() && !ignore.hasExceptions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		paths = append(paths, rel)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read build context: %w", err)
+	}
+	sort.Strings(paths)
+
+	tw := tar.NewWriter(w)
+	for _, rel := range paths {
+		if err := addToTar(tw, dir, rel); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func addToTar(tw *tar.Writer, dir, rel string) error {
+	full := filepath.Join(dir, filepath.FromSlash(rel))
+	info, err := os.Lstat(full)
+	if err != nil {
+		return err
+	}
+
+	var link string
+	if info.Mode()&os.ModeSymlink != 0 {
+		if link, err = os.Readlink(full); err != nil {
+			return err
+		}
+	}
+
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return fmt.Errorf("cannot add %s to build context: %w", rel, err)
+	}
+	hdr.Name = rel
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	hdr.ModTime = time.Unix(0, 0)
+	hdr.AccessTime = time.Time{}
+	hdr.ChangeTime = time.Time{}
+	hdr.Uid, hdr.Gid = 0, 0
+	hdr.Uname, hdr.Gname = "", ""
+	hdr.Format = tar.FormatPAX
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	file, err := os.Open(full)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(tw, file)
+	return err
+}
+
+// extractContext unpacks a build context tar into dir for runtimes that
+// build from a directory. Entries that would land outside dir are rejected,
+// and no entry is written through a symlink an earlier entry created.
+func extractContext(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid build context archive: %w", err)
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if name == "" {
+			continue
+		}
+		if err := checkNoSymlinks(dir, name); err != nil {
+			return fmt.Errorf("invalid build context archive: %w", err)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		mode := hdr.FileInfo().Mode().Perm()
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, mode|0o700)
+		case tar.TypeReg:
+			err = writeContextFile(target, tr, mode)
+		case tar.TypeSymlink:
+			// The link is created but never followed: checkNoSymlinks
+			// rejects later entries beneath it, so where it points only
+			// matters to the runtime, which reads the context as is.
+			resolved := filepath.Join(filepath.Dir(target), filepath.FromSlash(hdr.Linkname))
+			if filepath.IsAbs(hdr.Linkname) || !withinDir(dir, resolved) {
+				return fmt.Errorf("invalid build context archive: %s links outside the context", name)
+			}
+			if err = os.MkdirAll(filepath.Dir(target), 0o700); err == nil {
+				err = os.Symlink(hdr.Linkname, target)
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract build context: %w", err)
+		}
+	}
+}
+
+// checkNoSymlinks walks the slash-separated name below dir with os.Lstat
+// and fails if any component that already exists is a symlink, so that
+// nothing is created through one.
+func checkNoSymlinks(dir, name string) error {
+	current := dir
+	for _, part := range strings.Split(name, "/") {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s is written through the symlink %s", name, strings.TrimPrefix(current, dir+string(filepath.Separator)))
+		}
+	}
+	return nil
+}
+
+func withinDir(dir, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func writeContextFile(target string, r io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode|0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// dockerignore holds the patterns of a .dockerignore file. Patterns use
+// filepath.Match syntax, match a path or any of its parent directories,
+// and a leading ! re-includes what earlier patterns excluded. The **
+// wildcard is not supported.
+type dockerignore struct {
+	patterns []ignorePattern
+	keep     []string
+}
+
+type ignorePattern struct {
+	pattern   string
+	exception bool
+}
+
+func readDockerignore(dir string) (*dockerignore, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ".dockerignore"))
+	if errors.Is(err, os.ErrNotExist) {
+		return &dockerignore{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .dockerignore: %w", err)
+	}
+
+	ignore := &dockerignore{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p := ignorePattern{}
+		if strings.HasPrefix(line, "!") {
+			p.exception = true
+			line = strings.TrimSpace(line[1:])
+		}
+		p.pattern = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(line)), "/")
+		if _, err := path.Match(p.pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid .dockerignore pattern %q: %w", line, err)
+		}
+		ignore.patterns = append(ignore.patterns, p)
+	}
+	return ignore, nil
+}
+
+func (d *dockerignore) excludes(rel string) bool {
+	for _, keep := range d.keep {
+		if rel == keep || strings.HasPrefix(keep, rel+"/") {
+			return false
+		}
+	}
+
+	excluded := false
+	for _, p := range d.patterns {
+		if p.matches(rel) {
+			excluded = !p.exception
+		}
+	}
+	return excluded
+}
+
+func (d *dockerignore) hasExceptions() bool {
+	for _, p := range d.patterns {
+		if p.exception {
+			return true
+		}
+	}
+	return false
+}
+
+func (p ignorePattern) matches(rel string) bool {
+	for candidate := rel; candidate != "."; candidate = path.Dir(candidate) {
+		if ok, _ := path.Match(p.pattern, candidate); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	goruntime "runtime"
+	"strings"
+
+	"github.com/theblitlabs/parity-client/internal/utils"
+)
+
+const defaultContainerdNamespace = "default"
+
+// ContainerdRuntime drives containerd through its ctr CLI. containerd has no
+// Docker-compatible API, and ctr's image export includes the manifest.json
+// that `docker save` archives carry, so the runner can load it the same way.
+// containerd only knows fully qualified references, so short names such as
+// alpine are expanded to docker.io/library/alpine:latest.
+type ContainerdRuntime struct {
+	binary    string
+	address   string
+	namespace string
+}
+
+// NewContainerdRuntime returns a runtime using the containerd socket at
+// address, or ctr's default when empty, and the given namespace.
+func NewContainerdRuntime(address, namespace string) *ContainerdRuntime {
+	if namespace == "" {
+		namespace = defaultContainerdNamespace
+	}
+	return &ContainerdRuntime{
+		binary:    "ctr",
+		address:   strings.TrimPrefix(address, "unix://"),
+		namespace: namespace,
+	}
+}
+
+func (r *ContainerdRuntime) Name() string {
+	return "containerd"
+}
+
+func (r *ContainerdRuntime) Ping(ctx context.Context) error {
+	_, err := runCommand(ctx, r.Name(), "ping", "", r.binary, r.args("version")...)
+	return err
+}
+
+func (r *ContainerdRuntime) InspectImage(ctx context.Context, image string) (*ImageInfo, error) {
+	ref := normalizeReference(image)
+	out, err := runCommand(ctx, r.Name(), "inspect", image, r.binary, r.args("images", "ls", "name=="+ref)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Columns are REF TYPE DIGEST SIZE PLATFORMS LABELS, after a header line.
+	// DIGEST is the manifest or index digest, not the image ID. SIZE is
+	// rounded and split in two, such as "2.7 MiB", and LABELS are
+	// containerd's own rather than the image's, so only the size is kept.
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 3 && fields[0] == ref {
+			info := &ImageInfo{RepoTags: []string{ref}}
+			if len(fields) >= 5 {
+				info.Size, _ = utils.ParseMemory(fields[3] + fields[4])
+			}
+			// The ID is left empty when the config cannot be found, so
+			// callers skip what needs it rather than use a wrong one.
+			info.ID, _ = r.configDigest(ctx, image, fields[2])
+			return info, nil
+		}
+	}
+
+	return nil, &RuntimeError{
+		Runtime:    r.Name(),
+		Op:         "inspect",
+		Image:      image,
+		StatusCode: http.StatusNotFound,
+		Message:    "no such image in namespace " + r.namespace,
+	}
+}
+
+// manifestBlob holds the fields of an image manifest or index that lead
+// to the image config.
+type manifestBlob struct {
+	Config struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// configDigest follows digest, the manifest or index ctr lists for image,
+// to the digest of the image config, which is the ID Docker and Podman
+// report for the same image. For an index it picks the manifest for this
+// host's platform, the one ctr pulls.
+func (r *ContainerdRuntime) configDigest(ctx context.Context, image, digest string) (string, error) {
+	for depth := 0; depth < 2; depth++ {
+		out, err := runCommand(ctx, r.Name(), "inspect", image, r.binary, r.args("content", "get", digest)...)
+		if err != nil {
+			return "", err
+		}
+
+		var blob manifestBlob
+		if err := json.Unmarshal(out, &blob); err != nil {
+			return "", fmt.Errorf("invalid manifest %s: %w", digest, err)
+		}
+		if blob.Config.Digest != "" {
+			return blob.Config.Digest, nil
+		}
+
+		digest = ""
+		for _, m := range blob.Manifests {
+			if m.Platform.OS == goruntime.GOOS && m.Platform.Architecture == goruntime.GOARCH {
+				digest = m.Digest
+				break
+			}
+		}
+		if digest == "" {
+			return "", fmt.Errorf("no manifest for %s/%s in image %s", goruntime.GOOS, goruntime.GOARCH, image)
+		}
+	}
+	return "", fmt.Errorf("no image config found for %s", image)
+}
+
+func (r *ContainerdRuntime) PullImage(ctx context.Context, image string, progress PullProgressFunc) error {
+	if _, err := runCommand(ctx, r.Name(), "pull", image, r.binary, r.args("images", "pull", normalizeReference(image))...); err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(PullProgress{Layer: image, Status: "Pull complete"})
+	}
+	return nil
+}
+
+func (r *ContainerdRuntime) SaveImage(ctx context.Context, image string) (io.ReadCloser, error) {
+	return streamCommand(ctx, r.Name(), "save", image, r.binary, r.args("images", "export", "-", normalizeReference(image))...)
+}
+
+// BuildImage always fails: ctr has no image builder.
+func (r *ContainerdRuntime) BuildImage(ctx context.Context, opts BuildOptions, buildContext io.Reader, log BuildLogFunc) error {
+	return &RuntimeError{
+		Runtime: r.Name(),
+		Op:      "build",
+		Image:   opts.Tag,
+		Message: "containerd cannot build images; use the docker or podman runtime",
+		Err:     ErrBuildUnsupported,
+	}
+}
+
+func (r *ContainerdRuntime) args(args ...string) []string {
+	global := []string{"--namespace", r.namespace}
+	if r.address != "" {
+		global = append(global, "--address", r.address)
+	}
+	return append(global, args...)
+}
+
+// normalizeReference expands a Docker-style short image reference into the
+// fully qualified form containerd stores.
+func normalizeReference(image string) string {
+	first, _, hasDomain := strings.Cut(image, "/")
+	if !hasDomain || !(strings.ContainsAny(first, ".:") || first == "localhost") {
+		if !strings.Contains(image, "/") {
+			image = "library/" + image
+		}
+		image = "docker.io/" + image
+	}
+
+	if _, tag := splitReference(image); tag == "" {
+		image += ":latest"
+	}
+	return image
+}
@@ -2,142 +2,124 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
-	"os"
-	"os/exec"
-	"path/filepath"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/theblitlabs/gologger"
+	"github.com/theblitlabs/parity-client/internal/metrics"
+	"github.com/theblitlabs/parity-client/internal/requestid"
 	"github.com/theblitlabs/parity-client/internal/utils"
+	"github.com/theblitlabs/parity-client/pkg/imagehash"
+	"github.com/theblitlabs/parity-client/pkg/requestsig"
 )
 
 type DockerService struct {
-	log zerolog.Logger
+	runtime ContainerRuntime
+	client  *http.Client
+	log     zerolog.Logger
 }
 
-func NewDockerService() *DockerService {
-	return &DockerService{
-		log: gologger.Get().With().Str("component", "docker").Logger(),
+// NewDockerService returns a DockerService that reads images from runtime
+// and signs its runner uploads with signer, sending them over transport, or
+// http.DefaultTransport when it is nil. A nil signer sends unsigned
+// requests.
+func NewDockerService(runtime ContainerRuntime, signer *requestsig.Signer, transport http.RoundTripper) (*DockerService, error) {
+	if runtime == nil {
+		return nil, errors.New("a container runtime is required")
+	}
+
+	client := &http.Client{Transport: transport}
+	if signer != nil {
+		client.Transport = requestsig.NewTransport(signer, transport)
 	}
+
+	return &DockerService{
+		runtime: runtime,
+		client:  client,
+		log:     gologger.Get().With().Str("component", "docker").Str("runtime", runtime.Name()).Logger(),
+	}, nil
 }
 
-func (s *DockerService) SaveImage(imageName string) (string, error) {
+// ProgressFunc is called as image bytes are sent to the runner with the
+// running total written so far.
+type ProgressFunc func(bytesSent int64)
+
+// SaveImage exports imageName from the container runtime as a tar stream.
+// Reading to EOF surfaces any failure part way through, and closing the
+// stream early aborts the export.
+func (s *DockerService) SaveImage(ctx context.Context, imageName string) (io.ReadCloser, error) {
 	s.log.Info().
 		Str("image", imageName).
 		Msg("Starting Docker image save operation")
 
-	tmpDir, err := os.MkdirTemp("", "docker-images")
+	started := time.Now()
+	stream, err := s.runtime.SaveImage(ctx, imageName)
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp directory: %v", err)
-	}
-
-	s.log.Debug().
-		Str("tmpDir", tmpDir).
-		Msg("Created temporary directory for Docker image")
-
-	tarFileName := filepath.Join(tmpDir, strings.ReplaceAll(imageName, "/", "_")+".tar")
-	s.log.Debug().
-		Str("tarFile", tarFileName).
-		Msg("Generated tar filename")
-
-	if err := s.saveImageToTar(imageName, tarFileName); err != nil {
-		if removeErr := os.RemoveAll(tmpDir); removeErr != nil {
-			s.log.Error().Err(removeErr).Str("tmpDir", tmpDir).Msg("Failed to clean up temporary directory")
-		}
-		return "", err
+		metrics.DockerOperationDuration.Observe(time.Since(started).Seconds(), "save", metrics.Result(err))
+		return nil, err
 	}
 
-	fileInfo, err := os.Stat(tarFileName)
-	if err == nil {
-		s.log.Info().
-			Str("image", imageName).
-			Str("tarFile", tarFileName).
-			Int64("sizeBytes", fileInfo.Size()).
-			Msg("Successfully saved Docker image to tar file")
-	}
-
-	return tarFileName, nil
+	return &imageStream{ReadCloser: stream, started: started}, nil
 }
 
-func (s *DockerService) UploadImage(tarFile string, taskData map[string]interface{}, serverURL string) error {
-	// Compute image hash before uploading
-	if imageName, ok := taskData["image"].(string); ok {
-		imageHash, err := utils.ComputeImageHash(imageName)
-		if err != nil {
-			s.log.Error().Err(err).Str("image", imageName).Msg("Failed to compute image hash")
-			return fmt.Errorf("failed to compute image hash: %w", err)
-		}
-		taskData["image_hash"] = imageHash
-		s.log.Info().Str("image", imageName).Str("hash", imageHash).Msg("Computed image hash")
-	}
-
-	// Compute command hash if command exists
-	if command, ok := taskData["command"].([]string); ok {
-		commandHash := utils.ComputeCommandHash(command)
-		taskData["command_hash"] = commandHash
-		s.log.Info().Strs("command", command).Str("hash", commandHash).Msg("Computed command hash")
-	}
-
+// UploadImage streams the image tar from image to the runner as a multipart
+// request while hashing it in the same pass, so memory use stays bounded
+// regardless of image size. The image part is written before the task part
+// because image_hash, the config digest described in pkg/imagehash, is only
+// known once the whole tar has been read. When taskData already carries an
+// image_hash that does not match, the upload is aborted before the task part
+// is sent. It
+// returns the task ID assigned by the runner, if the runner reported one.
+// The request carries the X-Request-ID from ctx, and cancelling ctx aborts
+// the upload.
+func (s *DockerService) UploadImage(ctx context.Context, image io.Reader, taskData map[string]interface{}, serverURL string, progress ProgressFunc) (taskID string, err error) {
+	imageName, _ := taskData["image"].(string)
+	logger := requestid.Logger(ctx, s.log)
+
+	started := time.Now()
+	counter := &progressWriter{progress: progress}
 	defer func() {
-		s.log.Debug().
-			Str("tarFile", tarFile).
-			Msg("Cleaning up temporary tar file")
-		if err := os.Remove(tarFile); err != nil {
-			s.log.Error().Err(err).Str("tarFile", tarFile).Msg("Failed to clean up temporary tar file")
+		metrics.DockerOperationDuration.Observe(time.Since(started).Seconds(), "upload", metrics.Result(err))
+		if err == nil {
+			metrics.DockerImageBytes.Observe(float64(counter.written), "upload")
 		}
 	}()
 
-	imageData, err := os.ReadFile(tarFile)
-	if err != nil {
-		return fmt.Errorf("failed to read Docker image tar: %v", err)
-	}
-
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	jsonPart, err := writer.CreateFormField("task")
-	if err != nil {
-		return fmt.Errorf("failed to create form field: %v", err)
-	}
-
-	if err := json.NewEncoder(jsonPart).Encode(taskData); err != nil {
-		return fmt.Errorf("failed to encode task request: %v", err)
-	}
-
-	imagePart, err := writer.CreateFormFile("image", filepath.Base(tarFile))
-	if err != nil {
-		return fmt.Errorf("failed to create form file: %v", err)
-	}
-
-	s.log.Debug().
-		Str("imageSize", fmt.Sprintf("%d bytes", len(imageData))).
-		Msg("Writing image data to request")
+	addCommandHash(logger, taskData)
 
-	if _, err := imagePart.Write(imageData); err != nil {
-		return fmt.Errorf("failed to write image data: %v", err)
-	}
-
-	if err := writer.Close(); err != nil {
-		return fmt.Errorf("failed to close writer: %v", err)
-	}
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
 
-	s.log.Debug().
-		Str("contentType", writer.FormDataContentType()).
-		Int("bodySize", body.Len()).
-		Msg("Prepared multipart request")
+	done := make(chan error, 1)
+	go func() {
+		err := writeImageMultipart(logger, writer, image, imageName, taskData, counter)
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+		done <- err
+	}()
 
-	req, err := http.NewRequest("POST", serverURL, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", serverURL, pr)
 	if err != nil {
-		return fmt.Errorf("failed to create server request: %v", err)
+		pr.CloseWithError(err)
+		<-done
+		return "", fmt.Errorf("failed to create server request: %v", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
 
 	deviceID, ok := taskData["device_id"].(string)
 	if ok {
@@ -148,10 +130,23 @@ func (s *DockerService) UploadImage(tarFile string, taskData map[string]interfac
 		req.Header.Set("X-Creator-Address", creatorAddr)
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	logger.Debug().
+		Str("contentType", writer.FormDataContentType()).
+		Str("image", imageName).
+		Msg("Streaming multipart request")
+
+	resp, err := s.client.Do(req)
+
+	// Unblock the writer if the request stopped reading early, then wait
+	// for it so taskData is no longer being mutated.
+	pr.CloseWithError(io.ErrClosedPipe)
+	writeErr := <-done
+
 	if err != nil {
-		return fmt.Errorf("failed to send request to server: %v", err)
+		if writeErr != nil && !errors.Is(writeErr, io.ErrClosedPipe) {
+			return "", fmt.Errorf("failed to stream image to server: %v", writeErr)
+		}
+		return "", fmt.Errorf("failed to send request to server: %v", err)
 	}
 	defer func() {
 		if closeErr := resp.Body.Close(); closeErr != nil {
@@ -162,102 +157,157 @@ func (s *DockerService) UploadImage(tarFile string, taskData map[string]interfac
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		respBody, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return fmt.Errorf("failed to read error response from server: %v", err)
+			return "", fmt.Errorf("failed to read error response from server: %v", err)
 		}
-		return fmt.Errorf("server returned error: status=%d, response=%s", resp.StatusCode, string(respBody))
+		return "", &RunnerError{StatusCode: resp.StatusCode, Body: string(respBody)}
 	}
 
-	return nil
+	if writeErr != nil {
+		return "", fmt.Errorf("failed to stream image to server: %v", writeErr)
+	}
+
+	return readTaskID(resp.Body), nil
 }
 
-func (s *DockerService) saveImageToTar(imageName, tarFileName string) error {
-	s.log.Info().
+// addCommandHash sets command_hash in taskData when it has a command,
+// covering its resource limits as well.
+func addCommandHash(logger *zerolog.Logger, taskData map[string]interface{}) {
+	if command, ok := taskData["command"].([]string); ok {
+		var resources string
+		if limits, ok := taskData["resources"].(ResourceConfig); ok {
+			resources = limits.Canonical()
+		}
+		commandHash := utils.ComputeCommandHash(command, resources)
+		taskData["command_hash"] = commandHash
+		logger.Info().Strs("command", command).Str("resources", resources).Str("hash", commandHash).Msg("Computed command hash")
+	}
+}
+
+func writeImageMultipart(logger *zerolog.Logger, writer *multipart.Writer, image io.Reader, imageName string, taskData map[string]interface{}, counter *progressWriter) error {
+	imagePart, err := writer.CreateFormFile("image", strings.ReplaceAll(imageName, "/", "_")+".tar")
+	if err != nil {
+		return fmt.Errorf("failed to create form file: %v", err)
+	}
+
+	hasher := imagehash.NewHasher()
+	written, err := io.Copy(io.MultiWriter(imagePart, hasher, counter), image)
+	imageHash, hashErr := hasher.Sum()
+	if err != nil {
+		return fmt.Errorf("failed to write image data: %v", err)
+	}
+	if hashErr != nil {
+		return fmt.Errorf("failed to hash image: %w", hashErr)
+	}
+
+	// A caller-supplied image_hash must name the image actually sent.
+	if expected, _ := taskData["image_hash"].(string); expected != "" && !imageHash.Matches(expected) {
+		return fmt.Errorf("%w: expected %s, got %s", imagehash.ErrMismatch, expected, imageHash)
+	}
+
+	taskData["image_hash"] = imageHash.String()
+	taskData["image_layers"] = imageHash.Layers
+	logger.Info().
 		Str("image", imageName).
-		Str("tarFile", tarFileName).
-		Msg("Saving Docker image to tar file")
+		Str("hash", imageHash.String()).
+		Int("layers", len(imageHash.Layers)).
+		Int64("sizeBytes", written).
+		Msg("Computed image hash")
 
-	cmd := exec.Command("docker", "save", "-o", tarFileName, imageName)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
+	jsonPart, err := writer.CreateFormField("task")
+	if err != nil {
+		return fmt.Errorf("failed to create form field: %v", err)
+	}
 
-	if err := cmd.Run(); err != nil {
-		s.log.Error().
-			Err(err).
-			Str("image", imageName).
-			Str("stderr", stderr.String()).
-			Msg("Failed to save Docker image")
-		return fmt.Errorf("failed to save docker image: %v, stderr: %s", err, stderr.String())
+	if err := json.NewEncoder(jsonPart).Encode(taskData); err != nil {
+		return fmt.Errorf("failed to encode task request: %v", err)
 	}
 
 	return nil
 }
 
-func (s *DockerService) EnsureImageExists(imageName string) error {
+// EnsureImageExists pulls imageName unless the container runtime already has
+// it, logging pull progress as layers complete.
+func (s *DockerService) EnsureImageExists(ctx context.Context, imageName string) error {
 	s.log.Info().
 		Str("image", imageName).
 		Msg("Checking if Docker image exists locally")
 
-	cmd := exec.Command("docker", "image", "inspect", imageName)
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
+	_, err := s.runtime.InspectImage(ctx, imageName)
+	if err == nil {
 		s.log.Info().
 			Str("image", imageName).
-			Msg("Docker image not found locally, pulling from registry")
+			Msg("Docker image already exists locally")
+		return nil
+	}
+	if !errors.Is(err, ErrImageNotFound) {
+		return err
+	}
 
-		pullCmd := exec.Command("docker", "pull", imageName)
-		var pullStderr bytes.Buffer
-		pullCmd.Stderr = &pullStderr
+	s.log.Info().
+		Str("image", imageName).
+		Msg("Docker image not found locally, pulling from registry")
 
-		if err := pullCmd.Run(); err != nil {
-			s.log.Error().
-				Err(err).
+	started := time.Now()
+	err = s.runtime.PullImage(ctx, imageName, func(p PullProgress) {
+		if p.Layer != "" && p.Status == "Pull complete" {
+			s.log.Debug().
 				Str("image", imageName).
-				Str("stderr", pullStderr.String()).
-				Msg("Failed to pull Docker image")
-			return fmt.Errorf("failed to pull Docker image: %v, stderr: %s", err, pullStderr.String())
+				Str("layer", p.Layer).
+				Msg("Pulled image layer")
 		}
-
-		s.log.Info().
-			Str("image", imageName).
-			Msg("Successfully pulled Docker image")
-	} else {
-		s.log.Info().
+	})
+	metrics.DockerOperationDuration.Observe(time.Since(started).Seconds(), "pull", metrics.Result(err))
+	if err != nil {
+		s.log.Error().
+			Err(err).
 			Str("image", imageName).
-			Msg("Docker image already exists locally")
+			Msg("Failed to pull Docker image")
+		return err
 	}
 
+	s.log.Info().
+		Str("image", imageName).
+		Msg("Successfully pulled Docker image")
 	return nil
 }
 
-func (s *DockerService) UploadTask(taskData map[string]interface{}, serverURL string) error {
+// UploadTask submits a task without an image and returns the task ID assigned
+// by the runner, if the runner reported one. Tasks that refer to an image the
+// runner already has carry its image_digest instead. The request carries the
+// X-Request-ID from ctx.
+func (s *DockerService) UploadTask(ctx context.Context, taskData map[string]interface{}, serverURL string) (string, error) {
+	logger := requestid.Logger(ctx, s.log)
+	addCommandHash(logger, taskData)
+
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 
 	jsonPart, err := writer.CreateFormField("task")
 	if err != nil {
-		return fmt.Errorf("failed to create form field: %v", err)
+		return "", fmt.Errorf("failed to create form field: %v", err)
 	}
 
 	if err := json.NewEncoder(jsonPart).Encode(taskData); err != nil {
-		return fmt.Errorf("failed to encode task request: %v", err)
+		return "", fmt.Errorf("failed to encode task request: %v", err)
 	}
 
 	if err := writer.Close(); err != nil {
-		return fmt.Errorf("failed to close writer: %v", err)
+		return "", fmt.Errorf("failed to close writer: %v", err)
 	}
 
-	s.log.Debug().
+	logger.Debug().
 		Str("contentType", writer.FormDataContentType()).
 		Int("bodySize", body.Len()).
 		Msg("Prepared task request")
 
-	req, err := http.NewRequest("POST", serverURL, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", serverURL, body)
 	if err != nil {
-		return fmt.Errorf("failed to create server request: %v", err)
+		return "", fmt.Errorf("failed to create server request: %v", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
 
 	deviceID, ok := taskData["device_id"].(string)
 	if ok {
@@ -268,10 +318,9 @@ func (s *DockerService) UploadTask(taskData map[string]interface{}, serverURL st
 		req.Header.Set("X-Creator-Address", creatorAddr)
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request to server: %v", err)
+		return "", fmt.Errorf("failed to send request to server: %v", err)
 	}
 	defer func() {
 		if closeErr := resp.Body.Close(); closeErr != nil {
@@ -282,10 +331,92 @@ func (s *DockerService) UploadTask(taskData map[string]interface{}, serverURL st
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
 		respBody, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return fmt.Errorf("failed to read error response from server: %v", err)
+			return "", fmt.Errorf("failed to read error response from server: %v", err)
 		}
-		return fmt.Errorf("server returned error: status=%d, response=%s", resp.StatusCode, string(respBody))
+		return "", &RunnerError{StatusCode: resp.StatusCode, Body: string(respBody)}
 	}
 
-	return nil
+	return readTaskID(resp.Body), nil
+}
+
+// InspectImage returns details of the local image imageName.
+func (s *DockerService) InspectImage(ctx context.Context, imageName string) (*ImageInfo, error) {
+	return s.runtime.InspectImage(ctx, imageName)
+}
+
+// ImageDigest returns the content-addressed ID of a local image, which is
+// the same wherever the image is pulled or loaded.
+func (s *DockerService) ImageDigest(ctx context.Context, imageName string) (string, error) {
+	info, err := s.runtime.InspectImage(ctx, imageName)
+	if err != nil {
+		return "", err
+	}
+	if info.ID == "" {
+		return "", fmt.Errorf("%s reported no ID for image %s", s.runtime.Name(), imageName)
+	}
+	return info.ID, nil
+}
+
+// RunnerHasImage asks the runner at baseURL whether it already stores the
+// image with digest. A runner that does not know the endpoint answers 404,
+// which is treated the same as not having the image.
+func (s *DockerService) RunnerHasImage(ctx context.Context, baseURL, digest string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, baseURL+"/api/v1/images/"+url.PathEscape(digest), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create image lookup request: %v", err)
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up image on runner: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, &RunnerError{StatusCode: resp.StatusCode}
+	}
+}
+
+// RunnerError is a non-success response from the runner.
+type RunnerError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *RunnerError) Error() string {
+	return fmt.Sprintf("server returned error: status=%d, response=%s", e.StatusCode, e.Body)
+}
+
+// readTaskID extracts the runner-assigned task ID from a task submission
+// response. Runners reply with either {"id": ...} or {"task_id": ...},
+// optionally wrapped in a "task" object; an unrecognised body yields "".
+func readTaskID(body io.Reader) string {
+	var payload struct {
+		ID     string `json:"id"`
+		TaskID string `json:"task_id"`
+		Task   *struct {
+			ID string `json:"id"`
+		} `json:"task"`
+	}
+	if err := json.NewDecoder(io.LimitReader(body, 1<<20)).Decode(&payload); err != nil {
+		return ""
+	}
+
+	switch {
+	case payload.ID != "":
+		return payload.ID
+	case payload.TaskID != "":
+		return payload.TaskID
+	case payload.Task != nil:
+		return payload.Task.ID
+	}
+	return ""
 }
@@ -0,0 +1,396 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/parity-client/pkg/imagehash"
+	"github.com/theblitlabs/parity-client/pkg/requestsig"
+)
+
+// testRunner is a runner server that verifies request signatures and
+// records the tasks and images submitted to it.
+type testRunner struct {
+	*httptest.Server
+	signer *requestsig.Signer
+
+	mu     sync.Mutex
+	tasks  []map[string]interface{}
+	images [][]byte
+	errs   []error
+}
+
+func newTestRunner(t *testing.T) *testRunner {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &testRunner{signer: requestsig.NewSigner(key)}
+	verifier := requestsig.NewVerifier(0)
+
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			r.fail(w, err)
+			return
+		}
+		if addr, err := verifier.Verify(req, requestsig.HashBytes(body)); err != nil || addr != r.signer.Address() {
+			r.fail(w, errors.New("request not signed by the proxy wallet"))
+			return
+		}
+
+		switch {
+		case req.Method == http.MethodHead && strings.HasPrefix(req.URL.Path, "/api/v1/images/"):
+			w.WriteHeader(http.StatusNotFound)
+		case req.Method == http.MethodPost && req.URL.Path == "/api/v1/tasks":
+			r.submit(w, req, body)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *testRunner) submit(w http.ResponseWriter, req *http.Request, body []byte) {
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		r.fail(w, err)
+		return
+	}
+
+	var task map[string]interface{}
+	var image []byte
+	mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			r.fail(w, err)
+			return
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			r.fail(w, err)
+			return
+		}
+		switch part.FormName() {
+		case "task":
+			if err := json.Unmarshal(data, &task); err != nil {
+				r.fail(w, err)
+				return
+			}
+		case "image":
+			image = data
+		}
+	}
+	if task == nil {
+		r.fail(w, errors.New("no task part"))
+		return
+	}
+
+	r.mu.Lock()
+	r.tasks = append(r.tasks, task)
+	if image != nil {
+		r.images = append(r.images, image)
+	}
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write([]byte(`{"id":"task-1"}`))
+}
+
+func (r *testRunner) fail(w http.ResponseWriter, err error) {
+	r.mu.Lock()
+	r.errs = append(r.errs, err)
+	r.mu.Unlock()
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+func (r *testRunner) received() ([]map[string]interface{}, [][]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tasks, r.images
+}
+
+// fakeImage returns the saved archive of an image built by a FakeRuntime
+// from contents.
+func fakeImage(t *testing.T, image, contents string) []byte {
+	t.Helper()
+	rt := NewFakeRuntime()
+	ctx := context.Background()
+	if err := rt.BuildImage(ctx, BuildOptions{Tag: image}, strings.NewReader(contents), nil); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := rt.SaveImage(ctx, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func newTestService(t *testing.T, rt ContainerRuntime, runner *testRunner) *DockerService {
+	t.Helper()
+	s, err := NewDockerService(rt, runner.signer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestNewDockerServiceRequiresRuntime(t *testing.T) {
+	if _, err := NewDockerService(nil, nil, nil); err == nil {
+		t.Fatal("NewDockerService accepted a nil runtime")
+	}
+}
+
+func TestEnsureImageExists(t *testing.T) {
+	runner := newTestRunner(t)
+	rt := NewFakeRuntime()
+	rt.AddImage("local:1", fakeImage(t, "local:1", "local"))
+	rt.AddRemoteImage("remote:1", fakeImage(t, "remote:1", "remote"))
+	s := newTestService(t, rt, runner)
+	ctx := context.Background()
+
+	if err := s.EnsureImageExists(ctx, "local:1"); err != nil {
+		t.Fatalf("EnsureImageExists for a local image: %v", err)
+	}
+	if pulls := rt.Pulls(); len(pulls) != 0 {
+		t.Errorf("local image was pulled: %v", pulls)
+	}
+
+	if err := s.EnsureImageExists(ctx, "remote:1"); err != nil {
+		t.Fatalf("EnsureImageExists for a remote image: %v", err)
+	}
+	if pulls := rt.Pulls(); len(pulls) != 1 || pulls[0] != "remote:1" {
+		t.Errorf("Pulls = %v, want [remote:1]", pulls)
+	}
+	if _, err := rt.InspectImage(ctx, "remote:1"); err != nil {
+		t.Errorf("pulled image is not local: %v", err)
+	}
+
+	if err := s.EnsureImageExists(ctx, "missing:1"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("EnsureImageExists for a missing image: error = %v, want %v", err, ErrImageNotFound)
+	}
+}
+
+func TestUploadImage(t *testing.T) {
+	runner := newTestRunner(t)
+	archive := fakeImage(t, "app:1", "app contents")
+	rt := NewFakeRuntime()
+	rt.AddImage("app:1", archive)
+	s := newTestService(t, rt, runner)
+	ctx := context.Background()
+
+	want, err := imagehash.Compute(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := s.ImageDigest(ctx, "app:1")
+	if err != nil || digest != want.Config {
+		t.Fatalf("ImageDigest = %s, %v; want %s", digest, err, want.Config)
+	}
+
+	image, err := s.SaveImage(ctx, "app:1")
+	if err != nil {
+		t.Fatalf("SaveImage: %v", err)
+	}
+	defer image.Close()
+
+	var sent int64
+	taskData := map[string]interface{}{"title": "t", "image": "app:1", "command": []string{"run"}}
+	taskID, err := s.UploadImage(ctx, image, taskData, runner.URL+"/api/v1/tasks", func(n int64) { sent = n })
+	if err != nil {
+		t.Fatalf("UploadImage: %v", err)
+	}
+	if taskID != "task-1" {
+		t.Errorf("task ID = %q, want task-1", taskID)
+	}
+	if sent != int64(len(archive)) {
+		t.Errorf("progress reported %d bytes, want %d", sent, len(archive))
+	}
+
+	tasks, images := runner.received()
+	if len(tasks) != 1 || len(images) != 1 {
+		t.Fatalf("runner received %d tasks and %d images, want 1 and 1", len(tasks), len(images))
+	}
+	if !bytes.Equal(images[0], archive) {
+		t.Error("runner received a different image")
+	}
+	if tasks[0]["image_hash"] != want.Config {
+		t.Errorf("image_hash = %v, want %s", tasks[0]["image_hash"], want.Config)
+	}
+	if tasks[0]["command_hash"] == nil {
+		t.Error("task has no command_hash")
+	}
+}
+
+func TestUploadImageRejectsWrongImageHash(t *testing.T) {
+	runner := newTestRunner(t)
+	rt := NewFakeRuntime()
+	rt.AddImage("app:1", fakeImage(t, "app:1", "app contents"))
+	s := newTestService(t, rt, runner)
+	ctx := context.Background()
+
+	image, err := s.SaveImage(ctx, "app:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer image.Close()
+
+	taskData := map[string]interface{}{"title": "t", "image": "app:1", "image_hash": "sha256:" + strings.Repeat("0", 64)}
+	if _, err := s.UploadImage(ctx, image, taskData, runner.URL+"/api/v1/tasks", nil); err == nil {
+		t.Fatal("UploadImage succeeded with a wrong image_hash")
+	}
+	if tasks, _ := runner.received(); len(tasks) != 0 {
+		t.Errorf("runner received %d tasks, want none", len(tasks))
+	}
+}
+
+var errSaveBroken = errors.New("save broke off")
+
+// brokenSave is a FakeRuntime whose saved images break off after limit
+// bytes, as when the container engine fails part way through an export.
+type brokenSave struct {
+	*FakeRuntime
+	limit int64
+}
+
+func (b brokenSave) SaveImage(ctx context.Context, image string) (io.ReadCloser, error) {
+	rc, err := b.FakeRuntime.SaveImage(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(io.LimitReader(rc, b.limit), &errReader{errSaveBroken}), rc}, nil
+}
+
+type errReader struct{ err error }
+
+func (r *errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestUploadImageSaveFailsMidStream(t *testing.T) {
+	runner := newTestRunner(t)
+	rt := brokenSave{FakeRuntime: NewFakeRuntime(), limit: 512}
+	rt.AddImage("app:1", fakeImage(t, "app:1", strings.Repeat("x", 4096)))
+	s := newTestService(t, rt, runner)
+	ctx := context.Background()
+
+	image, err := s.SaveImage(ctx, "app:1")
+	if err != nil {
+		t.Fatalf("SaveImage: %v", err)
+	}
+	defer image.Close()
+
+	taskData := map[string]interface{}{"title": "t", "image": "app:1"}
+	_, err = s.UploadImage(ctx, image, taskData, runner.URL+"/api/v1/tasks", nil)
+	if err == nil {
+		t.Fatal("UploadImage succeeded although the save failed")
+	}
+	if !strings.Contains(err.Error(), errSaveBroken.Error()) {
+		t.Errorf("UploadImage error = %v, want it to report %v", err, errSaveBroken)
+	}
+	if tasks, _ := runner.received(); len(tasks) != 0 {
+		t.Errorf("runner accepted %d tasks from a broken upload", len(tasks))
+	}
+	if _, ok := taskData["image_hash"]; ok {
+		t.Error("image_hash was set for a broken upload")
+	}
+}
+
+func TestUploadTask(t *testing.T) {
+	runner := newTestRunner(t)
+	s := newTestService(t, NewFakeRuntime(), runner)
+
+	taskData := map[string]interface{}{"title": "t", "image_digest": "sha256:abc", "device_id": "dev"}
+	taskID, err := s.UploadTask(context.Background(), taskData, runner.URL+"/api/v1/tasks")
+	if err != nil {
+		t.Fatalf("UploadTask: %v", err)
+	}
+	if taskID != "task-1" {
+		t.Errorf("task ID = %q, want task-1", taskID)
+	}
+
+	tasks, images := runner.received()
+	if len(tasks) != 1 || len(images) != 0 {
+		t.Fatalf("runner received %d tasks and %d images, want 1 and 0", len(tasks), len(images))
+	}
+	if tasks[0]["image_digest"] != "sha256:abc" {
+		t.Errorf("image_digest = %v, want sha256:abc", tasks[0]["image_digest"])
+	}
+}
+
+func TestRunnerHasImage(t *testing.T) {
+	runner := newTestRunner(t)
+	s := newTestService(t, NewFakeRuntime(), runner)
+
+	has, err := s.RunnerHasImage(context.Background(), runner.URL, "sha256:abc")
+	if err != nil || has {
+		t.Fatalf("RunnerHasImage = %v, %v; want false, nil", has, err)
+	}
+}
+
+func TestBuildImage(t *testing.T) {
+	runner := newTestRunner(t)
+	rt := NewFakeRuntime()
+	s := newTestService(t, rt, runner)
+	ctx := context.Background()
+
+	buildContext, err := NewBuildContextFromArchive(bytes.NewReader(fakeImage(t, "ctx", "sources")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buildContext.Close()
+
+	opts := BuildOptions{Dockerfile: "Dockerfile", Args: map[string]string{"VERSION": "1"}}
+	opts.Tag = BuildTag(buildContext, opts)
+	if !strings.HasPrefix(opts.Tag, BuildRepository+":") {
+		t.Fatalf("BuildTag = %s, want it in %s", opts.Tag, BuildRepository)
+	}
+	other := opts
+	other.Args = map[string]string{"VERSION": "2"}
+	if BuildTag(buildContext, other) == opts.Tag {
+		t.Error("different build args give the same tag")
+	}
+
+	var lines []string
+	if err := s.BuildImage(ctx, opts, buildContext, func(line string) { lines = append(lines, line) }); err != nil {
+		t.Fatalf("BuildImage: %v", err)
+	}
+	if len(rt.Builds()) != 1 || len(lines) == 0 {
+		t.Fatalf("builds = %d, log lines = %d; want 1 build with output", len(rt.Builds()), len(lines))
+	}
+	if _, err := s.ImageDigest(ctx, opts.Tag); err != nil {
+		t.Errorf("built image has no digest: %v", err)
+	}
+
+	// The same sources reuse the image instead of building again.
+	if err := s.BuildImage(ctx, opts, buildContext, nil); err != nil {
+		t.Fatalf("second BuildImage: %v", err)
+	}
+	if len(rt.Builds()) != 1 {
+		t.Errorf("builds = %d after rebuilding the same sources, want 1", len(rt.Builds()))
+	}
+}
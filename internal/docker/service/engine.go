@@ -0,0 +1,448 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	defaultDockerHost = "unix:///var/run/docker.sock"
+	dockerHubAuthKey  = "https://index.docker.io/v1/"
+)
+
+// EngineRuntime talks to the Docker Engine API, by default over the local
+// Unix socket. Requests use the unversioned API paths so the daemon picks
+// its own current version.
+type EngineRuntime struct {
+	name    string
+	baseURL string
+	client  *http.Client
+}
+
+// NewEngineRuntime returns a runtime for the Docker Engine API at host, a
+// unix:// or tcp:// address as in DOCKER_HOST. An empty host uses
+// DOCKER_HOST from the environment, then the default Docker socket.
+func NewEngineRuntime(host string) (*EngineRuntime, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = defaultDockerHost
+	}
+	return newEngineRuntime("docker", host)
+}
+
+func newEngineRuntime(name, host string) (*EngineRuntime, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s host %q: %w", name, host, err)
+	}
+
+	// Image pulls and saves can take as long as they need; callers bound
+	// them with their context instead.
+	transport := &http.Transport{
+		MaxIdleConns:    4,
+		IdleConnTimeout: 90 * time.Second,
+	}
+	r := &EngineRuntime{name: name, client: &http.Client{Transport: transport}}
+
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		}
+		r.baseURL = "http://" + name
+	case "tcp", "http":
+		r.baseURL = "http://" + u.Host
+	default:
+		return nil, fmt.Errorf("unsupported %s host %q: expected unix:// or tcp://", name, host)
+	}
+
+	return r, nil
+}
+
+func (r *EngineRuntime) Name() string {
+	return r.name
+}
+
+func (r *EngineRuntime) Ping(ctx context.Context) error {
+	resp, err := r.do(ctx, http.MethodGet, "/_ping", nil, nil)
+	if err != nil {
+		return r.wrapErr("ping", "", err)
+	}
+	defer resp.Body.Close()
+	return r.checkStatus(resp, "ping", "")
+}
+
+func (r *EngineRuntime) InspectImage(ctx context.Context, image string) (*ImageInfo, error) {
+	resp, err := r.do(ctx, http.MethodGet, "/images/"+image+"/json", nil, nil)
+	if err != nil {
+		return nil, r.wrapErr("inspect", image, err)
+	}
+	defer resp.Body.Close()
+
+	if err := r.checkStatus(resp, "inspect", image); err != nil {
+		return nil, err
+	}
+
+	var payload struct {
+		ID           string   `json:"Id"`
+		RepoTags     []string `json:"RepoTags"`
+		RepoDigests  []string `json:"RepoDigests"`
+		Size         int64    `json:"Size"`
+		Created      string   `json:"Created"`
+		OS           string   `json:"Os"`
+		Architecture string   `json:"Architecture"`
+		Config       struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, r.wrapErr("inspect", image, fmt.Errorf("failed to decode response: %w", err))
+	}
+
+	created, _ := time.Parse(time.RFC3339Nano, payload.Created)
+	return &ImageInfo{
+		ID:           payload.ID,
+		RepoTags:     payload.RepoTags,
+		RepoDigests:  payload.RepoDigests,
+		Size:         payload.Size,
+		Created:      created,
+		OS:           payload.OS,
+		Architecture: payload.Architecture,
+		Labels:       payload.Config.Labels,
+	}, nil
+}
+
+func (r *EngineRuntime) PullImage(ctx context.Context, image string, progress PullProgressFunc) error {
+	repo, tag := splitReference(image)
+	query := url.Values{"fromImage": {repo}}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+
+	header := http.Header{}
+	if auth := registryAuth(repo); auth != "" {
+		header.Set("X-Registry-Auth", auth)
+	}
+
+	resp, err := r.do(ctx, http.MethodPost, "/images/create?"+query.Encode(), header, nil)
+	if err != nil {
+		return r.wrapErr("pull", image, err)
+	}
+	defer resp.Body.Close()
+
+	if err := r.checkStatus(resp, "pull", image); err != nil {
+		return err
+	}
+
+	// The daemon answers 200 straight away and reports failures, including
+	// unknown images, as messages in the progress stream.
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			ID             string `json:"id"`
+			Status         string `json:"status"`
+			ProgressDetail struct {
+				Current int64 `json:"current"`
+				Total   int64 `json:"total"`
+			} `json:"progressDetail"`
+			Error       string `json:"error"`
+			ErrorDetail struct {
+				Message string `json:"message"`
+			} `json:"errorDetail"`
+		}
+		if err := decoder.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return r.wrapErr("pull", image, fmt.Errorf("failed to read progress: %w", err))
+		}
+
+		if msg.Error != "" || msg.ErrorDetail.Message != "" {
+			message := msg.ErrorDetail.Message
+			if message == "" {
+				message = msg.Error
+			}
+			status := 0
+			if isNotFoundMessage(message) {
+				status = http.StatusNotFound
+			}
+			return &RuntimeError{Runtime: r.name, Op: "pull", Image: image, StatusCode: status, Message: message}
+		}
+
+		if progress != nil {
+			progress(PullProgress{
+				Layer:   msg.ID,
+				Status:  msg.Status,
+				Current: msg.ProgressDetail.Current,
+				Total:   msg.ProgressDetail.Total,
+			})
+		}
+	}
+}
+
+func (r *EngineRuntime) SaveImage(ctx context.Context, image string) (io.ReadCloser, error) {
+	resp, err := r.do(ctx, http.MethodGet, "/images/"+image+"/get", nil, nil)
+	if err != nil {
+		return nil, r.wrapErr("save", image, err)
+	}
+
+	if err := r.checkStatus(resp, "save", image); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return &engineStream{body: resp.Body, runtime: r, image: image}, nil
+}
+
+func (r *EngineRuntime) BuildImage(ctx context.Context, opts BuildOptions, buildContext io.Reader, log BuildLogFunc) error {
+	query := url.Values{"t": {opts.Tag}, "rm": {"1"}, "forcerm": {"1"}}
+	if opts.Dockerfile != "" {
+		query.Set("dockerfile", opts.Dockerfile)
+	}
+	if opts.Target != "" {
+		query.Set("target", opts.Target)
+	}
+	if len(opts.Args) > 0 {
+		args, err := json.Marshal(opts.Args)
+		if err != nil {
+			return r.wrapErr("build", opts.Tag, err)
+		}
+		query.Set("buildargs", string(args))
+	}
+
+	header := http.Header{"Content-Type": {"application/x-tar"}}
+	if config := registryConfig(); config != "" {
+		header.Set("X-Registry-Config", config)
+	}
+
+	resp, err := r.do(ctx, http.MethodPost, "/build?"+query.Encode(), header, buildContext)
+	if err != nil {
+		return r.wrapErr("build", opts.Tag, err)
+	}
+	defer resp.Body.Close()
+
+	if err := r.checkStatus(resp, "build", opts.Tag); err != nil {
+		return err
+	}
+
+	// As with pulls, a failing build still answers 200 and reports the
+	// failure as the last message in the stream.
+	lines := newLineWriter(log)
+	defer lines.Flush()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Stream         string `json:"stream"`
+			Status         string `json:"status"`
+			ID             string `json:"id"`
+			ProgressDetail struct {
+				Total int64 `json:"total"`
+			} `json:"progressDetail"`
+			Error       string `json:"error"`
+			ErrorDetail struct {
+				Message string `json:"message"`
+			} `json:"errorDetail"`
+		}
+		if err := decoder.Decode(&msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return r.wrapErr("build", opts.Tag, fmt.Errorf("failed to read build output: %w", err))
+		}
+
+		if msg.Error != "" || msg.ErrorDetail.Message != "" {
+			message := msg.ErrorDetail.Message
+			if message == "" {
+				message = msg.Error
+			}
+			_, _ = lines.Write([]byte(message + "\n"))
+			return &RuntimeError{Runtime: r.name, Op: "build", Image: opts.Tag, Message: message}
+		}
+
+		// Base image pulls report byte counts too often to be worth keeping.
+		switch {
+		case msg.Stream != "":
+			_, _ = lines.Write([]byte(msg.Stream))
+		case msg.ProgressDetail.Total > 0:
+		case msg.Status != "" && msg.ID != "":
+			_, _ = lines.Write([]byte(msg.ID + ": " + msg.Status + "\n"))
+		case msg.Status != "":
+			_, _ = lines.Write([]byte(msg.Status + "\n"))
+		}
+	}
+}
+
+func (r *EngineRuntime) do(ctx context.Context, method, path string, header http.Header, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, r.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return r.client.Do(req)
+}
+
+// checkStatus turns a non-2xx response into a RuntimeError carrying the
+// daemon's error message.
+func (r *EngineRuntime) checkStatus(resp *http.Response, op, image string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	var payload struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err := json.Unmarshal(data, &payload); err != nil || payload.Message == "" {
+		payload.Message = strings.TrimSpace(string(data))
+	}
+
+	return &RuntimeError{
+		Runtime:    r.name,
+		Op:         op,
+		Image:      image,
+		StatusCode: resp.StatusCode,
+		Message:    payload.Message,
+	}
+}
+
+func (r *EngineRuntime) wrapErr(op, image string, err error) error {
+	return &RuntimeError{Runtime: r.name, Op: op, Image: image, Err: err}
+}
+
+// engineStream reports a save that is cut off mid-stream as a RuntimeError
+// rather than a bare connection error.
+type engineStream struct {
+	body    io.ReadCloser
+	runtime *EngineRuntime
+	image   string
+}
+
+func (s *engineStream) Read(p []byte) (int, error) {
+	n, err := s.body.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = s.runtime.wrapErr("save", s.image, err)
+	}
+	return n, err
+}
+
+func (s *engineStream) Close() error {
+	return s.body.Close()
+}
+
+// splitReference splits an image reference into the repository and the tag
+// or digest the Engine API expects as separate pull parameters.
+func splitReference(image string) (repo, tag string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i], image[i+1:]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, ""
+}
+
+// registryCredentials is one entry of the X-Registry-Auth and
+// X-Registry-Config headers.
+type registryCredentials struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	ServerAddress string `json:"serveraddress"`
+}
+
+// dockerCredentials returns the credentials `docker login` stored in
+// ~/.docker/config.json, keyed by registry as stored there. Credential
+// helpers are not consulted; images that need them must be pulled first.
+func dockerCredentials() map[string]registryCredentials {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return nil
+	}
+
+	var cfg struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil
+	}
+
+	creds := make(map[string]registryCredentials, len(cfg.Auths))
+	for key, entry := range cfg.Auths {
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			continue
+		}
+		username, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			continue
+		}
+		creds[key] = registryCredentials{Username: username, Password: password, ServerAddress: key}
+	}
+	return creds
+}
+
+// registryAuth returns the X-Registry-Auth header for repo.
+func registryAuth(repo string) string {
+	registry := dockerHubAuthKey
+	if first, _, ok := strings.Cut(repo, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		registry = first
+	}
+
+	for key, creds := range dockerCredentials() {
+		host := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://"), "/")
+		if key != registry && host != registry {
+			continue
+		}
+
+		payload, err := json.Marshal(creds)
+		if err != nil {
+			return ""
+		}
+		return base64.URLEncoding.EncodeToString(payload)
+	}
+
+	return ""
+}
+
+// registryConfig returns the X-Registry-Config header carrying every stored
+// credential, since a build may pull base images from several registries.
+func registryConfig() string {
+	creds := dockerCredentials()
+	if len(creds) == 0 {
+		return ""
+	}
+
+	payload, err := json.Marshal(creds)
+	if err != nil {
+		return ""
+	}
+	return base64.URLEncoding.EncodeToString(payload)
+}
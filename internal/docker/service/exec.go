@@ -0,0 +1,108 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// runCommand runs a runtime's CLI and returns its stdout. A failure becomes
+// a RuntimeError carrying stderr, which matches ErrImageNotFound when the
+// CLI reported a missing image.
+func runCommand(ctx context.Context, runtime, op, image, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, commandError(runtime, op, image, err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+// streamCommand starts a runtime's CLI and returns its stdout as a stream.
+// Reading to EOF surfaces a failed command, and closing the stream early
+// kills it.
+func streamCommand(ctx context.Context, runtime, op, image, name string, args ...string) (io.ReadCloser, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	stream := &commandStream{cmd: cmd, runtime: runtime, op: op, image: image}
+	cmd.Stderr = &stream.stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, &RuntimeError{Runtime: runtime, Op: op, Image: image, Err: err}
+	}
+	stream.stdout = stdout
+
+	if err := cmd.Start(); err != nil {
+		return nil, &RuntimeError{Runtime: runtime, Op: op, Image: image, Err: err}
+	}
+	return stream, nil
+}
+
+// commandStream is the stdout of a running CLI. A failed command is
+// reported in place of io.EOF so truncated output is never mistaken for
+// complete output.
+type commandStream struct {
+	cmd     *exec.Cmd
+	stdout  io.ReadCloser
+	stderr  bytes.Buffer
+	runtime string
+	op      string
+	image   string
+	once    sync.Once
+	waitErr error
+}
+
+func (s *commandStream) Read(p []byte) (int, error) {
+	n, err := s.stdout.Read(p)
+	if err == io.EOF {
+		if waitErr := s.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+func (s *commandStream) Close() error {
+	if s.cmd.ProcessState == nil && s.cmd.Process != nil {
+		_ = s.cmd.Process.Kill()
+	}
+	_ = s.wait()
+	return nil
+}
+
+func (s *commandStream) wait() error {
+	s.once.Do(func() {
+		if err := s.cmd.Wait(); err != nil {
+			s.waitErr = commandError(s.runtime, s.op, s.image, err, s.stderr.String())
+		}
+	})
+	return s.waitErr
+}
+
+func commandError(runtime, op, image string, err error, stderr string) error {
+	stderr = strings.TrimSpace(stderr)
+	rerr := &RuntimeError{Runtime: runtime, Op: op, Image: image, Message: stderr, Err: err}
+	if isNotFoundMessage(stderr) {
+		rerr.StatusCode = http.StatusNotFound
+	}
+	return rerr
+}
+
+// isNotFoundMessage recognises the ways runtimes and registries report a
+// missing image.
+func isNotFoundMessage(msg string) bool {
+	msg = strings.ToLower(msg)
+	for _, marker := range []string{"not found", "no such image", "image not known", "manifest unknown"} {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
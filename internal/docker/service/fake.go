@@ -0,0 +1,239 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/theblitlabs/parity-client/pkg/imagehash"
+)
+
+// FakeRuntime is an in-memory ContainerRuntime for exercising the task
+// pipeline without a container engine. Images added with AddImage are
+// local; those added with AddRemoteImage become local once pulled.
+type FakeRuntime struct {
+	mu     sync.Mutex
+	local  map[string][]byte
+	remote map[string][]byte
+	labels map[string]map[string]string
+	pulls  []string
+	builds []BuildOptions
+
+	// Err, when set, is returned by every operation.
+	Err error
+}
+
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		local:  make(map[string][]byte),
+		remote: make(map[string][]byte),
+		labels: make(map[string]map[string]string),
+	}
+}
+
+// AddImage makes image available locally with tar as its saved contents.
+func (f *FakeRuntime) AddImage(image string, tar []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.local[image] = tar
+}
+
+// AddRemoteImage makes image available to PullImage.
+func (f *FakeRuntime) AddRemoteImage(image string, tar []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.remote[image] = tar
+}
+
+// SetLabels sets the labels InspectImage reports for image.
+func (f *FakeRuntime) SetLabels(image string, labels map[string]string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.labels[image] = labels
+}
+
+// Pulls returns the images pulled so far, in order.
+func (f *FakeRuntime) Pulls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.pulls...)
+}
+
+// Builds returns the builds run so far, in order.
+func (f *FakeRuntime) Builds() []BuildOptions {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]BuildOptions(nil), f.builds...)
+}
+
+func (f *FakeRuntime) Name() string {
+	return "fake"
+}
+
+func (f *FakeRuntime) Ping(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.Err
+}
+
+func (f *FakeRuntime) InspectImage(ctx context.Context, image string) (*ImageInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	tar, ok := f.local[image]
+	if !ok {
+		return nil, f.notFound("inspect", image)
+	}
+
+	// Like Docker, report the config digest as the ID of valid archives.
+	id := fmt.Sprintf("sha256:%x", sha256.Sum256(tar))
+	if hash, err := imagehash.Compute(bytes.NewReader(tar)); err == nil {
+		id = hash.Config
+	}
+
+	return &ImageInfo{
+		ID:       id,
+		RepoTags: []string{image},
+		Size:     int64(len(tar)),
+		Created:  time.Unix(0, 0).UTC(),
+		Labels:   f.labels[image],
+	}, nil
+}
+
+func (f *FakeRuntime) PullImage(ctx context.Context, image string, progress PullProgressFunc) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tar, ok := f.remote[image]
+	if !ok {
+		return f.notFound("pull", image)
+	}
+
+	f.pulls = append(f.pulls, image)
+	f.local[image] = tar
+	if progress != nil {
+		size := int64(len(tar))
+		progress(PullProgress{Layer: image, Status: "Downloading", Current: 0, Total: size})
+		progress(PullProgress{Layer: image, Status: "Pull complete", Current: size, Total: size})
+	}
+	return nil
+}
+
+func (f *FakeRuntime) SaveImage(ctx context.Context, image string) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	tar, ok := f.local[image]
+	if !ok {
+		return nil, f.notFound("save", image)
+	}
+	return io.NopCloser(bytes.NewReader(tar)), nil
+}
+
+// BuildImage stores an image whose only layer is the build context, in the
+// archive format `docker save` produces.
+func (f *FakeRuntime) BuildImage(ctx context.Context, opts BuildOptions, buildContext io.Reader, log BuildLogFunc) error {
+	layer, err := io.ReadAll(buildContext)
+	if err != nil {
+		return &RuntimeError{Runtime: f.Name(), Op: "build", Image: opts.Tag, Err: err}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.Err != nil {
+		return f.Err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	archive, err := fakeArchive(opts, layer)
+	if err != nil {
+		return &RuntimeError{Runtime: f.Name(), Op: "build", Image: opts.Tag, Err: err}
+	}
+
+	f.builds = append(f.builds, opts)
+	f.local[opts.Tag] = archive
+	if log != nil {
+		log("Step 1/1 : COPY . /")
+		log("Successfully tagged " + opts.Tag)
+	}
+	return nil
+}
+
+func fakeArchive(opts BuildOptions, layer []byte) ([]byte, error) {
+	layerDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(layer))
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": "amd64",
+		"os":           "linux",
+		"config": map[string]interface{}{
+			"Labels": map[string]string{"dockerfile": opts.Dockerfile, "target": opts.Target},
+		},
+		"rootfs": map[string]interface{}{"type": "layers", "diff_ids": []string{layerDigest}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	configName := fmt.Sprintf("%x.json", sha256.Sum256(config))
+
+	manifest, err := json.Marshal([]map[string]interface{}{{
+		"Config":   configName,
+		"RepoTags": []string{opts.Tag},
+		"Layers":   []string{"layer/layer.tar"},
+	}})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{
+		{"layer/layer.tar", layer},
+		{configName, config},
+		{"manifest.json", manifest},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.data))}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *FakeRuntime) notFound(op, image string) error {
+	return &RuntimeError{
+		Runtime:    f.Name(),
+		Op:         op,
+		Image:      image,
+		StatusCode: http.StatusNotFound,
+		Message:    "no such image",
+	}
+}
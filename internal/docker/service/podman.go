@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NewPodmanRuntime returns a runtime for Podman's Docker-compatible API at
+// host, a unix:// address such as unix:///run/user/1000/podman/podman.sock.
+func NewPodmanRuntime(host string) (*EngineRuntime, error) {
+	return newEngineRuntime("podman", host)
+}
+
+// PodmanCLIRuntime drives the podman CLI, for machines where the Podman API
+// service is not running. Images are saved as docker-archive so the runner
+// receives the same format as from Docker.
+type PodmanCLIRuntime struct {
+	binary string
+}
+
+func NewPodmanCLIRuntime(binary string) *PodmanCLIRuntime {
+	if binary == "" {
+		binary = "podman"
+	}
+	return &PodmanCLIRuntime{binary: binary}
+}
+
+func (r *PodmanCLIRuntime) Name() string {
+	return "podman"
+}
+
+func (r *PodmanCLIRuntime) Ping(ctx context.Context) error {
+	_, err := runCommand(ctx, r.Name(), "ping", "", r.binary, "version", "--format", "{{.Client.Version}}")
+	return err
+}
+
+func (r *PodmanCLIRuntime) InspectImage(ctx context.Context, image string) (*ImageInfo, error) {
+	out, err := runCommand(ctx, r.Name(), "inspect", image, r.binary, "image", "inspect", image)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload []struct {
+		ID           string   `json:"Id"`
+		RepoTags     []string `json:"RepoTags"`
+		RepoDigests  []string `json:"RepoDigests"`
+		Size         int64    `json:"Size"`
+		Created      string   `json:"Created"`
+		OS           string   `json:"Os"`
+		Architecture string   `json:"Architecture"`
+		Config       struct {
+			Labels map[string]string `json:"Labels"`
+		} `json:"Config"`
+	}
+	if err := json.Unmarshal(out, &payload); err != nil || len(payload) == 0 {
+		return nil, &RuntimeError{Runtime: r.Name(), Op: "inspect", Image: image, Err: fmt.Errorf("unexpected podman output: %v", err)}
+	}
+
+	info := payload[0]
+	// podman prints the bare hex ID, without the algorithm prefix Docker
+	// reports and image hashes are compared against.
+	id := info.ID
+	if id != "" && !strings.HasPrefix(id, "sha256:") {
+		id = "sha256:" + id
+	}
+	created, _ := time.Parse(time.RFC3339Nano, info.Created)
+	return &ImageInfo{
+		ID:           id,
+		RepoTags:     info.RepoTags,
+		RepoDigests:  info.RepoDigests,
+		Size:         info.Size,
+		Created:      created,
+		OS:           info.OS,
+		Architecture: info.Architecture,
+		Labels:       info.Config.Labels,
+	}, nil
+}
+
+func (r *PodmanCLIRuntime) PullImage(ctx context.Context, image string, progress PullProgressFunc) error {
+	if _, err := runCommand(ctx, r.Name(), "pull", image, r.binary, "pull", "--quiet", image); err != nil {
+		return err
+	}
+	if progress != nil {
+		progress(PullProgress{Layer: image, Status: "Pull complete"})
+	}
+	return nil
+}
+
+func (r *PodmanCLIRuntime) SaveImage(ctx context.Context, image string) (io.ReadCloser, error) {
+	return streamCommand(ctx, r.Name(), "save", image, r.binary, "save", "--format", "docker-archive", image)
+}
+
+// BuildImage unpacks the build context into a temporary directory, since
+// podman build reads its context from a directory, and runs podman build
+// there. Build output goes to log from both stdout and stderr.
+func (r *PodmanCLIRuntime) BuildImage(ctx context.Context, opts BuildOptions, buildContext io.Reader, log BuildLogFunc) error {
+	dir, err := os.MkdirTemp("", "parity-build-*")
+	if err != nil {
+		return &RuntimeError{Runtime: r.Name(), Op: "build", Image: opts.Tag, Err: err}
+	}
+	defer os.RemoveAll(dir)
+
+	if err := extractContext(buildContext, dir); err != nil {
+		return &RuntimeError{Runtime: r.Name(), Op: "build", Image: opts.Tag, Err: err}
+	}
+
+	args := []string{"build", "--tag", opts.Tag}
+	if opts.Dockerfile != "" {
+		args = append(args, "--file", filepath.Join(dir, filepath.FromSlash(opts.Dockerfile)))
+	}
+	if opts.Target != "" {
+		args = append(args, "--target", opts.Target)
+	}
+	keys := make([]string, 0, len(opts.Args))
+	for key := range opts.Args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--build-arg", key+"="+opts.Args[key])
+	}
+	args = append(args, dir)
+
+	// The last line of output explains a failed build.
+	var last string
+	lines := newLineWriter(func(line string) {
+		if strings.TrimSpace(line) != "" {
+			last = line
+		}
+		if log != nil {
+			log(line)
+		}
+	})
+
+	cmd := exec.CommandContext(ctx, r.binary, args...)
+	cmd.Stdout = lines
+	cmd.Stderr = lines
+	err = cmd.Run()
+	lines.Flush()
+	if err != nil {
+		return &RuntimeError{Runtime: r.Name(), Op: "build", Image: opts.Tag, Message: last, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// fakePodman returns a podman binary that prints the file output, as
+// captured from the real CLI, whatever it is asked.
+func fakePodman(t *testing.T, output string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake podman binary is a shell script")
+	}
+	path, err := filepath.Abs(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(t.TempDir(), "podman")
+	script := "#!/bin/sh\ncat '" + path + "'\n"
+	if err := os.WriteFile(binary, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return binary
+}
+
+func TestPodmanCLIInspectImage(t *testing.T) {
+	r := NewPodmanCLIRuntime(fakePodman(t, "testdata/podman_image_inspect.json"))
+
+	info, err := r.InspectImage(context.Background(), "alpine:3.19")
+	if err != nil {
+		t.Fatalf("InspectImage: %v", err)
+	}
+
+	// podman prints the ID without the prefix Docker reports.
+	if want := "sha256:ace17d5d883e9ea5a21138d0608d60aa2376c68f616c55bd0793c6a2b3f5c6e7"; info.ID != want {
+		t.Errorf("ID = %q, want %q", info.ID, want)
+	}
+	if len(info.RepoTags) != 1 || info.RepoTags[0] != "docker.io/library/alpine:3.19" {
+		t.Errorf("RepoTags = %v", info.RepoTags)
+	}
+	if len(info.RepoDigests) != 2 {
+		t.Errorf("RepoDigests = %v, want 2", info.RepoDigests)
+	}
+	if info.Size != 7653158 || info.OS != "linux" || info.Architecture != "amd64" {
+		t.Errorf("Size, OS, Architecture = %d, %s, %s", info.Size, info.OS, info.Architecture)
+	}
+	if info.Created.IsZero() {
+		t.Error("Created was not parsed")
+	}
+	if got := info.Labels["org.opencontainers.image.source"]; got != "https://github.com/alpinelinux/docker-alpine" {
+		t.Errorf("Labels = %v", info.Labels)
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrImageNotFound is matched by errors.Is for runtime errors about an image
+// that does not exist locally or in its registry.
+var ErrImageNotFound = errors.New("image not found")
+
+// ErrBuildUnsupported is matched by errors.Is for builds requested from a
+// runtime that has no image builder.
+var ErrBuildUnsupported = errors.New("runtime cannot build images")
+
+// ContainerRuntime is the subset of a container engine the task pipeline
+// needs: checking for an image, pulling it and exporting it as a tar.
+type ContainerRuntime interface {
+	// Name identifies the runtime in logs and errors, e.g. "docker".
+	Name() string
+	// Ping checks that the runtime is reachable.
+	Ping(ctx context.Context) error
+	// InspectImage returns details of a local image, or an error matching
+	// ErrImageNotFound when it is not present.
+	InspectImage(ctx context.Context, image string) (*ImageInfo, error)
+	// PullImage fetches image from its registry, reporting progress as
+	// layers are downloaded. progress may be nil.
+	PullImage(ctx context.Context, image string, progress PullProgressFunc) error
+	// SaveImage streams image in `docker save` tar format. A failure part
+	// way through is returned from Read instead of io.EOF.
+	SaveImage(ctx context.Context, image string) (io.ReadCloser, error)
+	// BuildImage builds buildContext, a tar of the build context, into an
+	// image tagged opts.Tag, passing each line of build output to log. It
+	// returns an error matching ErrBuildUnsupported when the runtime
+	// cannot build images.
+	BuildImage(ctx context.Context, opts BuildOptions, buildContext io.Reader, log BuildLogFunc) error
+}
+
+// BuildOptions describes an image build.
+type BuildOptions struct {
+	Tag string
+	// Dockerfile is the path within the build context, Dockerfile when
+	// empty.
+	Dockerfile string
+	Args       map[string]string
+	Target     string
+}
+
+// BuildLogFunc receives build output one line at a time.
+type BuildLogFunc func(line string)
+
+// ImageInfo describes a local image.
+type ImageInfo struct {
+	ID           string            `json:"id"`
+	RepoTags     []string          `json:"repo_tags,omitempty"`
+	RepoDigests  []string          `json:"repo_digests,omitempty"`
+	Size         int64             `json:"size"`
+	Created      time.Time         `json:"created"`
+	OS           string            `json:"os,omitempty"`
+	Architecture string            `json:"architecture,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+// PullProgress is one progress update for a layer being pulled.
+type PullProgress struct {
+	Layer   string
+	Status  string
+	Current int64
+	Total   int64
+}
+
+type PullProgressFunc func(PullProgress)
+
+// RuntimeError is a failed runtime operation, carrying the HTTP status and
+// message the runtime's API answered with, or the error that kept it from
+// answering.
+type RuntimeError struct {
+	Runtime    string
+	Op         string
+	Image      string
+	StatusCode int
+	Message    string
+	Err        error
+}
+
+func (e *RuntimeError) Error() string {
+	msg := e.Runtime + " " + e.Op
+	if e.Image != "" {
+		msg += " " + e.Image
+	}
+	msg += " failed"
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (status %d)", e.StatusCode)
+	}
+	switch {
+	case e.Message != "":
+		msg += ": " + e.Message
+	case e.Err != nil:
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RuntimeError) Is(target error) bool {
+	return target == ErrImageNotFound && e.StatusCode == http.StatusNotFound
+}
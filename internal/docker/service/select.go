@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/theblitlabs/gologger"
+	"github.com/theblitlabs/parity-client/internal/config"
+)
+
+const (
+	RuntimeAuto       = "auto"
+	RuntimeDocker     = "docker"
+	RuntimePodman     = "podman"
+	RuntimeContainerd = "containerd"
+
+	defaultContainerdSocket = "/run/containerd/containerd.sock"
+	detectTimeout           = 2 * time.Second
+)
+
+// NewRuntime returns the container runtime selected by cfg.Runtime. With
+// "auto", or when unset, it uses the first of Docker, Podman's API, the
+// podman CLI and containerd that is available, falling back to Docker so
+// that a missing runtime is reported when a task needs it.
+func NewRuntime(cfg config.ContainerConfig) (ContainerRuntime, error) {
+	log := gologger.Get().With().Str("component", "container_runtime").Logger()
+
+	switch strings.ToLower(strings.TrimSpace(cfg.Runtime)) {
+	case "", RuntimeAuto:
+		runtime, detected := detectRuntime(cfg)
+		if !detected {
+			log.Warn().Msg("No container runtime detected, defaulting to Docker")
+		} else {
+			log.Info().Str("runtime", runtime.Name()).Msg("Detected container runtime")
+		}
+		return runtime, nil
+	case RuntimeDocker:
+		return NewEngineRuntime(cfg.Host)
+	case RuntimePodman:
+		if cfg.Host != "" {
+			return NewPodmanRuntime(cfg.Host)
+		}
+		if socket := findSocket(podmanSockets()); socket != "" {
+			return NewPodmanRuntime("unix://" + socket)
+		}
+		return NewPodmanCLIRuntime(""), nil
+	case RuntimeContainerd:
+		return NewContainerdRuntime(cfg.Host, cfg.Namespace), nil
+	default:
+		return nil, fmt.Errorf("unknown container runtime %q: expected auto, docker, podman or containerd", cfg.Runtime)
+	}
+}
+
+func detectRuntime(cfg config.ContainerConfig) (ContainerRuntime, bool) {
+	if os.Getenv("DOCKER_HOST") != "" {
+		if runtime, err := NewEngineRuntime(""); err == nil {
+			return runtime, true
+		}
+	}
+
+	if docker, err := NewEngineRuntime(defaultDockerHost); err == nil && reachable(docker) {
+		return docker, true
+	}
+
+	for _, socket := range podmanSockets() {
+		if podman, err := NewPodmanRuntime("unix://" + socket); err == nil && reachable(podman) {
+			return podman, true
+		}
+	}
+
+	if _, err := exec.LookPath("podman"); err == nil {
+		return NewPodmanCLIRuntime(""), true
+	}
+
+	if _, err := exec.LookPath("ctr"); err == nil {
+		if _, err := os.Stat(defaultContainerdSocket); err == nil {
+			return NewContainerdRuntime(cfg.Host, cfg.Namespace), true
+		}
+	}
+
+	docker, _ := NewEngineRuntime("")
+	return docker, false
+}
+
+func reachable(runtime ContainerRuntime) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), detectTimeout)
+	defer cancel()
+	return runtime.Ping(ctx) == nil
+}
+
+// podmanSockets lists where rootless and rootful Podman put their API
+// socket, honouring CONTAINER_HOST as the podman CLI does.
+func podmanSockets() []string {
+	var sockets []string
+	if host := os.Getenv("CONTAINER_HOST"); strings.HasPrefix(host, "unix://") {
+		sockets = append(sockets, strings.TrimPrefix(host, "unix://"))
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		sockets = append(sockets, filepath.Join(dir, "podman", "podman.sock"))
+	}
+	sockets = append(sockets,
+		fmt.Sprintf("/run/user/%d/podman/podman.sock", os.Getuid()),
+		"/run/podman/podman.sock",
+	)
+	return sockets
+}
+
+func findSocket(paths []string) string {
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/theblitlabs/parity-client/internal/metrics"
+)
+
+// imageStream records save metrics for a runtime's image export once it has
+// been read to the end or closed.
+type imageStream struct {
+	io.ReadCloser
+	started time.Time
+	read    int64
+	once    sync.Once
+}
+
+func (s *imageStream) Read(p []byte) (int, error) {
+	n, err := s.ReadCloser.Read(p)
+	s.read += int64(n)
+	switch {
+	case err == io.EOF:
+		s.observe(nil)
+	case err != nil:
+		s.observe(err)
+	}
+	return n, err
+}
+
+func (s *imageStream) Close() error {
+	s.observe(errors.New("closed before end of stream"))
+	return s.ReadCloser.Close()
+}
+
+func (s *imageStream) observe(err error) {
+	s.once.Do(func() {
+		metrics.DockerOperationDuration.Observe(time.Since(s.started).Seconds(), "save", metrics.Result(err))
+		if err == nil {
+			metrics.DockerImageBytes.Observe(float64(s.read), "save")
+		}
+	})
+}
+
+// progressWriter counts bytes written through it and reports the running
+// total to progress, if set.
+type progressWriter struct {
+	written  int64
+	progress ProgressFunc
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.written += int64(len(p))
+	if w.progress != nil {
+		w.progress(w.written)
+	}
+	return len(p), nil
+}
@@ -1,5 +1,11 @@
 package service
 
+import (
+	"strconv"
+
+	"github.com/theblitlabs/parity-client/internal/utils"
+)
+
 type Config struct {
 	Image   string   `json:"image"`
 	Workdir string   `json:"workdir"`
@@ -11,8 +17,56 @@ type Task struct {
 	Command []string `json:"command,omitempty"`
 }
 
+// ResourceConfig limits what a task may use on the runner. Unset fields
+// leave the runner's defaults in place.
 type ResourceConfig struct {
 	Memory    string `json:"memory,omitempty"`
 	CPUShares int64  `json:"cpu_shares,omitempty"`
 	Timeout   string `json:"timeout,omitempty"`
 }
+
+// Normalize validates r and returns it with memory as a byte count and the
+// timeout in Go's canonical duration form, so the runner and the command
+// hash see exactly one spelling of each limit.
+func (r ResourceConfig) Normalize() (ResourceConfig, error) {
+	var normalized ResourceConfig
+
+	if r.Memory != "" {
+		if err := utils.ValidateMemory(r.Memory); err != nil {
+			return ResourceConfig{}, err
+		}
+		bytes, _ := utils.ParseMemory(r.Memory)
+		normalized.Memory = strconv.FormatInt(bytes, 10)
+	}
+
+	if r.CPUShares != 0 {
+		if err := utils.ValidateCPUShares(r.CPUShares); err != nil {
+			return ResourceConfig{}, err
+		}
+		normalized.CPUShares = r.CPUShares
+	}
+
+	if r.Timeout != "" {
+		timeout, err := utils.ParseTimeout(r.Timeout)
+		if err != nil {
+			return ResourceConfig{}, err
+		}
+		normalized.Timeout = timeout.String()
+	}
+
+	return normalized, nil
+}
+
+// Canonical returns the form of a normalized ResourceConfig covered by the
+// command hash:
+//
+//	memory=<BYTES>;cpu_shares=<SHARES>;timeout=<DURATION>
+//
+// with unset fields written as empty values.
+func (r ResourceConfig) Canonical() string {
+	shares := ""
+	if r.CPUShares != 0 {
+		shares = strconv.FormatInt(r.CPUShares, 10)
+	}
+	return "memory=" + r.Memory + ";cpu_shares=" + shares + ";timeout=" + r.Timeout
+}
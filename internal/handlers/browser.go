@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/theblitlabs/parity-client/internal/localauth"
+)
+
+// browserGuard keeps web pages open in the user's browser from using the
+// local API, which loopback callers may reach without a token.
+//
+// The Host header must name the proxy: an IP address, localhost, SERVER_HOST
+// or one of SERVER_ALLOWED_HOSTS. A page on a domain its owner rebinds to
+// 127.0.0.1 sends that domain and is turned away. Requests that change state
+// must not come from another site: a browser's Origin has to be the proxy's
+// own or listed in SERVER_CORS_ALLOWED_ORIGINS, and without an Origin,
+// Sec-Fetch-Site has to be same-origin or none. Other clients send neither
+// header. Requests over the Unix socket are not checked.
+type browserGuard struct {
+	hosts     map[string]bool
+	origins   map[string]bool
+	anyOrigin bool
+}
+
+func newBrowserGuard(listenHost, allowedHosts, corsOrigins string) *browserGuard {
+	g := &browserGuard{
+		hosts:   make(map[string]bool),
+		origins: make(map[string]bool),
+	}
+
+	for _, host := range append(strings.Split(allowedHosts, ","), listenHost) {
+		if host = normalizeHost(host); host != "" {
+			g.hosts[host] = true
+		}
+	}
+
+	for _, origin := range strings.Split(corsOrigins, ",") {
+		switch origin = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/")); origin {
+		case "":
+		case "*":
+			g.anyOrigin = true
+		default:
+			g.origins[origin] = true
+		}
+	}
+	return g
+}
+
+// check returns an error describing why req is rejected, or nil.
+func (g *browserGuard) check(req *http.Request) error {
+	if localauth.ViaUnixSocket(req) {
+		return nil
+	}
+
+	if !g.hostAllowed(normalizeHost(req.Host)) {
+		return fmt.Errorf("host %q is not an address of this proxy; add it to SERVER_ALLOWED_HOSTS to allow it", req.Host)
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	if origin := strings.ToLower(req.Header.Get("Origin")); origin != "" {
+		if origin == ownOrigin(req) || g.origins[origin] {
+			return nil
+		}
+		// "*" lets any site read responses, but a page still has to know a
+		// token before it may change anything.
+		if g.anyOrigin && req.Header.Get("Authorization") != "" {
+			return nil
+		}
+		return fmt.Errorf("cross-site %s request from %s rejected", req.Method, origin)
+	}
+
+	switch req.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+		return nil
+	}
+	return errors.New("cross-site " + req.Method + " request rejected")
+}
+
+func (g *browserGuard) hostAllowed(host string) bool {
+	switch {
+	case host == "":
+		return false
+	case host == "localhost", strings.HasSuffix(host, ".localhost"):
+		// Browsers resolve these to loopback themselves.
+		return true
+	case net.ParseIP(host) != nil:
+		return true
+	}
+	return g.hosts[host]
+}
+
+// normalizeHost strips the port and brackets from a Host header or listen
+// address and lowercases it. Wildcard listen addresses yield "".
+func normalizeHost(host string) string {
+	host = strings.TrimSpace(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+	switch host {
+	case "0.0.0.0", "::":
+		return ""
+	}
+	return host
+}
+
+func ownOrigin(req *http.Request) string {
+	scheme := "http://"
+	if req.TLS != nil {
+		scheme = "https://"
+	}
+	return scheme + strings.ToLower(req.Host)
+}
@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/theblitlabs/gologger"
+	"github.com/theblitlabs/parity-client/internal/balance"
+	"github.com/theblitlabs/parity-client/internal/client"
+	"github.com/theblitlabs/parity-client/internal/config"
+	"github.com/theblitlabs/parity-client/internal/requestid"
+	"github.com/theblitlabs/parity-client/internal/types"
+	"github.com/theblitlabs/parity-client/internal/upstream"
+	"github.com/theblitlabs/parity-client/internal/utils"
+	"github.com/theblitlabs/parity-client/pkg/requestsig"
+)
+
+const dashboardCallTimeout = 30 * time.Second
+
+// DashboardHandler serves the local JSON APIs behind the web dashboard. They
+// use the same clients as the llm, fl and balance commands, acting as the
+// proxy's wallet.
+type DashboardHandler struct {
+	config          *config.Config
+	deviceID        string
+	creatorAddr     string
+	pool            *upstream.Pool
+	transport       http.RoundTripper
+	runnerTransport http.RoundTripper
+	logger          zerolog.Logger
+}
+
+type PromptSubmission struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+type PromptList struct {
+	Prompts []*client.PromptResponse `json:"prompts"`
+	Count   int                      `json:"count"`
+}
+
+type DashboardInfo struct {
+	DeviceID       string `json:"device_id"`
+	CreatorAddress string `json:"creator_address"`
+	TokenSymbol    string `json:"token_symbol"`
+}
+
+// NewDashboardHandler creates the dashboard APIs. Calls to the runner go to
+// an upstream chosen from pool and are signed with signer when it is
+// non-nil, like forwarded requests. Calls to the runner and the federated
+// learning server go over transport.
+func NewDashboardHandler(cfg *config.Config, deviceID, creatorAddr string, pool *upstream.Pool, signer *requestsig.Signer, transport http.RoundTripper) *DashboardHandler {
+	runnerTransport := transport
+	if signer != nil {
+		runnerTransport = requestsig.NewTransport(signer, transport)
+	} else if runnerTransport == nil {
+		runnerTransport = http.DefaultTransport
+	}
+
+	return &DashboardHandler{
+		config:          cfg,
+		deviceID:        deviceID,
+		creatorAddr:     creatorAddr,
+		pool:            pool,
+		transport:       transport,
+		runnerTransport: runnerTransport,
+		logger:          gologger.Get().With().Str("component", "dashboard_handler").Logger(),
+	}
+}
+
+func (h *DashboardHandler) HandleInfo(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, r, DashboardInfo{
+		DeviceID:       h.deviceID,
+		CreatorAddress: h.creatorAddr,
+		TokenSymbol:    h.config.BlockchainNetwork.TokenSymbol,
+	})
+}
+
+func (h *DashboardHandler) HandleWallet(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), dashboardCallTimeout)
+	defer cancel()
+
+	walletAdapter, err := balance.NewWalletAdapter(h.config)
+	if err != nil {
+		h.writeError(w, r, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	report, err := balance.Fetch(ctx, walletAdapter, h.config, h.deviceID)
+	if err != nil {
+		h.writeError(w, r, http.StatusBadGateway, err)
+		return
+	}
+	h.writeJSON(w, r, report)
+}
+
+func (h *DashboardHandler) HandleListModels(w http.ResponseWriter, r *http.Request) {
+	llmClient, ok := h.llmClient(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), dashboardCallTimeout)
+	defer cancel()
+
+	models, err := llmClient.GetAvailableModels(ctx)
+	if err != nil {
+		h.writeError(w, r, http.StatusBadGateway, err)
+		return
+	}
+	h.writeJSON(w, r, models)
+}
+
+func (h *DashboardHandler) HandleListPrompts(w http.ResponseWriter, r *http.Request) {
+	llmClient, ok := h.llmClient(w, r)
+	if !ok {
+		return
+	}
+
+	limit := queryInt(r, "limit", 10)
+	offset := queryInt(r, "offset", 0)
+
+	ctx, cancel := context.WithTimeout(r.Context(), dashboardCallTimeout)
+	defer cancel()
+
+	prompts, err := llmClient.ListPrompts(ctx, limit, offset)
+	if err != nil {
+		h.writeError(w, r, http.StatusBadGateway, err)
+		return
+	}
+	h.writeJSON(w, r, PromptList{Prompts: prompts, Count: len(prompts)})
+}
+
+func (h *DashboardHandler) HandleSubmitPrompt(w http.ResponseWriter, r *http.Request) {
+	var submission PromptSubmission
+	if err := types.ReadJSONBody(r.Body, &submission); err != nil {
+		if limit, tooLarge := bodyTooLarge(err); tooLarge {
+			h.writeError(w, r, http.StatusRequestEntityTooLarge, &http.MaxBytesError{Limit: limit})
+			return
+		}
+		h.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.ValidateModelName(submission.Model); err != nil {
+		h.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if err := utils.ValidatePrompt(submission.Prompt); err != nil {
+		h.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+
+	llmClient, ok := h.llmClient(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), dashboardCallTimeout)
+	defer cancel()
+
+	response, err := llmClient.SubmitPrompt(ctx, submission.Prompt, submission.Model, h.creatorAddr)
+	if err != nil {
+		h.writeError(w, r, http.StatusBadGateway, err)
+		return
+	}
+
+	if err := types.WriteJSON(w, http.StatusAccepted, response); err != nil {
+		requestid.Logger(r.Context(), h.logger).Error().Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *DashboardHandler) HandleGetPrompt(w http.ResponseWriter, r *http.Request, id string) {
+	llmClient, ok := h.llmClient(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), dashboardCallTimeout)
+	defer cancel()
+
+	prompt, err := llmClient.GetPrompt(ctx, id)
+	if err != nil {
+		h.writeError(w, r, http.StatusBadGateway, err)
+		return
+	}
+	h.writeJSON(w, r, prompt)
+}
+
+// HandleListSessions lists federated learning sessions created by the given
+// creator query parameter, or all sessions when it is absent.
+func (h *DashboardHandler) HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	flClient, ok := h.flClient(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), dashboardCallTimeout)
+	defer cancel()
+
+	sessions, err := flClient.ListSessions(ctx, r.URL.Query().Get("creator"))
+	if err != nil {
+		h.writeError(w, r, http.StatusBadGateway, err)
+		return
+	}
+	h.writeJSON(w, r, sessions)
+}
+
+func (h *DashboardHandler) HandleGetSession(w http.ResponseWriter, r *http.Request, id string) {
+	flClient, ok := h.flClient(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), dashboardCallTimeout)
+	defer cancel()
+
+	session, err := flClient.GetSession(ctx, id)
+	if err != nil {
+		h.writeError(w, r, http.StatusBadGateway, err)
+		return
+	}
+	h.writeJSON(w, r, session)
+}
+
+func (h *DashboardHandler) HandleStartSession(w http.ResponseWriter, r *http.Request, id string) {
+	flClient, ok := h.flClient(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), dashboardCallTimeout)
+	defer cancel()
+
+	if err := flClient.StartSession(ctx, id); err != nil {
+		h.writeError(w, r, http.StatusBadGateway, err)
+		return
+	}
+
+	if err := types.WriteJSON(w, http.StatusAccepted, map[string]string{"session_id": id, "status": "started"}); err != nil {
+		requestid.Logger(r.Context(), h.logger).Error().Err(err).Msg("Failed to encode response")
+	}
+}
+
+// llmClient returns a client for an upstream picked from the pool, or
+// answers 503 when none is available.
+func (h *DashboardHandler) llmClient(w http.ResponseWriter, r *http.Request) (*client.LLMClient, bool) {
+	if h.config.Runner.UpstreamURLs() == "" {
+		h.writeMessage(w, r, http.StatusServiceUnavailable, "runner server URL not configured. Please set RUNNER_SERVER_URL or RUNNER_SERVER_URLS in your config")
+		return nil, false
+	}
+
+	target, err := h.pool.Pick(nil)
+	if err != nil {
+		var openErr *upstream.OpenError
+		if errors.As(err, &openErr) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(openErr.RetryAfter.Seconds()))))
+		}
+		h.writeMessage(w, r, http.StatusServiceUnavailable, err.Error())
+		return nil, false
+	}
+
+	clientID := "parity-client-" + strconv.FormatInt(time.Now().Unix(), 10)
+	return client.NewLLMClient(target.URL, clientID, &breakerTransport{target: target, base: h.runnerTransport}), true
+}
+
+// breakerTransport reports the outcome of every request to target's
+// circuit breaker and latency, as forwarded requests do.
+type breakerTransport struct {
+	target *upstream.Upstream
+	base   http.RoundTripper
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		if req.Context().Err() == nil {
+			t.target.Breaker().Failure(err)
+		}
+		return nil, err
+	}
+
+	if upstream.RetryableStatus(resp.StatusCode) {
+		t.target.Breaker().Failure(fmt.Errorf("runner returned status %d", resp.StatusCode))
+	} else {
+		t.target.Breaker().Success()
+		t.target.ObserveLatency(time.Since(started))
+	}
+	return resp, nil
+}
+
+func (h *DashboardHandler) flClient(w http.ResponseWriter, r *http.Request) (*client.FederatedLearningClient, bool) {
+	if h.config.FederatedLearning.ServerURL == "" {
+		h.writeMessage(w, r, http.StatusServiceUnavailable, "federated learning server URL not configured")
+		return nil, false
+	}
+	return client.NewFederatedLearningClient(h.config.FederatedLearning.ServerURL, h.transport), true
+}
+
+func (h *DashboardHandler) writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if err := types.WriteJSON(w, http.StatusOK, v); err != nil {
+		requestid.Logger(r.Context(), h.logger).Error().Err(err).Msg("Failed to encode response")
+	}
+}
+
+func (h *DashboardHandler) writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if status >= http.StatusInternalServerError {
+		requestid.Logger(r.Context(), h.logger).Error().Err(err).Int("status", status).Msg("Dashboard request failed")
+	}
+	h.writeMessage(w, r, status, err.Error())
+}
+
+func (h *DashboardHandler) writeMessage(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if err := types.WriteError(w, status, message); err != nil {
+		requestid.Logger(r.Context(), h.logger).Error().Err(err).Msg("Failed to write error response")
+	}
+}
+
+func queryInt(r *http.Request, name string, fallback int) int {
+	n, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || n < 0 {
+		return fallback
+	}
+	return n
+}
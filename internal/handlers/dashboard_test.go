@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/parity-client/internal/config"
+	"github.com/theblitlabs/parity-client/internal/upstream"
+	"github.com/theblitlabs/parity-client/pkg/requestsig"
+)
+
+func TestDashboardCallsPoolRunnerSigned(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := requestsig.NewSigner(key)
+
+	signers := make(chan common.Address, 1)
+	runner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, err := requestsig.NewVerifier(0).ReadAndVerify(r, 1<<10)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		signers <- addr
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"models":[],"count":0}`))
+	}))
+	t.Cleanup(runner.Close)
+
+	// Only RUNNER_SERVER_URLS is set.
+	cfg := &config.Config{}
+	cfg.Runner.ServerURLs = runner.URL
+	pool, err := upstream.NewPool(cfg.Runner.UpstreamURLs(), "", 0, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewDashboardHandler(cfg, "device-1", signer.Address().Hex(), pool, signer, nil)
+
+	rec := httptest.NewRecorder()
+	h.HandleListModels(rec, httptest.NewRequest(http.MethodGet, "/api/local/llm/models", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if got := <-signers; got != signer.Address() {
+		t.Errorf("runner saw a signature from %s, want %s", got.Hex(), signer.Address().Hex())
+	}
+	if status := pool.Status(); len(status) != 1 || status[0].Latency == "" {
+		t.Errorf("pool status = %+v, want the call's latency recorded", status)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/theblitlabs/gologger"
 	"github.com/theblitlabs/parity-client/internal/config"
+	"github.com/theblitlabs/parity-client/internal/upstream"
 	"github.com/theblitlabs/parity-client/internal/version"
 )
 
@@ -19,6 +20,7 @@ var startTime = time.Now()
 
 type HealthHandler struct {
 	config *config.Config
+	pool   *upstream.Pool
 	logger zerolog.Logger
 }
 
@@ -31,12 +33,13 @@ type HealthStatus struct {
 }
 
 type DetailedHealthStatus struct {
-	Status    string                 `json:"status"`
-	Timestamp time.Time              `json:"timestamp"`
-	Version   string                 `json:"version"`
-	Uptime    string                 `json:"uptime"`
-	Services  map[string]ServiceInfo `json:"services"`
-	Config    ConfigInfo             `json:"config"`
+	Status    string                    `json:"status"`
+	Timestamp time.Time                 `json:"timestamp"`
+	Version   string                    `json:"version"`
+	Uptime    string                    `json:"uptime"`
+	Services  map[string]ServiceInfo    `json:"services"`
+	Upstreams []upstream.UpstreamStatus `json:"upstreams,omitempty"`
+	Config    ConfigInfo                `json:"config"`
 }
 
 type ServiceInfo struct {
@@ -54,9 +57,12 @@ type ConfigInfo struct {
 	RunnerURL     string `json:"runner_url"`
 }
 
-func NewHealthHandler(cfg *config.Config) *HealthHandler {
+// NewHealthHandler creates a health handler that reports runner health from
+// the probes and circuit breakers of pool.
+func NewHealthHandler(cfg *config.Config, pool *upstream.Pool) *HealthHandler {
 	return &HealthHandler{
 		config: cfg,
+		pool:   pool,
 		logger: gologger.Get().With().Str("component", "health").Logger(),
 	}
 }
@@ -125,37 +131,34 @@ func (h *HealthHandler) checkIPFSHealth() ServiceInfo {
 	return status
 }
 
+// checkRunnerHealth reports the runner as healthy while at least one
+// upstream passes its health probes and has a closed circuit breaker.
 func (h *HealthHandler) checkRunnerHealth() ServiceInfo {
-	start := time.Now()
 	status := ServiceInfo{
 		Status:    "unhealthy",
 		LastCheck: time.Now(),
 	}
 
-	if h.config.Runner.ServerURL == "" {
-		status.Error = "Runner URL not configured"
-		return status
-	}
-
-	client := &http.Client{
-		Timeout: 5 * time.Second,
-	}
-
-	// Try to connect to runner health endpoint
-	resp, err := client.Get(fmt.Sprintf("%s/health", h.config.Runner.ServerURL))
-	if err != nil {
-		status.Error = fmt.Sprintf("Failed to connect to runner: %v", err)
-		return status
+	upstreams := h.pool.Status()
+	available := 0
+	for _, u := range upstreams {
+		if u.Healthy && u.Breaker.State == upstream.StateClosed {
+			available++
+			if status.Latency == "" {
+				status.Latency = u.Latency
+			}
+		}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		status.Error = fmt.Sprintf("Runner returned status: %d", resp.StatusCode)
+	if available == 0 {
+		status.Error = fmt.Sprintf("No healthy runner upstream (%d configured)", len(upstreams))
 		return status
 	}
 
 	status.Status = "healthy"
-	status.Latency = time.Since(start).String()
+	if available < len(upstreams) {
+		status.Error = fmt.Sprintf("%d of %d runner upstreams unavailable", len(upstreams)-available, len(upstreams))
+	}
 	return status
 }
 
@@ -169,7 +172,7 @@ func (h *HealthHandler) HandleHealthCheck(w http.ResponseWriter, r *http.Request
 	if h.config.BlockchainNetwork.IPFSEndpoint != "" {
 		services["ipfs"] = "configured"
 	}
-	if h.config.Runner.ServerURL != "" {
+	if h.config.Runner.UpstreamURLs() != "" {
 		services["runner"] = "configured"
 	}
 
@@ -211,18 +214,27 @@ func (h *HealthHandler) HandleDetailedHealthCheck(w http.ResponseWriter, r *http
 		}
 	}
 
+	upstreams := h.pool.Status()
+	for _, u := range upstreams {
+		if !u.Healthy || u.Breaker.State != upstream.StateClosed {
+			overallStatus = "degraded"
+			break
+		}
+	}
+
 	status := DetailedHealthStatus{
 		Status:    overallStatus,
 		Timestamp: time.Now(),
 		Version:   version.GetShortVersion(),
 		Uptime:    h.getUptime(),
 		Services:  services,
+		Upstreams: upstreams,
 		Config: ConfigInfo{
 			ServerHost:    h.config.Server.Host,
 			ServerPort:    h.config.Server.Port,
 			BlockchainRPC: h.config.BlockchainNetwork.RPC,
 			IPFSEndpoint:  h.config.BlockchainNetwork.IPFSEndpoint,
-			RunnerURL:     h.config.Runner.ServerURL,
+			RunnerURL:     h.config.Runner.UpstreamURLs(),
 		},
 	}
 
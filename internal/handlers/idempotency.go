@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/theblitlabs/parity-client/internal/idempotency"
+	"github.com/theblitlabs/parity-client/internal/jobs"
+)
+
+// replayedHeader marks responses served from the idempotency store.
+const replayedHeader = "Idempotent-Replayed"
+
+// jobLocationPrefix starts the Location of a reply that points to a local
+// job.
+const jobLocationPrefix = "/api/local/jobs/"
+
+// replayHeaders are the response headers stored with an idempotent response.
+var replayHeaders = []string{"Content-Type", "Location"}
+
+// withIdempotencyKey runs handle at most once per caller and key. A repeat
+// with the same request gets the stored response, and one with a different
+// request or while the first is still running gets 409. Server errors are
+// not stored so that the request can be retried with the same key.
+//
+// A stored 202 that points to a local job follows the job, which only lives
+// in memory: once the job is submitted the reply names the runner task
+// instead, and when the job fails, or is unknown after a restart, the reply
+// is dropped so that a repeat submits the task again.
+func (r *RequestRouter) withIdempotencyKey(w http.ResponseWriter, req *http.Request, key string, body interface{}, handle func(http.ResponseWriter)) {
+	if !idempotency.ValidKey(key) {
+		r.writeError(w, req, http.StatusBadRequest, idempotency.ErrInvalidKey.Error())
+		return
+	}
+
+	fingerprint, err := r.idempotency.Fingerprint(body)
+	if err != nil {
+		r.log(req).Error().Err(err).Msg("Failed to fingerprint request")
+		r.writeError(w, req, http.StatusInternalServerError, "failed to fingerprint request")
+		return
+	}
+
+	scope := clientFromContext(req.Context())
+	stored, err := r.idempotency.Begin(scope, key, fingerprint)
+	if err == nil && stored != nil && stored.JobID != "" {
+		var forgotten bool
+		if forgotten, err = r.forgetDeadJob(scope, key, stored); err == nil && forgotten {
+			r.log(req).Info().Str("idempotency_key", key).Str("job_id", stored.JobID).Msg("Job of stored response failed or is gone, processing request again")
+			stored, err = r.idempotency.Begin(scope, key, fingerprint)
+		}
+	}
+	switch {
+	case errors.Is(err, idempotency.ErrConflict), errors.Is(err, idempotency.ErrInProgress):
+		r.writeError(w, req, http.StatusConflict, err.Error())
+		return
+	case err != nil:
+		r.log(req).Error().Err(err).Msg("Failed to look up idempotency key")
+		r.writeError(w, req, http.StatusInternalServerError, "failed to look up idempotency key")
+		return
+	case stored != nil:
+		r.log(req).Info().Str("idempotency_key", key).Msg("Replaying response for repeated request")
+		replay(w, stored)
+		return
+	}
+
+	capture := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+	handle(capture)
+
+	if capture.status >= http.StatusInternalServerError {
+		r.idempotency.Release(scope, key)
+		return
+	}
+
+	resp := idempotency.Response{
+		Status: capture.status,
+		Header: make(map[string]string),
+		Body:   capture.body.Bytes(),
+	}
+	for _, name := range replayHeaders {
+		if value := w.Header().Get(name); value != "" {
+			resp.Header[name] = value
+		}
+	}
+	if capture.status == http.StatusAccepted {
+		resp.JobID, _ = strings.CutPrefix(resp.Header["Location"], jobLocationPrefix)
+	}
+	if err := r.idempotency.Complete(scope, key, resp); err != nil {
+		r.log(req).Error().Err(err).Str("idempotency_key", key).Msg("Failed to store idempotent response")
+		return
+	}
+	if resp.JobID != "" {
+		r.followJob(req, scope, key, resp)
+	}
+}
+
+// forgetDeadJob drops the response stored for key when the job it points to
+// failed or the queue no longer knows it, and reports whether it did.
+func (r *RequestRouter) forgetDeadJob(scope, key string, stored *idempotency.Response) (bool, error) {
+	if job, ok := r.jobs.Get(stored.JobID); ok && job.Phase != jobs.PhaseFailed {
+		return false, nil
+	}
+	if err := r.idempotency.Forget(scope, key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// followJob updates the response stored for key once its job finishes:
+// a submitted job's reply is replaced by one naming the runner task, and a
+// failed job's reply is dropped.
+func (r *RequestRouter) followJob(req *http.Request, scope, key string, resp idempotency.Response) {
+	log := r.log(req).With().Str("idempotency_key", key).Str("job_id", resp.JobID).Logger()
+
+	r.jobs.Watch(resp.JobID, func(job jobs.Job) {
+		var err error
+		if job.Phase == jobs.PhaseSubmitted {
+			err = r.idempotency.Replace(scope, key, submittedResponse(resp, job))
+		} else {
+			err = r.idempotency.Forget(scope, key)
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to update idempotent response for finished job")
+		}
+	})
+}
+
+// submittedResponse is the reply replayed for a job that reached the
+// runner: the finished job, with a Location naming the runner task so it
+// stays valid once the job is gone. A job without a task ID keeps the
+// original Location.
+func submittedResponse(resp idempotency.Response, job jobs.Job) idempotency.Response {
+	header := make(map[string]string, len(resp.Header))
+	for name, value := range resp.Header {
+		header[name] = value
+	}
+	if job.TaskID != "" {
+		header["Location"] = "/api/tasks/" + url.PathEscape(job.TaskID)
+	}
+
+	body, err := json.Marshal(job)
+	if err != nil {
+		body = resp.Body
+	} else {
+		body = append(body, '\n')
+	}
+	return idempotency.Response{Status: resp.Status, Header: header, Body: body}
+}
+
+func replay(w http.ResponseWriter, resp *idempotency.Response) {
+	for name, value := range resp.Header {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set(replayedHeader, "true")
+	w.Header().Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	w.WriteHeader(resp.Status)
+	_, _ = w.Write(resp.Body)
+}
+
+// captureWriter keeps a copy of the status and body written through it.
+type captureWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (c *captureWriter) WriteHeader(status int) {
+	if !c.wroteHeader {
+		c.status = status
+		c.wroteHeader = true
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *captureWriter) Write(p []byte) (int, error) {
+	c.wroteHeader = true
+	c.body.Write(p)
+	return c.ResponseWriter.Write(p)
+}
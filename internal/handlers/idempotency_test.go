@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/theblitlabs/parity-client/internal/idempotency"
+	"github.com/theblitlabs/parity-client/internal/jobs"
+)
+
+func TestReplaySubmittedResponse(t *testing.T) {
+	stored := idempotency.Response{
+		Status: http.StatusAccepted,
+		Header: map[string]string{"Location": "/api/local/jobs/j1", "Content-Type": "application/json"},
+		Body:   []byte(`{"id":"j1"}`),
+		JobID:  "j1",
+	}
+
+	tests := []struct {
+		name         string
+		taskID       string
+		wantLocation string
+	}{
+		{"with a runner task", "task/1", "/api/tasks/task%2F1"},
+		{"without a task ID", "", "/api/local/jobs/j1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := submittedResponse(stored, jobs.Job{ID: "j1", Phase: jobs.PhaseSubmitted, TaskID: tt.taskID})
+
+			rec := httptest.NewRecorder()
+			replay(rec, &resp)
+
+			if rec.Code != http.StatusAccepted {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusAccepted)
+			}
+			if got := rec.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+			if rec.Header().Get(replayedHeader) != "true" {
+				t.Errorf("%s header missing", replayedHeader)
+			}
+			if stored.Header["Location"] != "/api/local/jobs/j1" {
+				t.Error("submittedResponse modified the stored header")
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/rs/zerolog"
+	"github.com/theblitlabs/gologger"
+	"github.com/theblitlabs/parity-client/internal/jobs"
+	"github.com/theblitlabs/parity-client/internal/types"
+)
+
+type JobHandler struct {
+	jobs   *jobs.Queue
+	logger zerolog.Logger
+}
+
+type JobList struct {
+	Jobs  []jobs.Job `json:"jobs"`
+	Count int        `json:"count"`
+}
+
+func NewJobHandler(jobQueue *jobs.Queue) *JobHandler {
+	return &JobHandler{
+		jobs:   jobQueue,
+		logger: gologger.Get().With().Str("component", "jobs_handler").Logger(),
+	}
+}
+
+func (h *JobHandler) HandleListJobs(w http.ResponseWriter, r *http.Request) {
+	list := h.jobs.List()
+	if err := types.WriteJSON(w, http.StatusOK, JobList{Jobs: list, Count: len(list)}); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to encode job list")
+	}
+}
+
+func (h *JobHandler) HandleGetJob(w http.ResponseWriter, r *http.Request, id string) {
+	job, ok := h.jobs.Get(id)
+	if !ok {
+		if err := types.WriteError(w, http.StatusNotFound, "job not found"); err != nil {
+			h.logger.Error().Err(err).Msg("Failed to write error response")
+		}
+		return
+	}
+
+	if err := types.WriteJSON(w, http.StatusOK, job); err != nil {
+		h.logger.Error().Err(err).Str("job_id", id).Msg("Failed to encode job")
+	}
+}
+
+// HandleGetJobLog serves the job's build output as plain text.
+func (h *JobHandler) HandleGetJobLog(w http.ResponseWriter, r *http.Request, id string) {
+	log, ok := h.jobs.Log(id)
+	if !ok {
+		if err := types.WriteError(w, http.StatusNotFound, "job not found"); err != nil {
+			h.logger.Error().Err(err).Msg("Failed to write error response")
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(log)); err != nil {
+		h.logger.Error().Err(err).Str("job_id", id).Msg("Failed to write job log")
+	}
+}
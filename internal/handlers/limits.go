@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theblitlabs/parity-client/internal/localauth"
+)
+
+const (
+	defaultMaxJSONBody        = 10 << 20
+	defaultMaxUploadBody      = 10 << 30
+	defaultMaxPassthroughBody = 1 << 30
+)
+
+// bodyLimits caps request bodies: multipart uploads are streamed to the
+// runner under their own, larger limit, JSON bodies and bodies the proxy
+// decodes itself under the JSON one, and any other body forwarded to the
+// runner under the pass-through limit.
+type bodyLimits struct {
+	json        int64
+	upload      int64
+	passthrough int64
+}
+
+func newBodyLimits(maxJSON, maxUpload, maxPassthrough int64) bodyLimits {
+	if maxJSON <= 0 {
+		maxJSON = defaultMaxJSONBody
+	}
+	if maxUpload <= 0 {
+		maxUpload = defaultMaxUploadBody
+	}
+	if maxPassthrough <= 0 {
+		maxPassthrough = defaultMaxPassthroughBody
+	}
+	return bodyLimits{json: maxJSON, upload: maxUpload, passthrough: maxPassthrough}
+}
+
+// limitFor returns the limit for req's body on a route that handles it
+// locally or, when local is false, forwards it to the runner.
+func (l bodyLimits) limitFor(req *http.Request, local bool) int64 {
+	mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch {
+	case err == nil && strings.HasPrefix(mediaType, "multipart/"):
+		return l.upload
+	case local || mediaType == "application/json":
+		return l.json
+	default:
+		return l.passthrough
+	}
+}
+
+// apply wraps the request body so reading past the limit fails with an
+// *http.MaxBytesError. It returns the limit and false when the declared
+// Content-Length already exceeds it.
+func (l bodyLimits) apply(w http.ResponseWriter, req *http.Request, local bool) (int64, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return 0, true
+	}
+
+	limit := l.limitFor(req, local)
+	if req.ContentLength > limit {
+		return limit, false
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, limit)
+	return limit, true
+}
+
+// clientKey identifies the caller for rate limiting and idempotency keys: by
+// API token when one was presented, otherwise by remote IP.
+func clientKey(req *http.Request, token *localauth.Token) string {
+	if token != nil {
+		return "token:" + token.ID
+	}
+	if ip := localauth.RemoteIP(req); ip != nil {
+		return "ip:" + ip.String()
+	}
+	return "addr:" + req.RemoteAddr
+}
+
+func (r *RequestRouter) rateLimit(w http.ResponseWriter, req *http.Request, route, client string) bool {
+	retryAfter, ok := r.limiter.Allow(route, client)
+	if ok {
+		return true
+	}
+
+	r.log(req).Warn().
+		Str("route", route).
+		Str("client", client).
+		Dur("retry_after", retryAfter).
+		Msg("Rate limited request")
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(retryAfter.Seconds())))))
+	r.writeError(w, req, http.StatusTooManyRequests, fmt.Sprintf("rate limit exceeded for %s, retry in %s", route, retryAfter.Round(time.Millisecond)))
+	return false
+}
+
+func (r *RequestRouter) writeBodyTooLarge(w http.ResponseWriter, req *http.Request, limit int64) {
+	r.writeError(w, req, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds the %d byte limit", limit))
+}
+
+// bodyTooLarge reports whether err was caused by reading past a body limit.
+func bodyTooLarge(err error) (int64, bool) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return maxErr.Limit, true
+	}
+	return 0, false
+}
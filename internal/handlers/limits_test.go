@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimitFor(t *testing.T) {
+	limits := newBodyLimits(10, 1000, 100)
+
+	tests := []struct {
+		name        string
+		contentType string
+		local       bool
+		want        int64
+	}{
+		{"multipart upload to a local route", "multipart/form-data; boundary=x", true, 1000},
+		{"multipart upload to the runner", "multipart/form-data; boundary=x", false, 1000},
+		{"JSON to a local route", "application/json", true, 10},
+		{"JSON to the runner", "application/json; charset=utf-8", false, 10},
+		{"untyped body to a local route", "", true, 10},
+		{"binary body to the runner", "application/octet-stream", false, 100},
+		{"untyped body to the runner", "", false, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/storage/upload", strings.NewReader("body"))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if got := limits.limitFor(req, tt.local); got != tt.want {
+				t.Errorf("limitFor = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyRejectsDeclaredLengthOverLimit(t *testing.T) {
+	limits := newBodyLimits(10, 1000, 100)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/storage/upload", strings.NewReader(strings.Repeat("x", 50)))
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	if _, ok := limits.apply(httptest.NewRecorder(), req, false); !ok {
+		t.Error("a 50 byte pass-through body was rejected under the 100 byte limit")
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if limit, ok := limits.apply(httptest.NewRecorder(), req, false); ok || limit != 10 {
+		t.Errorf("apply = %d, %v; want 10, false for a 50 byte JSON body", limit, ok)
+	}
+}
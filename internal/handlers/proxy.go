@@ -1,53 +1,86 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/theblitlabs/gologger"
+	"github.com/theblitlabs/parity-client/internal/metrics"
+	"github.com/theblitlabs/parity-client/internal/requestid"
 	"github.com/theblitlabs/parity-client/internal/types"
+	"github.com/theblitlabs/parity-client/internal/upstream"
+	"github.com/theblitlabs/parity-client/pkg/requestsig"
 )
 
 // proxyHandler handles HTTP request proxying
 type proxyHandler struct {
-	serverURL   string
+	pool        *upstream.Pool
 	deviceID    string
 	creatorAddr string
 	client      *http.Client
+	policy      *upstream.Policy
 	logger      zerolog.Logger
 }
 
-// newProxyHandler creates a new proxy handler
-func newProxyHandler(serverURL, deviceID, creatorAddr string) *proxyHandler {
+// newProxyHandler creates a new proxy handler that balances requests across
+// pool and signs them with signer when it is non-nil, sending them over
+// transport. Requests are bounded by policy.
+func newProxyHandler(pool *upstream.Pool, deviceID, creatorAddr string, signer *requestsig.Signer, policy *upstream.Policy, transport http.RoundTripper) *proxyHandler {
+	client := &http.Client{Transport: transport}
+	if signer != nil {
+		client.Transport = requestsig.NewTransport(signer, transport)
+	}
+
 	return &proxyHandler{
-		serverURL:   strings.TrimSuffix(serverURL, "/"),
+		pool:        pool,
 		deviceID:    deviceID,
 		creatorAddr: creatorAddr,
-		client:      &http.Client{},
+		client:      client,
+		policy:      policy,
 		logger:      gologger.Get().With().Str("component", "proxy").Logger(),
 	}
 }
 
-// forwardRequest forwards an HTTP request to the target server
-func (p *proxyHandler) forwardRequest(w http.ResponseWriter, req *http.Request, path string) error {
-	targetURL := fmt.Sprintf("%s/api/%s", p.serverURL, path)
-
-	proxyReq, err := http.NewRequest(req.Method, targetURL, req.Body)
-	if err != nil {
-		return fmt.Errorf("error creating proxy request: %v", err)
+// forwardRequest forwards an HTTP request to a runner upstream. Requests about
+// a task the proxy submitted, identified by taskID, go to the upstream that
+// accepted it; others are balanced across the pool. Idempotent requests
+// without a body are retried on transport errors and 502/503/504 responses,
+// on another upstream where possible. It returns an *upstream.OpenError
+// without contacting a runner while every eligible circuit breaker is open.
+// Failures are counted against route in the upstream error metrics.
+//
+// Server-sent events and bodies of unknown length are flushed to the caller
+// as they arrive, and protocol upgrades such as WebSocket are tunnelled. The
+// route timeout covers the wait for response headers only in those cases, so
+// long-lived streams are not cut off.
+//
+// The request's X-Request-ID header is forwarded as is, and the runner that
+// served the request is recorded for the access log. X-Parity-* headers from
+// the caller are dropped, so the only signature a runner sees is the proxy's.
+func (p *proxyHandler) forwardRequest(w http.ResponseWriter, req *http.Request, route, path, taskID string) error {
+	targetPath := "/api/" + path
+	if req.URL.RawQuery != "" {
+		targetPath += "?" + req.URL.RawQuery
 	}
 
-	types.CopyHeaders(proxyReq.Header, req.Header)
-
-	proxyReq.Header.Set("X-Device-ID", p.deviceID)
-	proxyReq.Header.Set("X-Creator-Address", p.creatorAddr)
+	logger := requestid.Logger(req.Context(), p.logger)
+	timeout := p.policy.TimeoutFor(route)
+	d := newDeadline(req.Context(), timeout)
+	defer d.Release()
 
-	resp, err := p.client.Do(proxyReq)
+	resp, err := p.send(d.ctx, req, route, targetPath, taskID)
 	if err != nil {
-		return fmt.Errorf("error forwarding request: %v", err)
+		if d.Expired() {
+			return fmt.Errorf("runner did not respond within %s: %w", timeout, context.DeadlineExceeded)
+		}
+		return err
 	}
 	defer func() {
 		if closeErr := resp.Body.Close(); closeErr != nil {
@@ -55,14 +88,168 @@ func (p *proxyHandler) forwardRequest(w http.ResponseWriter, req *http.Request,
 		}
 	}()
 
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		d.Stop()
+		if reqType, respType := upgradeType(req.Header), upgradeType(resp.Header); reqType != respType {
+			metrics.UpstreamErrorsTotal.Inc(route, "upgrade")
+			return fmt.Errorf("runner switched to protocol %q, requested %q", respType, reqType)
+		}
+		if err := tunnel(w, resp); err != nil {
+			metrics.UpstreamErrorsTotal.Inc(route, "upgrade")
+			logger.Error().Err(err).Str("route", route).Msg("Upgraded connection failed")
+			return err
+		}
+		return nil
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		metrics.UpstreamErrorsTotal.Inc(route, "status_5xx")
+	}
+
+	removeHopHeaders(resp.Header)
 	types.CopyHeaders(w.Header(), resp.Header)
 
+	var body io.Writer = w
+	if isStreamingResponse(resp) {
+		d.Stop()
+		rc := http.NewResponseController(w)
+		// The server write timeout is sized for ordinary responses; a
+		// stream ends when the runner or the caller closes it.
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			logger.Debug().Err(err).Msg("Failed to clear write deadline for streamed response")
+		}
+		body = &flushWriter{w: w, rc: rc}
+	}
+
 	w.WriteHeader(resp.StatusCode)
 
-	if _, err := types.CopyBody(w, resp.Body); err != nil {
-		p.logger.Error().Err(err).Msg("Failed to copy response body")
+	if _, err := types.CopyBody(body, resp.Body); err != nil {
+		metrics.UpstreamErrorsTotal.Inc(route, "response_copy")
+		logger.Error().Err(err).Msg("Failed to copy response body")
 		return err
 	}
 
 	return nil
 }
+
+// send performs the request, retrying according to the policy. On success
+// the caller owns the returned response body.
+func (p *proxyHandler) send(ctx context.Context, req *http.Request, route, targetPath, taskID string) (*http.Response, error) {
+	logger := requestid.Logger(req.Context(), p.logger)
+	attempts := p.policy.Attempts(req)
+	pinned := p.pool.Pinned(taskID)
+	tried := make(map[*upstream.Upstream]bool)
+
+	var lastErr error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			delay := p.policy.Backoff(attempt)
+			logger.Debug().
+				Str("route", route).
+				Int("attempt", attempt+1).
+				Dur("backoff", delay).
+				Err(lastErr).
+				Msg("Retrying upstream request")
+
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, fmt.Errorf("error forwarding request: %w", ctx.Err())
+			case <-timer.C:
+			}
+		}
+
+		target, err := p.pick(pinned, tried)
+		if err != nil {
+			metrics.UpstreamErrorsTotal.Inc(route, "circuit_open")
+			return nil, err
+		}
+		tried[target] = true
+		setUpstream(req.Context(), target.URL)
+		breaker := target.Breaker()
+		targetURL := target.URL + targetPath
+
+		body := req.Body
+		if attempt > 0 {
+			body = http.NoBody
+		}
+		proxyReq, err := http.NewRequestWithContext(ctx, req.Method, targetURL, body)
+		if err != nil {
+			metrics.UpstreamErrorsTotal.Inc(route, "request")
+			return nil, fmt.Errorf("error creating proxy request: %v", err)
+		}
+		proxyReq.ContentLength = req.ContentLength
+
+		types.CopyHeaders(proxyReq.Header, req.Header)
+		removeHopHeaders(proxyReq.Header)
+		removeParityHeaders(proxyReq.Header)
+		if protocol := req.Header.Get("Upgrade"); upgradeType(req.Header) != "" {
+			proxyReq.Header.Set("Connection", "Upgrade")
+			proxyReq.Header.Set("Upgrade", protocol)
+		}
+
+		proxyReq.Header.Set("X-Device-ID", p.deviceID)
+		proxyReq.Header.Set("X-Creator-Address", p.creatorAddr)
+
+		started := time.Now()
+		resp, err := p.client.Do(proxyReq)
+		if err != nil {
+			// A caller that went away or sent an oversized body says
+			// nothing about the runner.
+			if _, tooLarge := bodyTooLarge(err); tooLarge || req.Context().Err() != nil {
+				return nil, fmt.Errorf("error forwarding request: %w", err)
+			}
+			metrics.UpstreamErrorsTotal.Inc(route, "transport")
+			breaker.Failure(err)
+			lastErr = err
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+
+		if !upstream.RetryableStatus(resp.StatusCode) {
+			breaker.Success()
+			target.ObserveLatency(time.Since(started))
+			return resp, nil
+		}
+
+		breaker.Failure(fmt.Errorf("runner returned status %d", resp.StatusCode))
+		if attempt == attempts-1 {
+			return resp, nil
+		}
+		lastErr = fmt.Errorf("runner returned status %d", resp.StatusCode)
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		_ = resp.Body.Close()
+	}
+
+	return nil, fmt.Errorf("error forwarding request: %w", lastErr)
+}
+
+// removeParityHeaders drops the X-Parity-* headers the signing transport
+// sets, which a caller could otherwise pass off as the proxy's.
+func removeParityHeaders(h http.Header) {
+	for name := range h {
+		if strings.HasPrefix(http.CanonicalHeaderKey(name), "X-Parity-") {
+			delete(h, name)
+		}
+	}
+}
+
+// pick returns pinned when set, otherwise an upstream from the pool that has
+// not been tried yet, or any available one once all have been tried.
+func (p *proxyHandler) pick(pinned *upstream.Upstream, tried map[*upstream.Upstream]bool) (*upstream.Upstream, error) {
+	if pinned != nil {
+		if retryAfter, ok := pinned.Breaker().Allow(); !ok {
+			return nil, &upstream.OpenError{RetryAfter: retryAfter}
+		}
+		return pinned, nil
+	}
+
+	target, err := p.pool.Pick(tried)
+	if err != nil && len(tried) > 0 {
+		return p.pool.Pick(nil)
+	}
+	return target, err
+}
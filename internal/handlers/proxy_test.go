@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/parity-client/internal/upstream"
+	"github.com/theblitlabs/parity-client/pkg/requestsig"
+)
+
+func TestForwardRequestDropsCallerParityHeaders(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := requestsig.NewSigner(key)
+
+	type received struct {
+		addr   common.Address
+		err    error
+		header http.Header
+	}
+	results := make(chan received, 1)
+	runner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addr, err := requestsig.NewVerifier(0).ReadAndVerify(r, 1<<10)
+		results <- received{addr: addr, err: err, header: r.Header.Clone()}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(runner.Close)
+
+	pool, err := upstream.NewPool(runner.URL, "", 0, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := upstream.NewPolicy(time.Minute, "", 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := newProxyHandler(pool, "device-1", signer.Address().Hex(), signer, policy, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/llm/prompts", strings.NewReader(`{"prompt":"hi"}`))
+	req.Header.Set(requestsig.HeaderAddress, "0x000000000000000000000000000000000000dEaD")
+	req.Header.Set(requestsig.HeaderSignature, "0xforged")
+	req.Header.Set("X-Parity-Custom", "caller")
+
+	rec := httptest.NewRecorder()
+	if err := p.forwardRequest(rec, req, "llm", "v1/llm/prompts", ""); err != nil {
+		t.Fatalf("forwardRequest: %v", err)
+	}
+
+	got := <-results
+	if got.err != nil {
+		t.Fatalf("runner could not verify the request: %v", got.err)
+	}
+	if got.addr != signer.Address() {
+		t.Errorf("runner saw a signature from %s, want %s", got.addr.Hex(), signer.Address().Hex())
+	}
+	if v := got.header.Get("X-Parity-Custom"); v != "" {
+		t.Errorf("X-Parity-Custom = %q reached the runner", v)
+	}
+}
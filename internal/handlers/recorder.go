@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/theblitlabs/parity-client/internal/localauth"
+)
+
+// statusRecorder captures the status code and body size written to a
+// response so they can be reported after the handler returns.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int64
+	wroteHeader bool
+}
+
+func newStatusRecorder(w http.ResponseWriter) *statusRecorder {
+	return &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if !r.wroteHeader {
+		r.wroteHeader = true
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack records the connection as switched to another protocol before
+// handing it over.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.status = http.StatusSwitchingProtocols
+		r.wroteHeader = true
+	}
+	return conn, buf, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+type requestInfoKey struct{}
+
+// requestInfo collects details about a request that are only known once
+// routing has started: the caller identity and API token for local
+// handlers and the upstream for the access log.
+type requestInfo struct {
+	client   string
+	token    *localauth.Token
+	upstream string
+}
+
+func withRequestInfo(ctx context.Context, info *requestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// setUpstream records the runner that served the request.
+func setUpstream(ctx context.Context, url string) {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		info.upstream = url
+	}
+}
+
+// clientFromContext returns the caller identity recorded by the router, as
+// produced by clientKey.
+func clientFromContext(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.client
+	}
+	return ""
+}
+
+// tokenFromContext returns the API token the caller authenticated with, or
+// nil when it presented none.
+func tokenFromContext(ctx context.Context) *localauth.Token {
+	if info, ok := ctx.Value(requestInfoKey{}).(*requestInfo); ok {
+		return info.token
+	}
+	return nil
+}
@@ -1,14 +1,34 @@
 package handlers
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/theblitlabs/gologger"
+	"github.com/theblitlabs/parity-client/internal/accesslog"
 	"github.com/theblitlabs/parity-client/internal/config"
+	"github.com/theblitlabs/parity-client/internal/docker/service"
+	"github.com/theblitlabs/parity-client/internal/idempotency"
+	"github.com/theblitlabs/parity-client/internal/jobs"
+	"github.com/theblitlabs/parity-client/internal/localauth"
+	"github.com/theblitlabs/parity-client/internal/metrics"
+	"github.com/theblitlabs/parity-client/internal/ratelimit"
+	"github.com/theblitlabs/parity-client/internal/requestid"
+	"github.com/theblitlabs/parity-client/internal/storage"
 	"github.com/theblitlabs/parity-client/internal/task"
 	"github.com/theblitlabs/parity-client/internal/types"
+	"github.com/theblitlabs/parity-client/internal/upstream"
+	"github.com/theblitlabs/parity-client/pkg/requestsig"
 )
 
 type RequestRouter struct {
@@ -18,23 +38,170 @@ type RequestRouter struct {
 	taskHandler   *TaskHandler
 	proxy         *proxyHandler
 	healthHandler *HealthHandler
+	jobHandler    *JobHandler
+	dashboard     *DashboardHandler
+	auth          *localauth.Authenticator
+	browser       *browserGuard
+	limiter       *ratelimit.Limiter
+	access        *accesslog.Logger
+	bodyLimits    bodyLimits
+	idempotency   *idempotency.Store
+	jobs          *jobs.Queue
+	routes        routeTable
 	logger        zerolog.Logger
 }
 
-func NewRequestRouter(cfg *config.Config, deviceID, creatorAddr string) *RequestRouter {
-	return &RequestRouter{
+func NewRequestRouter(cfg *config.Config, deviceID string, signer *requestsig.Signer, runtime service.ContainerRuntime, jobQueue *jobs.Queue, pool *upstream.Pool, auth *localauth.Authenticator, access *accesslog.Logger, transport http.RoundTripper) (*RequestRouter, error) {
+	if signer == nil {
+		return nil, errors.New("a request signer is required")
+	}
+	creatorAddr := signer.Address().Hex()
+
+	policy, err := upstream.NewPolicy(
+		cfg.Upstream.Timeout,
+		cfg.Upstream.RouteTimeouts,
+		cfg.Upstream.Retries,
+		cfg.Upstream.RetryBackoff,
+		cfg.Upstream.RetryMaxBackoff,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid UPSTREAM_ROUTE_TIMEOUTS: %w", err)
+	}
+
+	routeRates, err := ratelimit.ParseRouteRates(cfg.Limits.RouteRates)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LIMITS_ROUTE_RATES: %w", err)
+	}
+
+	encryptionKeys, err := ParseEncryptionKeys(cfg.Runner.EncryptionKeys)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RUNNER_ENCRYPTION_KEYS: %w", err)
+	}
+
+	artifacts, err := storage.NewBlockchainService(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize IPFS storage: %w", err)
+	}
+
+	taskHandler, err := NewTaskHandler(cfg, deviceID, creatorAddr, signer, runtime, jobQueue, pool, encryptionKeys, artifacts, transport)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RequestRouter{
 		config:        cfg,
 		deviceID:      deviceID,
 		creatorAddr:   creatorAddr,
-		taskHandler:   NewTaskHandler(cfg, deviceID, creatorAddr),
-		proxy:         newProxyHandler(cfg.Runner.ServerURL, deviceID, creatorAddr),
-		healthHandler: NewHealthHandler(cfg),
+		taskHandler:   taskHandler,
+		proxy:         newProxyHandler(pool, deviceID, creatorAddr, signer, policy, transport),
+		healthHandler: NewHealthHandler(cfg, pool),
+		jobHandler:    NewJobHandler(jobQueue),
+		dashboard:     NewDashboardHandler(cfg, deviceID, creatorAddr, pool, signer, transport),
+		auth:          auth,
+		browser:       newBrowserGuard(cfg.Server.Host, cfg.Server.AllowedHosts, cfg.Server.CORSOrigins),
+		access:        access,
+		limiter:       ratelimit.New(ratelimit.Rate{PerSecond: cfg.Limits.Rate, Burst: cfg.Limits.Burst}, routeRates),
+		bodyLimits:    newBodyLimits(cfg.Limits.MaxJSONBody, cfg.Limits.MaxUploadBody, cfg.Limits.MaxPassthroughBody),
+		idempotency:   idempotency.DefaultStore(cfg.Jobs.IdempotencyWindow),
+		jobs:          jobQueue,
 		logger:        gologger.Get().With().Str("component", "router").Logger(),
 	}
+	r.routes = r.buildRoutes()
+
+	return r, nil
+}
+
+// buildRoutes declares which paths the proxy serves locally and which it
+// forwards to the runner unchanged. Paths not listed here get a 404. A
+// {task_id} parameter sends the request to the upstream the task was
+// submitted to.
+func (r *RequestRouter) buildRoutes() routeTable {
+	get := []string{http.MethodGet}
+	post := []string{http.MethodPost}
+
+	return routeTable{
+		// Local endpoints
+		{name: "health", pattern: "health", methods: get, handler: r.withoutParams(r.healthHandler.HandleHealthCheck)},
+		{name: "health_detailed", pattern: "health/detailed", methods: get, handler: r.withoutParams(r.healthHandler.HandleDetailedHealthCheck)},
+		{name: "health_ready", pattern: "health/ready", methods: get, handler: r.withoutParams(r.healthHandler.HandleReadinessCheck)},
+		{name: "health_live", pattern: "health/live", methods: get, handler: r.withoutParams(r.healthHandler.HandleLivenessCheck)},
+		{name: "local_jobs", pattern: "local/jobs", methods: get, handler: r.withoutParams(r.jobHandler.HandleListJobs)},
+		{name: "local_job", pattern: "local/jobs/{id}", methods: get, handler: r.withID(r.jobHandler.HandleGetJob)},
+		{name: "local_job", pattern: "local/jobs/{id}/log", methods: get, handler: r.withID(r.jobHandler.HandleGetJobLog)},
+		{name: "task_create", pattern: "tasks", methods: post, handler: r.handleCreateTask},
+		{name: "task_create", pattern: "v1/tasks", methods: post, handler: r.handleCreateTask},
+
+		// Dashboard APIs
+		{name: "local_info", pattern: "local/info", methods: get, handler: r.withoutParams(r.dashboard.HandleInfo)},
+		{name: "local_wallet", pattern: "local/wallet", methods: get, handler: r.withoutParams(r.dashboard.HandleWallet)},
+		{name: "local_llm", pattern: "local/llm/models", methods: get, handler: r.withoutParams(r.dashboard.HandleListModels)},
+		{name: "local_llm", pattern: "local/llm/prompts", methods: get, handler: r.withoutParams(r.dashboard.HandleListPrompts)},
+		{name: "local_llm_submit", pattern: "local/llm/prompts", methods: post, handler: r.requireJSON(r.withoutParams(r.dashboard.HandleSubmitPrompt))},
+		{name: "local_llm", pattern: "local/llm/prompts/{id}", methods: get, handler: r.withID(r.dashboard.HandleGetPrompt)},
+		{name: "local_fl", pattern: "local/fl/sessions", methods: get, handler: r.withoutParams(r.dashboard.HandleListSessions)},
+		{name: "local_fl", pattern: "local/fl/sessions/{id}", methods: get, handler: r.withID(r.dashboard.HandleGetSession)},
+		{name: "local_fl_start", pattern: "local/fl/sessions/{id}/start", methods: post, handler: r.requireJSON(r.withID(r.dashboard.HandleStartSession))},
+
+		// Runner pass-through, for every method
+		{name: "tasks", pattern: "tasks"},
+		{name: "tasks", pattern: "v1/tasks"},
+		{name: "task", pattern: "tasks/{task_id}/*"},
+		{name: "task", pattern: "v1/tasks/{task_id}/*"},
+		{name: "llm", pattern: "llm/*"},
+		{name: "llm", pattern: "v1/llm/*"},
+		{name: "federated_learning", pattern: "federated-learning/*"},
+		{name: "federated_learning", pattern: "v1/federated-learning/*"},
+		{name: "storage", pattern: "storage/*"},
+		{name: "storage", pattern: "v1/storage/*"},
+		{name: "runners", pattern: "runners/*"},
+		{name: "runners", pattern: "v1/runners/*"},
+		{name: "reputation", pattern: "reputation/*"},
+		{name: "reputation", pattern: "v1/reputation/*"},
+		{name: "monitoring", pattern: "monitoring/*"},
+		{name: "monitoring", pattern: "v1/monitoring/*"},
+	}
+}
+
+func (r *RequestRouter) withoutParams(h http.HandlerFunc) routeHandler {
+	return func(w http.ResponseWriter, req *http.Request, _ map[string]string) {
+		h(w, req)
+	}
+}
+
+func (r *RequestRouter) withID(h func(http.ResponseWriter, *http.Request, string)) routeHandler {
+	return func(w http.ResponseWriter, req *http.Request, params map[string]string) {
+		h(w, req, params["id"])
+	}
+}
+
+// requireJSON answers 415 unless the request body is JSON. A web page can
+// only send JSON to another origin after a CORS preflight, so a plain HTML
+// form cannot drive the endpoint.
+func (r *RequestRouter) requireJSON(h routeHandler) routeHandler {
+	return func(w http.ResponseWriter, req *http.Request, params map[string]string) {
+		if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType != "application/json" {
+			r.writeError(w, req, http.StatusUnsupportedMediaType, "this endpoint requires an application/json body")
+			return
+		}
+		h(w, req, params)
+	}
 }
 
+// HandleRequest serves a request to the local API. Every request gets an
+// X-Request-ID, the caller's when it sent a valid one, which is echoed in the
+// response, forwarded to the runner and attached to the request's log lines.
 func (r *RequestRouter) HandleRequest(w http.ResponseWriter, req *http.Request) {
-	r.logger.Debug().
+	started := time.Now()
+	rec := newStatusRecorder(w)
+	w = rec
+
+	id := requestid.FromRequest(req)
+	info := &requestInfo{}
+	req = req.WithContext(withRequestInfo(requestid.WithContext(req.Context(), id), info))
+	req.Header.Set(requestid.Header, id)
+	w.Header().Set(requestid.Header, id)
+
+	r.log(req).Debug().
 		Str("original_path", req.URL.Path).
 		Str("method", req.Method).
 		Str("content_type", req.Header.Get("Content-Type")).
@@ -43,64 +210,334 @@ func (r *RequestRouter) HandleRequest(w http.ResponseWriter, req *http.Request)
 	path := strings.TrimPrefix(req.URL.Path, "/")
 	path = strings.TrimPrefix(path, "api/")
 
-	// Handle health check endpoints
-	if r.handleHealthEndpoints(w, req, path) {
+	rt, params, allowed := r.routes.lookup(req.Method, path)
+
+	routeName := "unmatched"
+	if rt != nil {
+		routeName = rt.name
+	}
+	defer func() {
+		status := strconv.Itoa(rec.status)
+		method := metrics.Method(req.Method)
+		metrics.HTTPRequestsTotal.Inc(routeName, method, status)
+		metrics.HTTPRequestDuration.Observe(time.Since(started).Seconds(), routeName, method, status)
+
+		if err := r.access.Log(accesslog.Entry{
+			Time:       started,
+			RequestID:  id,
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			Route:      routeName,
+			Status:     rec.status,
+			Bytes:      rec.bytes,
+			LatencyMS:  float64(time.Since(started).Microseconds()) / 1000,
+			Upstream:   info.upstream,
+			RemoteAddr: req.RemoteAddr,
+		}); err != nil {
+			r.log(req).Error().Err(err).Msg("Failed to write access log")
+		}
+	}()
+
+	if !r.checkBrowser(w, req, path) {
 		return
 	}
+	token, ok := r.authorize(w, req, path)
+	if !ok {
+		return
+	}
+	info.client = clientKey(req, token)
+	info.token = token
 
-	if req.Method == "POST" && strings.Contains(req.Header.Get("Content-Type"), "application/json") {
-		r.handleJSONRequest(w, req, path)
+	if rt == nil {
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			r.writeError(w, req, http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed for /%s", req.Method, path))
+			return
+		}
+		r.writeError(w, req, http.StatusNotFound, fmt.Sprintf("no route for /%s", path))
+		return
+	}
+
+	if !r.rateLimit(w, req, rt.name, info.client) {
+		return
+	}
+	if limit, ok := r.bodyLimits.apply(w, req, rt.local()); !ok {
+		r.writeBodyTooLarge(w, req, limit)
 		return
 	}
 
-	if err := r.proxy.forwardRequest(w, req, path); err != nil {
-		if writeErr := types.WriteError(w, http.StatusBadGateway, err.Error()); writeErr != nil {
-			r.logger.Error().Err(writeErr).Msg("Failed to write error response")
+	if rt.local() {
+		rt.handler(w, req, params)
+		return
+	}
+
+	if err := r.proxy.forwardRequest(w, req, rt.name, path, params["task_id"]); err != nil && !rec.wroteHeader {
+		var openErr *upstream.OpenError
+		if limit, ok := bodyTooLarge(err); ok {
+			r.writeBodyTooLarge(w, req, limit)
+			return
+		}
+		switch {
+		case errors.As(err, &openErr):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(openErr.RetryAfter.Seconds()))))
+			r.writeError(w, req, http.StatusServiceUnavailable, err.Error())
+		case errors.Is(err, context.DeadlineExceeded):
+			r.writeError(w, req, http.StatusGatewayTimeout, err.Error())
+		default:
+			r.writeError(w, req, http.StatusBadGateway, err.Error())
+		}
+	}
+}
+
+// Authorized wraps h with the same access control as the proxied API, for
+// endpoints served outside the route table such as /metrics.
+func (r *RequestRouter) Authorized(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := strings.TrimPrefix(req.URL.Path, "/")
+		if !r.checkBrowser(w, req, path) {
+			return
+		}
+		if _, ok := r.authorize(w, req, path); !ok {
+			return
 		}
+		h.ServeHTTP(w, req)
+	})
+}
+
+// log returns the router logger tagged with the request's ID.
+func (r *RequestRouter) log(req *http.Request) *zerolog.Logger {
+	return requestid.Logger(req.Context(), r.logger)
+}
+
+func (r *RequestRouter) writeError(w http.ResponseWriter, req *http.Request, status int, message string) {
+	if err := types.WriteError(w, status, message); err != nil {
+		r.log(req).Error().Err(err).Msg("Failed to write error response")
+	}
+}
+
+// checkBrowser applies the browser guard, writing a 403 and returning false
+// when the request looks like it was made by another site. Probe endpoints
+// are left to orchestrators, whatever host name they use.
+func (r *RequestRouter) checkBrowser(w http.ResponseWriter, req *http.Request, path string) bool {
+	if probePath(path) {
+		return true
 	}
+	if err := r.browser.check(req); err != nil {
+		r.log(req).Warn().
+			Err(err).
+			Str("remote_addr", req.RemoteAddr).
+			Str("path", req.URL.Path).
+			Msg("Rejected request from browser")
+		r.writeError(w, req, http.StatusForbidden, err.Error())
+		return false
+	}
+	return true
 }
 
-func (r *RequestRouter) handleJSONRequest(w http.ResponseWriter, req *http.Request, path string) {
-	var taskRequest task.Request
-	if err := types.ReadJSONBody(req.Body, &taskRequest); err != nil {
-		r.logger.Error().Err(err).Msg("Failed to decode request body")
-		if writeErr := types.WriteError(w, http.StatusBadRequest, "Invalid request body"); writeErr != nil {
-			r.logger.Error().Err(writeErr).Msg("Failed to write error response")
+// authorize applies local access control, writing a 401 or 403 and
+// returning false when the caller is rejected. It returns the presented
+// token, if any. Probe endpoints stay open so orchestrators can check
+// liveness without a token.
+func (r *RequestRouter) authorize(w http.ResponseWriter, req *http.Request, path string) (*localauth.Token, bool) {
+	if r.auth == nil || probePath(path) {
+		return nil, true
+	}
+
+	token, err := r.auth.Authorize(req)
+	if err != nil {
+		r.log(req).Warn().
+			Err(err).
+			Str("remote_addr", req.RemoteAddr).
+			Str("path", req.URL.Path).
+			Msg("Rejected unauthorized request")
+
+		status := http.StatusUnauthorized
+		if errors.Is(err, localauth.ErrIPNotAllowed) {
+			status = http.StatusForbidden
+		} else {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="parity-client"`)
 		}
+		r.writeError(w, req, status, err.Error())
+		return nil, false
+	}
+
+	if token != nil {
+		// The local token must never reach the runner.
+		req.Header.Del("Authorization")
+		r.log(req).Debug().Str("token_id", token.ID).Str("token_name", token.Name).Msg("Authenticated request")
+	}
+
+	return token, true
+}
+
+// probePath reports whether path is one of the liveness and readiness
+// endpoints that stay open without a token.
+func probePath(path string) bool {
+	switch path {
+	case "health", "health/live", "health/ready":
+		return true
+	}
+	return false
+}
+
+func (r *RequestRouter) handleCreateTask(w http.ResponseWriter, req *http.Request, _ map[string]string) {
+	taskRequest, upload, ok := r.readTaskRequest(w, req)
+	if !ok {
 		return
 	}
 
-	if err := r.taskHandler.ValidateAndProcessTask(w, &taskRequest); err != nil {
-		r.logger.Error().Err(err).Msg("Failed to process task")
-		if writeErr := types.WriteError(w, http.StatusBadRequest, err.Error()); writeErr != nil {
-			r.logger.Error().Err(writeErr).Msg("Failed to write error response")
+	// Build context directories and input paths let the caller read files
+	// on the proxy host, so remote callers have to upload theirs.
+	if taskRequest.Build != nil && taskRequest.Build.Context != "" {
+		if err := hostPathAccess(req); err != nil {
+			r.writeError(w, req, http.StatusForbidden, "build contexts on the proxy host "+err.Error()+"; upload the context instead")
+			return
+		}
+	}
+	if hasLocalInputs(taskRequest) {
+		if err := hostPathAccess(req); err != nil {
+			r.writeError(w, req, http.StatusForbidden, "input paths on the proxy host "+err.Error()+"; upload the inputs to IPFS and pass their CIDs instead")
+			return
 		}
+	}
+
+	key := req.Header.Get(idempotency.Header)
+	if key == "" {
+		r.createTask(w, req, taskRequest, upload)
 		return
 	}
+
+	var fingerprint interface{} = taskRequest
+	if upload != nil {
+		fingerprint = struct {
+			Task    *task.Request `json:"task"`
+			Context string        `json:"context_sha256"`
+		}{taskRequest, upload.Digest()}
+	}
+
+	handled := false
+	r.withIdempotencyKey(w, req, key, fingerprint, func(w http.ResponseWriter) {
+		handled = true
+		r.createTask(w, req, taskRequest, upload)
+	})
+	if !handled && upload != nil {
+		_ = upload.Close()
+	}
 }
 
-func (r *RequestRouter) handleHealthEndpoints(w http.ResponseWriter, req *http.Request, path string) bool {
-	switch path {
-	case "health":
-		if req.Method == "GET" {
-			r.healthHandler.HandleHealthCheck(w, req)
+// hostPathAccess reports why the caller may not have the proxy read files on
+// its host, or nil when it may. Loopback alone is not enough, since any web
+// page open in the user's browser can reach it with a form post: the caller
+// has to be on the Unix socket or present an API token, and a browser must
+// not mark the request as coming from another site.
+func hostPathAccess(req *http.Request) error {
+	if !localauth.IsLocal(req) {
+		return errors.New("are only available to local callers")
+	}
+	if origin := req.Header.Get("Origin"); origin != "" && !strings.EqualFold(origin, ownOrigin(req)) {
+		return fmt.Errorf("are not available to pages from %s", origin)
+	}
+	switch req.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+	default:
+		return errors.New("are not available to pages from other sites")
+	}
+	if !localauth.ViaUnixSocket(req) && tokenFromContext(req.Context()) == nil {
+		return errors.New("require an API token or the Unix socket")
+	}
+	return nil
+}
+
+// hasLocalInputs reports whether taskRequest reads input files from the
+// proxy host.
+func hasLocalInputs(taskRequest *task.Request) bool {
+	for _, input := range taskRequest.Inputs {
+		if input.Path != "" {
 			return true
 		}
-	case "health/detailed":
-		if req.Method == "GET" {
-			r.healthHandler.HandleDetailedHealthCheck(w, req)
-			return true
+	}
+	return false
+}
+
+// readTaskRequest decodes a task submission: a JSON body, or a multipart
+// form with the request as JSON in its task field and a build context tar
+// in its context file. It writes the error response itself and returns
+// false when the body is unusable.
+func (r *RequestRouter) readTaskRequest(w http.ResponseWriter, req *http.Request) (*task.Request, *service.BuildContext, bool) {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		var taskRequest task.Request
+		if err := types.ReadJSONBody(req.Body, &taskRequest); err != nil {
+			r.writeTaskBodyError(w, req, err)
+			return nil, nil, false
 		}
-	case "health/ready":
-		if req.Method == "GET" {
-			r.healthHandler.HandleReadinessCheck(w, req)
-			return true
+		return &taskRequest, nil, true
+	case "multipart/form-data":
+	default:
+		r.writeError(w, req, http.StatusUnsupportedMediaType, "task creation requires an application/json or multipart/form-data body")
+		return nil, nil, false
+	}
+
+	reader, err := req.MultipartReader()
+	if err != nil {
+		r.writeTaskBodyError(w, req, err)
+		return nil, nil, false
+	}
+
+	var taskRequest *task.Request
+	var upload *service.BuildContext
+	fail := func(err error) (*task.Request, *service.BuildContext, bool) {
+		if upload != nil {
+			_ = upload.Close()
 		}
-	case "health/live":
-		if req.Method == "GET" {
-			r.healthHandler.HandleLivenessCheck(w, req)
-			return true
+		r.writeTaskBodyError(w, req, err)
+		return nil, nil, false
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fail(err)
+		}
+
+		switch part.FormName() {
+		case "task":
+			taskRequest = &task.Request{}
+			if err := json.NewDecoder(io.LimitReader(part, r.bodyLimits.json)).Decode(taskRequest); err != nil {
+				return fail(err)
+			}
+		case "context":
+			if upload != nil {
+				return fail(errors.New("more than one build context"))
+			}
+			if upload, err = service.NewBuildContextFromArchive(part); err != nil {
+				return fail(err)
+			}
 		}
 	}
-	return false
+
+	if taskRequest == nil {
+		return fail(errors.New("missing task field"))
+	}
+	return taskRequest, upload, true
+}
+
+func (r *RequestRouter) writeTaskBodyError(w http.ResponseWriter, req *http.Request, err error) {
+	if limit, ok := bodyTooLarge(err); ok {
+		r.writeBodyTooLarge(w, req, limit)
+		return
+	}
+	r.log(req).Error().Err(err).Msg("Failed to decode request body")
+	r.writeError(w, req, http.StatusBadRequest, "Invalid request body")
+}
+
+func (r *RequestRouter) createTask(w http.ResponseWriter, req *http.Request, taskRequest *task.Request, upload *service.BuildContext) {
+	if err := r.taskHandler.ValidateAndProcessTask(req.Context(), w, taskRequest, upload); err != nil {
+		r.log(req).Error().Err(err).Msg("Failed to process task")
+		r.writeError(w, req, http.StatusBadRequest, err.Error())
+	}
 }
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// routeHandler serves a locally handled route with its path parameters.
+type routeHandler func(w http.ResponseWriter, req *http.Request, params map[string]string)
+
+// route maps a path pattern and set of methods to a local handler, or to the
+// runner when handler is nil. A route without methods accepts every method,
+// which pass-through routes use so the runner decides what it supports.
+//
+// Patterns are matched against the request path with any leading "/" and
+// "api/" removed. A "{name}" segment matches exactly one path segment and is
+// exposed as a parameter; a trailing "*" matches any remaining segments.
+type route struct {
+	name    string
+	pattern string
+	methods []string
+	handler routeHandler
+}
+
+func (rt route) local() bool {
+	return rt.handler != nil
+}
+
+func (rt route) allows(method string) bool {
+	if len(rt.methods) == 0 {
+		return true
+	}
+	for _, m := range rt.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// match reports whether path matches the route pattern and returns the
+// captured parameters.
+func (rt route) match(path string) (map[string]string, bool) {
+	patternSegs := splitPath(rt.pattern)
+	pathSegs := splitPath(path)
+
+	var params map[string]string
+	for i, seg := range patternSegs {
+		if seg == "*" && i == len(patternSegs)-1 {
+			return params, true
+		}
+		if i >= len(pathSegs) {
+			return nil, false
+		}
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[seg[1:len(seg)-1]] = pathSegs[i]
+			continue
+		}
+		if seg != pathSegs[i] {
+			return nil, false
+		}
+	}
+
+	if len(patternSegs) != len(pathSegs) {
+		return nil, false
+	}
+	return params, true
+}
+
+// routeTable resolves requests against an ordered list of routes; the first
+// route whose pattern and method both match wins.
+type routeTable []route
+
+// lookup returns the matching route and its parameters. When the path is
+// known but no route accepts the method, it returns the allowed methods
+// instead; when the path is unknown, both results are empty.
+func (t routeTable) lookup(method, path string) (*route, map[string]string, []string) {
+	allowed := make(map[string]bool)
+	for i := range t {
+		params, ok := t[i].match(path)
+		if !ok {
+			continue
+		}
+		if t[i].allows(method) {
+			return &t[i], params, nil
+		}
+		for _, m := range t[i].methods {
+			allowed[m] = true
+		}
+	}
+
+	methods := make([]string, 0, len(allowed))
+	for m := range allowed {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	return nil, nil, methods
+}
+
+func splitPath(path string) []string {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hopHeaders are connection-scoped and must not be copied between the
+// runner and the caller.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, field := range strings.Split(h.Get("Connection"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			h.Del(field)
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
+
+// upgradeType returns the protocol a request or response asks to switch to,
+// or "" if it is not an upgrade.
+func upgradeType(h http.Header) string {
+	for _, field := range strings.Split(h.Get("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(field), "upgrade") {
+			return strings.ToLower(h.Get("Upgrade"))
+		}
+	}
+	return ""
+}
+
+// isStreamingResponse reports whether resp should be relayed as it arrives
+// instead of being buffered by the response writer: server-sent events, and
+// bodies of unknown length such as chunked log tails.
+func isStreamingResponse(resp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return mediaType == "text/event-stream" || resp.ContentLength < 0
+}
+
+// flushWriter flushes the underlying response after every write so streamed
+// events reach the caller immediately.
+type flushWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if err := f.rc.Flush(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// deadline cancels a context once a timeout elapses, unless stopped first.
+// Unlike context.WithTimeout it can be disarmed after a streamed response
+// or upgraded connection has been established.
+type deadline struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timer   *time.Timer
+	mu      sync.Mutex
+	expired bool
+}
+
+func newDeadline(parent context.Context, timeout time.Duration) *deadline {
+	d := &deadline{}
+	d.ctx, d.cancel = context.WithCancel(parent)
+	d.timer = time.AfterFunc(timeout, func() {
+		d.mu.Lock()
+		d.expired = true
+		d.mu.Unlock()
+		d.cancel()
+	})
+	return d
+}
+
+// Stop disarms the timer without cancelling the context.
+func (d *deadline) Stop() {
+	d.timer.Stop()
+}
+
+// Expired reports whether the timeout fired.
+func (d *deadline) Expired() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.expired
+}
+
+// Release stops the timer and cancels the context.
+func (d *deadline) Release() {
+	d.timer.Stop()
+	d.cancel()
+}
+
+// tunnel completes a protocol switch: it hijacks the caller's connection,
+// relays the runner's 101 response and then copies bytes in both directions
+// until either side closes.
+func tunnel(w http.ResponseWriter, resp *http.Response) error {
+	backend, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return fmt.Errorf("runner switched protocols without a writable connection")
+	}
+	defer backend.Close()
+
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return fmt.Errorf("failed to hijack connection for %s upgrade: %v", upgradeType(resp.Header), err)
+	}
+	defer conn.Close()
+
+	// Clear any read or write deadlines inherited from the HTTP server;
+	// upgraded connections live as long as both sides keep them open.
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return fmt.Errorf("failed to clear connection deadline: %v", err)
+	}
+
+	if err := writeSwitchingProtocols(buf.Writer, resp); err != nil {
+		return err
+	}
+
+	errc := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(backend, buf)
+		errc <- err
+	}()
+	go func() {
+		_, err := io.Copy(conn, backend)
+		errc <- err
+	}()
+
+	// The first direction to finish ends the tunnel; closing both ends via
+	// the deferred Close calls unblocks the other.
+	if err := <-errc; err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+func writeSwitchingProtocols(w *bufio.Writer, resp *http.Response) error {
+	if _, err := fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n", resp.StatusCode, http.StatusText(resp.StatusCode)); err != nil {
+		return err
+	}
+	if err := resp.Header.Write(w); err != nil {
+		return err
+	}
+	if _, err := w.WriteString("\r\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
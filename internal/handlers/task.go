@@ -1,41 +1,144 @@
 package handlers
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
 	"fmt"
 	"net/http"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/rs/zerolog"
 	"github.com/theblitlabs/gologger"
 	"github.com/theblitlabs/parity-client/internal/config"
 	"github.com/theblitlabs/parity-client/internal/docker/service"
+	"github.com/theblitlabs/parity-client/internal/imagecache"
+	"github.com/theblitlabs/parity-client/internal/imagepolicy"
+	"github.com/theblitlabs/parity-client/internal/jobs"
+	"github.com/theblitlabs/parity-client/internal/requestid"
 	"github.com/theblitlabs/parity-client/internal/task"
 	"github.com/theblitlabs/parity-client/internal/types"
+	"github.com/theblitlabs/parity-client/internal/upstream"
+	"github.com/theblitlabs/parity-client/internal/utils"
+	"github.com/theblitlabs/parity-client/pkg/requestsig"
+	"github.com/theblitlabs/parity-client/pkg/sealedsecret"
 )
 
+const uploadProgressStep = 256 << 20
+
+// ArtifactStore uploads task input files from the proxy host;
+// storage.BlockchainService implements it.
+type ArtifactStore interface {
+	UploadFile(ctx context.Context, filePath string) (string, error)
+	UploadDirectory(ctx context.Context, dirPath string) (string, error)
+}
+
 type TaskHandler struct {
 	config      *config.Config
 	deviceID    string
 	creatorAddr string
 	docker      *service.DockerService
-	logger      zerolog.Logger
+	jobs        *jobs.Queue
+	pool        *upstream.Pool
+	images      *imagecache.Cache
+	artifacts   ArtifactStore
+	policyPath  string
+	// encryptionKeys pins the key secrets are sealed to per upstream URL;
+	// tasks with secrets only go to upstreams listed here.
+	encryptionKeys map[string]*ecdsa.PublicKey
+	logger         zerolog.Logger
 }
 
-func NewTaskHandler(cfg *config.Config, deviceID, creatorAddr string) *TaskHandler {
+// NewTaskHandler creates a task handler that reads images from runtime,
+// submits tasks to an upstream chosen from pool and pins each task to the
+// upstream that accepted it. Task secrets are sealed to the key in
+// encryptionKeys for the chosen upstream's URL, and tasks that carry them
+// only go to upstreams with a key there. Input files on the proxy host are
+// uploaded to artifacts. Images are held to the image policy in the parity
+// config directory, reread for every task. Runner calls go over transport.
+func NewTaskHandler(cfg *config.Config, deviceID, creatorAddr string, signer *requestsig.Signer, runtime service.ContainerRuntime, jobQueue *jobs.Queue, pool *upstream.Pool, encryptionKeys map[string]*ecdsa.PublicKey, artifacts ArtifactStore, transport http.RoundTripper) (*TaskHandler, error) {
+	docker, err := service.NewDockerService(runtime, signer, transport)
+	if err != nil {
+		return nil, err
+	}
+
 	return &TaskHandler{
-		config:      cfg,
-		deviceID:    deviceID,
-		creatorAddr: creatorAddr,
-		docker:      service.NewDockerService(),
-		logger:      gologger.Get().With().Str("component", "task_handler").Logger(),
+		config:         cfg,
+		deviceID:       deviceID,
+		creatorAddr:    creatorAddr,
+		docker:         docker,
+		jobs:           jobQueue,
+		pool:           pool,
+		images:         imagecache.Default(),
+		artifacts:      artifacts,
+		policyPath:     imagepolicy.DefaultPath(),
+		encryptionKeys: encryptionKeys,
+		logger:         gologger.Get().With().Str("component", "task_handler").Logger(),
+	}, nil
+}
+
+// ParseEncryptionKeys parses RUNNER_ENCRYPTION_KEYS, a comma-separated list
+// of url=public-key pairs.
+func ParseEncryptionKeys(list string) (map[string]*ecdsa.PublicKey, error) {
+	keys := make(map[string]*ecdsa.PublicKey)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid entry %q: expected url=public-key", entry)
+		}
+		key, err := sealedsecret.ParsePublicKey(entry[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid key for %s: %w", entry[:i], err)
+		}
+		keys[strings.TrimSuffix(strings.TrimSpace(entry[:i]), "/")] = key
 	}
+	return keys, nil
 }
 
-func (h *TaskHandler) ValidateAndProcessTask(w http.ResponseWriter, req *task.Request) error {
+// ValidateAndProcessTask validates the request and queues the image build,
+// pull, save and upload as a local job, replying 202 with the job so the
+// caller can poll /api/local/jobs/{id} instead of waiting on the upload. The
+// job keeps the request ID carried by ctx. upload is a build context
+// uploaded with the request, or nil; the handler removes it once the job no
+// longer needs it.
+func (h *TaskHandler) ValidateAndProcessTask(ctx context.Context, w http.ResponseWriter, req *task.Request, upload *service.BuildContext) error {
+	queued := false
+	defer func() {
+		if upload != nil && !queued {
+			_ = upload.Close()
+		}
+	}()
+
 	if req.Title == "" {
 		return fmt.Errorf("title is required")
 	}
 
+	if err := validateImageSource(req, upload); err != nil {
+		return err
+	}
+	if req.Image != "" {
+		if err := utils.ValidateDockerImage(req.Image); err != nil {
+			return err
+		}
+
+		policy, err := imagepolicy.Load(h.policyPath)
+		if err != nil {
+			return types.WriteError(w, http.StatusInternalServerError, err.Error())
+		}
+		if violations := policy.CheckReference(req.Image); len(violations) > 0 {
+			policyErr := &imagepolicy.Error{Image: req.Image, Violations: violations}
+			return types.WriteViolations(w, http.StatusUnprocessableEntity, policyErr.Error(), policyErr.Messages())
+		}
+	}
+
 	taskData := map[string]interface{}{
 		"title":           req.Title,
 		"description":     req.Description,
@@ -44,31 +147,474 @@ func (h *TaskHandler) ValidateAndProcessTask(w http.ResponseWriter, req *task.Re
 		"device_id":       h.deviceID,
 		"creator_address": h.creatorAddr,
 	}
+	if err := validateEnvironment(req); err != nil {
+		return err
+	}
+	if len(req.Secrets) > 0 && len(h.encryptionKeys) == 0 {
+		return utils.ValidationError{Field: "secrets", Message: "no runner has a public key pinned in RUNNER_ENCRYPTION_KEYS, and secrets are only sealed to pinned keys"}
+	}
+	if len(req.Env) > 0 {
+		taskData["env"] = req.Env
+	}
+	if err := validateArtifacts(req); err != nil {
+		return err
+	}
+	if len(req.Outputs) > 0 {
+		taskData["outputs"] = req.Outputs
+	}
+	if req.ImageHash != "" {
+		taskData["image_hash"] = req.ImageHash
+	}
+	if req.Resources != nil {
+		resources, err := req.Resources.Normalize()
+		if err != nil {
+			return err
+		}
+		if resources != (service.ResourceConfig{}) {
+			taskData["resources"] = resources
+		}
+	}
+
+	id := requestid.FromContext(ctx)
+	job, err := h.jobs.Submit(req.Title, req.Image, func(ctx context.Context, handle *jobs.Handle) (string, error) {
+		ctx = requestid.WithContext(ctx, id)
+		if len(req.Inputs) > 0 {
+			inputs, err := h.stageInputs(ctx, handle, req.Inputs)
+			if err != nil {
+				return "", err
+			}
+			taskData["inputs"] = inputs
+		}
+		imageName := req.Image
+		if req.Build != nil {
+			built, err := h.buildImage(ctx, handle, req.Build, upload)
+			if err != nil {
+				return "", err
+			}
+			imageName = built
+			taskData["image"] = built
+		}
+		return h.processTask(ctx, handle, imageName, req.Build != nil, taskData, req.Secrets)
+	})
+	if err != nil {
+		if errors.Is(err, jobs.ErrQueueFull) || errors.Is(err, jobs.ErrQueueClosed) {
+			return types.WriteError(w, http.StatusServiceUnavailable, err.Error())
+		}
+		return fmt.Errorf("failed to queue task: %v", err)
+	}
+	queued = true
+
+	event := requestid.Logger(ctx, h.logger).Info().Str("job_id", job.ID)
+	if req.Build != nil {
+		event.Str("dockerfile", req.Build.Dockerfile).Msg("Queued Docker image build request")
+	} else {
+		event.Str("image", req.Image).Msg("Queued Docker image request")
+	}
+
+	w.Header().Set("Location", "/api/local/jobs/"+job.ID)
+	return types.WriteJSON(w, http.StatusAccepted, job)
+}
+
+// validateEnvironment checks the names in env and secrets, which become
+// environment variables of the same name, so they must not overlap.
+func validateEnvironment(req *task.Request) error {
+	for name := range req.Env {
+		if err := utils.ValidateEnvName("env", name); err != nil {
+			return err
+		}
+	}
+
+	for name, value := range req.Secrets {
+		if err := utils.ValidateEnvName("secrets", name); err != nil {
+			return err
+		}
+		if _, ok := req.Env[name]; ok {
+			return utils.ValidationError{Field: "secrets", Message: fmt.Sprintf("%s is set in both env and secrets", name)}
+		}
+		if len(value) > utils.MaxSecretSize {
+			return utils.ValidationError{Field: "secrets", Message: fmt.Sprintf("%s is too large (max %d bytes)", name, utils.MaxSecretSize)}
+		}
+	}
+	return nil
+}
+
+// validateArtifacts checks the inputs and outputs of req and cleans their
+// paths. Every input needs exactly one of a path on the proxy host and a
+// CID, and no two inputs may share a mount path, nor two outputs a path.
+func validateArtifacts(req *task.Request) error {
+	mounts := make(map[string]bool, len(req.Inputs))
+	for i := range req.Inputs {
+		input := &req.Inputs[i]
+		switch {
+		case input.Path != "" && input.CID != "":
+			return utils.ValidationError{Field: "inputs", Message: "an input takes either a path or a CID, not both"}
+		case input.Path == "" && input.CID == "":
+			return utils.ValidationError{Field: "inputs", Message: "an input needs a path or a CID"}
+		case input.Path != "":
+			if !filepath.IsAbs(input.Path) {
+				return utils.ValidationError{Field: "inputs", Message: fmt.Sprintf("input path %q must be absolute", input.Path)}
+			}
+		default:
+			if err := utils.ValidateCID("inputs", input.CID); err != nil {
+				return err
+			}
+		}
+
+		mount, err := utils.ValidateContainerPath("inputs", input.Mount)
+		if err != nil {
+			return err
+		}
+		if mounts[mount] {
+			return utils.ValidationError{Field: "inputs", Message: fmt.Sprintf("%s is mounted more than once", mount)}
+		}
+		mounts[mount] = true
+		input.Mount = mount
+	}
+
+	seen := make(map[string]bool, len(req.Outputs))
+	for i, output := range req.Outputs {
+		cleaned, err := utils.ValidateContainerPath("outputs", output)
+		if err != nil {
+			return err
+		}
+		if seen[cleaned] {
+			return utils.ValidationError{Field: "outputs", Message: fmt.Sprintf("%s is listed more than once", cleaned)}
+		}
+		seen[cleaned] = true
+		req.Outputs[i] = cleaned
+	}
+	return nil
+}
+
+// validateImageSource checks that req names exactly one of an image and a
+// build, and that a build has exactly one context.
+func validateImageSource(req *task.Request, upload *service.BuildContext) error {
+	if req.Build == nil {
+		if upload != nil {
+			return fmt.Errorf("an uploaded build context requires build options")
+		}
+		if req.Image == "" {
+			return fmt.Errorf("image or build is required")
+		}
+		return nil
+	}
 
-	if req.Image == "" {
-		return fmt.Errorf("image is required")
+	if req.Image != "" {
+		return fmt.Errorf("image and build cannot both be set")
 	}
 
-	h.logger.Info().
-		Str("image", req.Image).
+	switch {
+	case req.Build.Context != "" && upload != nil:
+		return fmt.Errorf("build context must be either a directory or an uploaded archive, not both")
+	case req.Build.Context == "" && upload == nil:
+		return fmt.Errorf("build context is required")
+	case req.Build.Context != "" && !filepath.IsAbs(req.Build.Context):
+		return fmt.Errorf("build context must be an absolute path")
+	}
+
+	if dockerfile := req.Build.Dockerfile; dockerfile != "" {
+		cleaned := path.Clean(filepath.ToSlash(dockerfile))
+		if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return fmt.Errorf("dockerfile must be a path inside the build context")
+		}
+		req.Build.Dockerfile = cleaned
+	}
+	return nil
+}
+
+// stageInputs uploads the inputs given as paths on the proxy host to IPFS
+// and returns every input as a CID and mount path for the runner.
+func (h *TaskHandler) stageInputs(ctx context.Context, handle *jobs.Handle, inputs []task.Input) ([]task.Input, error) {
+	staged := make([]task.Input, 0, len(inputs))
+	for _, input := range inputs {
+		if input.Path == "" {
+			staged = append(staged, task.Input{CID: input.CID, Mount: input.Mount})
+			continue
+		}
+
+		handle.SetPhase(jobs.PhaseStaging)
+		info, err := os.Stat(input.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input %s: %v", input.Path, err)
+		}
+
+		var cid string
+		if info.IsDir() {
+			cid, err = h.artifacts.UploadDirectory(ctx, input.Path)
+		} else {
+			cid, err = h.artifacts.UploadFile(ctx, input.Path)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload input %s: %v", input.Path, err)
+		}
+
+		requestid.Logger(ctx, h.logger).Info().
+			Str("job_id", handle.ID()).
+			Str("path", input.Path).
+			Str("cid", cid).
+			Str("mount", input.Mount).
+			Msg("Uploaded task input")
+		staged = append(staged, task.Input{CID: cid, Mount: input.Mount})
+	}
+	return staged, nil
+}
+
+// buildImage builds the task image from source and returns its content
+// derived name, recording the build output in the job log. The build
+// context is packed from the directory named by build unless one was
+// uploaded, and removed afterwards.
+func (h *TaskHandler) buildImage(ctx context.Context, handle *jobs.Handle, build *task.BuildRequest, buildContext *service.BuildContext) (string, error) {
+	handle.SetPhase(jobs.PhaseBuilding)
+
+	if buildContext == nil {
+		handle.AppendLog("Packing build context " + build.Context)
+		packed, err := service.NewBuildContextFromDir(build.Context, build.Dockerfile)
+		if err != nil {
+			return "", err
+		}
+		buildContext = packed
+	}
+	defer func() {
+		if err := buildContext.Close(); err != nil {
+			h.logger.Warn().Err(err).Str("job_id", handle.ID()).Msg("Failed to remove build context")
+		}
+	}()
+
+	opts := service.BuildOptions{
+		Dockerfile: build.Dockerfile,
+		Args:       build.Args,
+		Target:     build.Target,
+	}
+	opts.Tag = service.BuildTag(buildContext, opts)
+	handle.SetImage(opts.Tag)
+
+	if err := h.docker.BuildImage(ctx, opts, buildContext, handle.AppendLog); err != nil {
+		return "", fmt.Errorf("failed to build Docker image: %v", err)
+	}
+	return opts.Tag, nil
+}
+
+// processTask sends the task with imageName to a runner, by reference when
+// the runner already has the image and otherwise with the saved image.
+// built says the image was built from source for this task.
+func (h *TaskHandler) processTask(ctx context.Context, handle *jobs.Handle, imageName string, built bool, taskData map[string]interface{}, secrets task.Secrets) (string, error) {
+	log := requestid.Logger(ctx, h.logger).With().Str("job_id", handle.ID()).Logger()
+
+	log.Info().
+		Str("image", imageName).
 		Msg("Processing Docker image request")
 
-	if err := h.docker.EnsureImageExists(req.Image); err != nil {
-		return fmt.Errorf("failed to ensure Docker image exists: %v", err)
+	handle.SetPhase(jobs.PhasePulling)
+	if err := h.docker.EnsureImageExists(ctx, imageName); err != nil {
+		return "", fmt.Errorf("failed to ensure Docker image exists: %v", err)
 	}
 
-	tarFile, err := h.docker.SaveImage(req.Image)
+	if err := h.checkImagePolicy(ctx, handle, imageName, built); err != nil {
+		return "", err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	// A runner's key is only trusted when it is pinned: one fetched from the
+	// runner itself could come from whoever answers at its address.
+	var skip map[*upstream.Upstream]bool
+	if len(secrets) > 0 {
+		skip = h.unpinnedUpstreams()
+	}
+	target, err := h.pool.Pick(skip)
 	if err != nil {
-		return fmt.Errorf("failed to save Docker image: %v", err)
+		if len(secrets) > 0 {
+			return "", fmt.Errorf("no runner with a pinned encryption key available for upload: %v", err)
+		}
+		return "", fmt.Errorf("no runner available for upload: %v", err)
 	}
+	uploadURL := fmt.Sprintf("%s/api/v1/tasks", target.URL)
 
-	uploadURL := fmt.Sprintf("%s/api/v1/tasks", strings.TrimSuffix(h.config.Runner.ServerURL, "/"))
-	h.logger.Debug().Str("uploadURL", uploadURL).Msg("Uploading Docker image")
+	if len(secrets) > 0 {
+		if err := h.sealSecrets(target, secrets, taskData); err != nil {
+			return "", err
+		}
+		log.Info().Int("count", len(secrets)).Msg("Sealed task secrets to runner key")
+	}
 
-	if err := h.docker.UploadImage(tarFile, taskData, uploadURL); err != nil {
-		return fmt.Errorf("failed to upload Docker image: %v", err)
+	digest, err := h.docker.ImageDigest(ctx, imageName)
+	if err != nil {
+		log.Warn().Err(err).Str("image", imageName).Msg("Failed to read image digest, uploading the full image")
+	} else {
+		taskData["image_digest"] = digest
+		taskID, submitted, err := h.submitByReference(ctx, &log, target, uploadURL, digest, taskData)
+		if err != nil {
+			return "", fmt.Errorf("failed to submit task for existing image: %v", err)
+		}
+		if submitted {
+			target.Breaker().Success()
+			h.pool.Pin(taskID, target)
+			log.Info().Str("task_id", taskID).Str("image_digest", digest).Msg("Submitted task for image the runner already has")
+			return taskID, nil
+		}
 	}
 
-	h.logger.Info().Msg("Successfully processed and uploaded Docker image")
-	return types.WriteJSON(w, http.StatusCreated, taskData)
+	handle.SetPhase(jobs.PhaseSaving)
+	image, err := h.docker.SaveImage(ctx, imageName)
+	if err != nil {
+		return "", fmt.Errorf("failed to save Docker image: %v", err)
+	}
+	defer func() {
+		if closeErr := image.Close(); closeErr != nil {
+			log.Error().Err(closeErr).Str("image", imageName).Msg("Failed to close image stream")
+		}
+	}()
+
+	log.Debug().Str("uploadURL", uploadURL).Msg("Uploading Docker image")
+
+	handle.SetPhase(jobs.PhaseHashing)
+	logProgress := logUploadProgress(log, imageName)
+	uploading := false
+	progress := func(bytesSent int64) {
+		if !uploading {
+			uploading = true
+			handle.SetPhase(jobs.PhaseUploading)
+		}
+		handle.SetBytesUploaded(bytesSent)
+		logProgress(bytesSent)
+	}
+
+	taskID, err := h.docker.UploadImage(ctx, image, taskData, uploadURL, progress)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload Docker image: %v", err)
+	}
+	target.Breaker().Success()
+	h.pool.Pin(taskID, target)
+
+	if digest != "" {
+		if err := h.images.Add(target.URL, digest); err != nil {
+			log.Warn().Err(err).Msg("Failed to record uploaded image")
+		}
+	}
+
+	log.Info().Str("task_id", taskID).Msg("Successfully processed and uploaded Docker image")
+	return taskID, nil
+}
+
+// checkImagePolicy holds the local image to the image policy before any of
+// it reaches a runner, recording the rules it breaks on the job. Images
+// built from source are only held to the size and label rules, since their
+// names are generated here rather than chosen by the caller.
+func (h *TaskHandler) checkImagePolicy(ctx context.Context, handle *jobs.Handle, imageName string, built bool) error {
+	policy, err := imagepolicy.Load(h.policyPath)
+	if err != nil || policy == nil {
+		return err
+	}
+
+	var violations []imagepolicy.Violation
+	if !built {
+		violations = policy.CheckReference(imageName)
+	}
+	if policy.NeedsImage() {
+		info, err := h.docker.InspectImage(ctx, imageName)
+		if err != nil {
+			return fmt.Errorf("failed to inspect Docker image: %v", err)
+		}
+		violations = append(violations, policy.CheckImage(info)...)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	policyErr := &imagepolicy.Error{Image: imageName, Violations: violations}
+	handle.SetViolations(policyErr.Messages())
+	return policyErr
+}
+
+// submitByReference submits the task without its image when target already
+// has the image with digest, according to the local cache or the runner
+// itself. It reports false, so the caller uploads the image, when the runner
+// does not have it or cannot say.
+func (h *TaskHandler) submitByReference(ctx context.Context, log *zerolog.Logger, target *upstream.Upstream, uploadURL, digest string, taskData map[string]interface{}) (string, bool, error) {
+	cached := h.images.Has(target.URL, digest)
+	if !cached {
+		has, err := h.docker.RunnerHasImage(ctx, target.URL, digest)
+		if err != nil {
+			log.Debug().Err(err).Str("image_digest", digest).Msg("Could not check runner for image")
+			return "", false, nil
+		}
+		if !has {
+			return "", false, nil
+		}
+	}
+
+	taskID, err := h.docker.UploadTask(ctx, taskData, uploadURL)
+	if err != nil {
+		// The runner may have pruned an image the cache still lists.
+		var runnerErr *service.RunnerError
+		if errors.As(err, &runnerErr) && (runnerErr.StatusCode == http.StatusNotFound || runnerErr.StatusCode == http.StatusGone) {
+			log.Info().Str("image_digest", digest).Msg("Runner no longer has image, uploading it again")
+			if err := h.images.Remove(target.URL, digest); err != nil {
+				log.Warn().Err(err).Msg("Failed to forget uploaded image")
+			}
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	if !cached {
+		if err := h.images.Add(target.URL, digest); err != nil {
+			log.Warn().Err(err).Msg("Failed to record uploaded image")
+		}
+	}
+	return taskID, true, nil
+}
+
+// unpinnedUpstreams returns the upstreams without a key in encryptionKeys,
+// in the form Pick takes to skip them.
+func (h *TaskHandler) unpinnedUpstreams() map[*upstream.Upstream]bool {
+	skip := make(map[*upstream.Upstream]bool)
+	for _, u := range h.pool.Upstreams() {
+		if _, ok := h.encryptionKeys[u.URL]; !ok {
+			skip[u] = true
+		}
+	}
+	return skip
+}
+
+// sealSecrets encrypts each secret to target's pinned public key and adds
+// them to taskData as secrets, with the key they were sealed to as
+// secrets_public_key. Plaintext values never enter taskData, and nothing is
+// sealed for a runner without a pinned key.
+func (h *TaskHandler) sealSecrets(target *upstream.Upstream, secrets task.Secrets, taskData map[string]interface{}) error {
+	key, ok := h.encryptionKeys[target.URL]
+	if !ok {
+		return fmt.Errorf("no encryption key is pinned for runner %s in RUNNER_ENCRYPTION_KEYS", target.URL)
+	}
+
+	sealed := make(map[string]string, len(secrets))
+	for name, value := range secrets {
+		ciphertext, err := sealedsecret.Seal(key, name, []byte(value))
+		if err != nil {
+			return err
+		}
+		sealed[name] = ciphertext
+	}
+
+	taskData["secrets"] = sealed
+	taskData["secrets_public_key"] = sealedsecret.FormatPublicKey(key)
+	return nil
+}
+
+// logUploadProgress returns a ProgressFunc that logs every uploadProgressStep
+// bytes so long uploads remain visible without flooding the log.
+func logUploadProgress(log zerolog.Logger, image string) service.ProgressFunc {
+	var next int64 = uploadProgressStep
+	return func(bytesSent int64) {
+		if bytesSent < next {
+			return
+		}
+		next = (bytesSent/uploadProgressStep + 1) * uploadProgressStep
+		log.Info().
+			Str("image", image).
+			Int64("bytesSent", bytesSent).
+			Msg("Uploading Docker image")
+	}
 }
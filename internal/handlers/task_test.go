@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/theblitlabs/parity-client/internal/config"
+	"github.com/theblitlabs/parity-client/internal/docker/service"
+	"github.com/theblitlabs/parity-client/internal/imagecache"
+	"github.com/theblitlabs/parity-client/internal/jobs"
+	"github.com/theblitlabs/parity-client/internal/task"
+	"github.com/theblitlabs/parity-client/internal/upstream"
+	"github.com/theblitlabs/parity-client/internal/utils"
+	"github.com/theblitlabs/parity-client/pkg/imagehash"
+	"github.com/theblitlabs/parity-client/pkg/sealedsecret"
+)
+
+// fakeRunner is a runner server that records the tasks and images
+// submitted to it and reports images as present once they were uploaded.
+type fakeRunner struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	tasks  []map[string]interface{}
+	images [][]byte
+	stored map[string]bool
+}
+
+func newFakeRunner(t *testing.T) *fakeRunner {
+	t.Helper()
+	r := &fakeRunner{stored: make(map[string]bool)}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *fakeRunner) serve(w http.ResponseWriter, req *http.Request) {
+	switch {
+	case req.Method == http.MethodHead && strings.HasPrefix(req.URL.Path, "/api/v1/images/"):
+		r.mu.Lock()
+		stored := r.stored[strings.TrimPrefix(req.URL.Path, "/api/v1/images/")]
+		r.mu.Unlock()
+		if stored {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	case req.Method == http.MethodPost && req.URL.Path == "/api/v1/tasks":
+		taskData, image, err := readSubmission(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		r.mu.Lock()
+		r.tasks = append(r.tasks, taskData)
+		if image != nil {
+			r.images = append(r.images, image)
+			if hash, ok := taskData["image_hash"].(string); ok {
+				r.stored[hash] = true
+			}
+		}
+		r.mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"id":"task-1"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func readSubmission(req *http.Request) (map[string]interface{}, []byte, error) {
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var taskData map[string]interface{}
+	var image []byte
+	mr := multipart.NewReader(req.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch part.FormName() {
+		case "task":
+			if err := json.Unmarshal(data, &taskData); err != nil {
+				return nil, nil, err
+			}
+		case "image":
+			image = data
+		}
+	}
+	if taskData == nil {
+		return nil, nil, errors.New("no task part")
+	}
+	return taskData, image, nil
+}
+
+func (r *fakeRunner) received() ([]map[string]interface{}, [][]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tasks, r.images
+}
+
+// brokenSave is a FakeRuntime whose saved images break off after limit
+// bytes, as when the container engine fails part way through an export.
+type brokenSave struct {
+	*service.FakeRuntime
+	limit int64
+}
+
+func (b brokenSave) SaveImage(ctx context.Context, image string) (io.ReadCloser, error) {
+	rc, err := b.FakeRuntime.SaveImage(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(io.LimitReader(rc, b.limit), failingReader{}), rc}, nil
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("save broke off") }
+
+type taskTest struct {
+	handler *TaskHandler
+	runner  *fakeRunner
+	queue   *jobs.Queue
+}
+
+func newTaskTest(t *testing.T, rt service.ContainerRuntime) *taskTest {
+	t.Helper()
+	runner := newFakeRunner(t)
+
+	pool, err := upstream.NewPool(runner.URL, "", 0, 0, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue := jobs.NewQueue(1, 8, time.Hour)
+	queue.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = queue.Stop(ctx)
+	})
+
+	h, err := NewTaskHandler(&config.Config{}, "device-1", "0xcreator", nil, rt, queue, pool, map[string]*ecdsa.PublicKey{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	h.images = imagecache.New(filepath.Join(dir, "uploaded_images.json"))
+	h.policyPath = filepath.Join(dir, "image_policy.json")
+	return &taskTest{handler: h, runner: runner, queue: queue}
+}
+
+// process runs processTask for image as a job and returns the finished job.
+func (tt *taskTest) process(t *testing.T, image string, secrets task.Secrets) jobs.Job {
+	t.Helper()
+	taskData := map[string]interface{}{"title": "t", "image": image}
+	job, err := tt.queue.Submit("t", image, func(ctx context.Context, handle *jobs.Handle) (string, error) {
+		return tt.handler.processTask(ctx, handle, image, false, taskData, secrets)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tt.wait(t, job.ID)
+}
+
+func (tt *taskTest) wait(t *testing.T, id string) jobs.Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := tt.queue.Get(id); ok && job.Finished() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return jobs.Job{}
+}
+
+// savedImage returns the archive of an image built by a FakeRuntime from
+// contents.
+func savedImage(t *testing.T, image, contents string) []byte {
+	t.Helper()
+	rt := service.NewFakeRuntime()
+	ctx := context.Background()
+	if err := rt.BuildImage(ctx, service.BuildOptions{Tag: image}, strings.NewReader(contents), nil); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := rt.SaveImage(ctx, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestProcessTaskPullsAndUploads(t *testing.T) {
+	rt := service.NewFakeRuntime()
+	archive := savedImage(t, "python:3.12", "python")
+	rt.AddRemoteImage("python:3.12", archive)
+	tt := newTaskTest(t, rt)
+
+	job := tt.process(t, "python:3.12", nil)
+	if job.Phase != jobs.PhaseSubmitted || job.TaskID != "task-1" {
+		t.Fatalf("job = %+v, want submitted as task-1", job)
+	}
+	if job.BytesUploaded != int64(len(archive)) {
+		t.Errorf("BytesUploaded = %d, want %d", job.BytesUploaded, len(archive))
+	}
+	if pulls := rt.Pulls(); len(pulls) != 1 || pulls[0] != "python:3.12" {
+		t.Errorf("Pulls = %v, want [python:3.12]", pulls)
+	}
+
+	tasks, images := tt.runner.received()
+	if len(tasks) != 1 || len(images) != 1 || !bytes.Equal(images[0], archive) {
+		t.Fatalf("runner received %d tasks and %d images, want the task with its image", len(tasks), len(images))
+	}
+	hash, err := imagehash.Compute(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tasks[0]["image_hash"] != hash.Config || tasks[0]["image_digest"] != hash.Config {
+		t.Errorf("image_hash = %v, image_digest = %v; want %s", tasks[0]["image_hash"], tasks[0]["image_digest"], hash.Config)
+	}
+	if pinned := tt.handler.pool.Pinned("task-1"); pinned == nil || pinned.URL != tt.runner.URL {
+		t.Errorf("task-1 is not pinned to the runner")
+	}
+}
+
+func TestProcessTaskSkipsUploadForStoredImage(t *testing.T) {
+	rt := service.NewFakeRuntime()
+	rt.AddImage("app:1", savedImage(t, "app:1", "app"))
+	tt := newTaskTest(t, rt)
+
+	for i := 0; i < 2; i++ {
+		if job := tt.process(t, "app:1", nil); job.Phase != jobs.PhaseSubmitted {
+			t.Fatalf("job %d = %+v, want submitted", i+1, job)
+		}
+	}
+
+	tasks, images := tt.runner.received()
+	if len(tasks) != 2 || len(images) != 1 {
+		t.Fatalf("runner received %d tasks and %d images, want 2 tasks and 1 image", len(tasks), len(images))
+	}
+}
+
+func TestProcessTaskImageNotFound(t *testing.T) {
+	tt := newTaskTest(t, service.NewFakeRuntime())
+
+	job := tt.process(t, "missing:1", nil)
+	if job.Phase != jobs.PhaseFailed || !strings.Contains(job.Error, "no such image") {
+		t.Fatalf("job = %+v, want failed for a missing image", job)
+	}
+	if tasks, _ := tt.runner.received(); len(tasks) != 0 {
+		t.Errorf("runner received %d tasks, want none", len(tasks))
+	}
+}
+
+func TestProcessTaskSaveFailsMidStream(t *testing.T) {
+	rt := brokenSave{FakeRuntime: service.NewFakeRuntime(), limit: 512}
+	rt.AddImage("app:1", savedImage(t, "app:1", strings.Repeat("x", 4096)))
+	tt := newTaskTest(t, rt)
+
+	job := tt.process(t, "app:1", nil)
+	if job.Phase != jobs.PhaseFailed || !strings.Contains(job.Error, "save broke off") {
+		t.Fatalf("job = %+v, want failed by the broken save", job)
+	}
+	if tasks, _ := tt.runner.received(); len(tasks) != 0 {
+		t.Errorf("runner accepted %d tasks from a broken upload", len(tasks))
+	}
+	if tt.handler.pool.Pinned("task-1") != nil {
+		t.Error("a task was pinned for a broken upload")
+	}
+}
+
+func TestProcessTaskImagePolicy(t *testing.T) {
+	rt := service.NewFakeRuntime()
+	rt.AddImage("app:latest", savedImage(t, "app:latest", "app"))
+	tt := newTaskTest(t, rt)
+	policy := `{"mutable_tag_rule": "forbid", "required_labels": {"team": ""}}`
+	if err := os.WriteFile(tt.handler.policyPath, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	job := tt.process(t, "app:latest", nil)
+	if job.Phase != jobs.PhaseFailed || len(job.Violations) != 2 {
+		t.Fatalf("job = %+v, want failed with 2 violations", job)
+	}
+	if tasks, _ := tt.runner.received(); len(tasks) != 0 {
+		t.Errorf("runner received %d tasks, want none", len(tasks))
+	}
+}
+
+func TestProcessTaskSealsSecretsToPinnedKey(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := service.NewFakeRuntime()
+	rt.AddImage("app:1", savedImage(t, "app:1", "app"))
+	tt := newTaskTest(t, rt)
+	tt.handler.encryptionKeys[tt.runner.URL] = &key.PublicKey
+
+	job := tt.process(t, "app:1", task.Secrets{"API_TOKEN": "s3cret"})
+	if job.Phase != jobs.PhaseSubmitted {
+		t.Fatalf("job = %+v, want submitted", job)
+	}
+
+	tasks, _ := tt.runner.received()
+	sealed, _ := tasks[0]["secrets"].(map[string]interface{})
+	ciphertext, _ := sealed["API_TOKEN"].(string)
+	value, err := sealedsecret.Open(key, "API_TOKEN", ciphertext)
+	if err != nil || string(value) != "s3cret" {
+		t.Fatalf("secret opened as %q, %v; want s3cret", value, err)
+	}
+	if tasks[0]["secrets_public_key"] != sealedsecret.FormatPublicKey(&key.PublicKey) {
+		t.Errorf("secrets_public_key = %v", tasks[0]["secrets_public_key"])
+	}
+}
+
+func TestProcessTaskNeedsPinnedKeyForSecrets(t *testing.T) {
+	rt := service.NewFakeRuntime()
+	rt.AddImage("app:1", savedImage(t, "app:1", "app"))
+	tt := newTaskTest(t, rt)
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt.handler.encryptionKeys["http://other-runner:8080"] = &other.PublicKey
+
+	job := tt.process(t, "app:1", task.Secrets{"API_TOKEN": "s3cret"})
+	if job.Phase != jobs.PhaseFailed || !strings.Contains(job.Error, "pinned encryption key") {
+		t.Fatalf("job = %+v, want failed for lack of a pinned key", job)
+	}
+	if tasks, _ := tt.runner.received(); len(tasks) != 0 {
+		t.Errorf("runner received %d tasks, want none", len(tasks))
+	}
+}
+
+func TestValidateAndProcessTaskRejectsSecretsWithoutKeys(t *testing.T) {
+	tt := newTaskTest(t, service.NewFakeRuntime())
+
+	req := &task.Request{Title: "t", Image: "app:1", Secrets: task.Secrets{"API_TOKEN": "s3cret"}}
+	err := tt.handler.ValidateAndProcessTask(context.Background(), httptest.NewRecorder(), req, nil)
+	var validationErr utils.ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Field != "secrets" {
+		t.Fatalf("ValidateAndProcessTask error = %v, want a secrets validation error", err)
+	}
+}
+
+func TestValidateAndProcessTaskBuildsUploadedContext(t *testing.T) {
+	rt := service.NewFakeRuntime()
+	tt := newTaskTest(t, rt)
+
+	var contextTar bytes.Buffer
+	tw := tar.NewWriter(&contextTar)
+	dockerfile := []byte("FROM scratch\nCOPY . /\n")
+	if err := tw.WriteHeader(&tar.Header{Name: "Dockerfile", Mode: 0o644, Size: int64(len(dockerfile))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(dockerfile); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	upload, err := service.NewBuildContextFromArchive(&contextTar)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &task.Request{Title: "t", Build: &task.BuildRequest{Dockerfile: "Dockerfile"}}
+	w := httptest.NewRecorder()
+	if err := tt.handler.ValidateAndProcessTask(context.Background(), w, req, upload); err != nil {
+		t.Fatalf("ValidateAndProcessTask: %v", err)
+	}
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	var queued jobs.Job
+	if err := json.Unmarshal(w.Body.Bytes(), &queued); err != nil {
+		t.Fatal(err)
+	}
+	job := tt.wait(t, queued.ID)
+	if job.Phase != jobs.PhaseSubmitted || !job.HasLog {
+		t.Fatalf("job = %+v, want submitted with a build log", job)
+	}
+	if !strings.HasPrefix(job.Image, service.BuildRepository+":") {
+		t.Errorf("job image = %s, want a %s tag", job.Image, service.BuildRepository)
+	}
+
+	builds := rt.Builds()
+	if len(builds) != 1 || builds[0].Tag != job.Image {
+		t.Fatalf("builds = %+v, want one build of %s", builds, job.Image)
+	}
+	tasks, images := tt.runner.received()
+	if len(tasks) != 1 || len(images) != 1 || tasks[0]["image"] != job.Image {
+		t.Fatalf("runner received %d tasks and %d images, want the built image", len(tasks), len(images))
+	}
+}
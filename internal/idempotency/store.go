@@ -0,0 +1,331 @@
+// Package idempotency remembers responses to requests sent with an
+// Idempotency-Key header so that a retried request is answered with the
+// original response instead of being processed again.
+package idempotency
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/theblitlabs/parity-client/internal/utils"
+)
+
+const (
+	Header          = "Idempotency-Key"
+	DefaultFileName = "idempotency_keys.json"
+	DefaultWindow   = 24 * time.Hour
+	maxKeyLength    = 255
+
+	// secretExt replaces the store file's extension to name the file
+	// holding the fingerprint secret.
+	secretExt  = ".secret"
+	secretSize = 32
+)
+
+var (
+	ErrInvalidKey = fmt.Errorf("%s must be 1-%d printable ASCII characters", Header, maxKeyLength)
+	ErrConflict   = fmt.Errorf("%s was already used with a different request", Header)
+	ErrInProgress = fmt.Errorf("a request with this %s is still being processed", Header)
+)
+
+// Response is a stored reply, replayed verbatim for repeats of its request.
+// JobID names the local job the reply points to while the job runs; it is
+// not part of the reply.
+type Response struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   []byte            `json:"body"`
+	JobID  string            `json:"job_id,omitempty"`
+}
+
+type record struct {
+	Scope       string    `json:"scope"`
+	Key         string    `json:"key"`
+	Fingerprint string    `json:"fingerprint"`
+	Response    Response  `json:"response"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Store persists completed responses in a JSON file next to the keystore and
+// tracks requests that are still being processed in memory. Keys are scoped
+// per caller and expire after the configured window. Request fingerprints
+// are keyed with a random secret kept beside the file, such as
+// idempotency_keys.secret, so the stored fingerprints reveal nothing about
+// the requests, not even whether a guessed request was sent.
+type Store struct {
+	path   string
+	window time.Duration
+
+	mu      sync.Mutex
+	loaded  bool
+	secret  []byte
+	records map[string]record
+	pending map[string]string
+}
+
+// NewStore returns a Store backed by path. A non-positive window uses
+// DefaultWindow.
+func NewStore(path string, window time.Duration) *Store {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &Store{
+		path:    path,
+		window:  window,
+		records: make(map[string]record),
+		pending: make(map[string]string),
+	}
+}
+
+// DefaultStore returns the Store at ~/.parity/idempotency_keys.json.
+func DefaultStore(window time.Duration) *Store {
+	return NewStore(filepath.Join(utils.GetParityConfigDir(), DefaultFileName), window)
+}
+
+// ValidKey reports whether key is acceptable as an Idempotency-Key.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Fingerprint returns an HMAC-SHA256 of v's JSON encoding under the store's
+// secret, so that repeats can be compared with the request that first used
+// a key.
+func (s *Store) Fingerprint(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to fingerprint request: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.loadLocked(); err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// Begin looks up key for the caller identified by scope. It returns the
+// stored response when the request was already completed, ErrConflict when
+// the key was used with a different fingerprint and ErrInProgress when the
+// first request has not finished yet. Otherwise the key is reserved and the
+// caller must call Complete or Release.
+func (s *Store) Begin(scope, key, fingerprint string) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadLocked(); err != nil {
+		return nil, err
+	}
+
+	id := recordID(scope, key)
+	if rec, ok := s.records[id]; ok && time.Since(rec.CreatedAt) < s.window {
+		if rec.Fingerprint != fingerprint {
+			return nil, ErrConflict
+		}
+		resp := rec.Response
+		return &resp, nil
+	}
+
+	if pending, ok := s.pending[id]; ok {
+		if pending != fingerprint {
+			return nil, ErrConflict
+		}
+		return nil, ErrInProgress
+	}
+
+	s.pending[id] = fingerprint
+	return nil, nil
+}
+
+// Complete stores resp for a key reserved by Begin.
+func (s *Store) Complete(scope, key string, resp Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := recordID(scope, key)
+	fingerprint, ok := s.pending[id]
+	if !ok {
+		return errors.New("idempotency key was not reserved")
+	}
+	delete(s.pending, id)
+
+	s.records[id] = record{
+		Scope:       scope,
+		Key:         key,
+		Fingerprint: fingerprint,
+		Response:    resp,
+		CreatedAt:   time.Now().UTC(),
+	}
+	return s.saveLocked()
+}
+
+// Replace swaps the response stored for a completed key for resp, keeping
+// its fingerprint and expiry. It does nothing when the key has no stored
+// response.
+func (s *Store) Replace(scope, key string, resp Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := recordID(scope, key)
+	rec, ok := s.records[id]
+	if !ok {
+		return nil
+	}
+	rec.Response = resp
+	s.records[id] = rec
+	return s.saveLocked()
+}
+
+// Forget deletes the response stored for a completed key, so the next
+// request with the key is processed again.
+func (s *Store) Forget(scope, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := recordID(scope, key)
+	if _, ok := s.records[id]; !ok {
+		return nil
+	}
+	delete(s.records, id)
+	return s.saveLocked()
+}
+
+// Release drops a reservation without storing a response, so the request
+// can be retried with the same key.
+func (s *Store) Release(scope, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, recordID(scope, key))
+}
+
+func recordID(scope, key string) string {
+	return scope + "\x00" + key
+}
+
+// loadLocked reads the fingerprint secret and the stored records. When there
+// is no secret yet one is generated, and records fingerprinted before it
+// existed are discarded since they can no longer be matched.
+func (s *Store) loadLocked() error {
+	if s.loaded {
+		return nil
+	}
+
+	secret, created, err := loadSecret(s.secretPath())
+	if err != nil {
+		return err
+	}
+	s.secret = secret
+	if created {
+		s.loaded = true
+		if _, err := os.Stat(s.path); err == nil {
+			return s.saveLocked()
+		}
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.loaded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read idempotency store: %w", err)
+	}
+
+	var records []record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("failed to parse idempotency store: %w", err)
+	}
+
+	for _, rec := range records {
+		s.records[recordID(rec.Scope, rec.Key)] = rec
+	}
+	s.loaded = true
+	return nil
+}
+
+func (s *Store) secretPath() string {
+	return strings.TrimSuffix(s.path, filepath.Ext(s.path)) + secretExt
+}
+
+// loadSecret reads the secret at path, creating it when it does not exist.
+// It reports whether the secret was created.
+func loadSecret(path string) ([]byte, bool, error) {
+	secret, err := os.ReadFile(path)
+	if err == nil {
+		if len(secret) < secretSize {
+			return nil, false, fmt.Errorf("idempotency secret %s is too short", path)
+		}
+		return secret, false, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, false, fmt.Errorf("failed to read idempotency secret: %w", err)
+	}
+
+	secret = make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, false, fmt.Errorf("failed to generate idempotency secret: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, false, fmt.Errorf("failed to create idempotency store directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, secret, 0o600); err != nil {
+		return nil, false, fmt.Errorf("failed to write idempotency secret: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, false, fmt.Errorf("failed to replace idempotency secret: %w", err)
+	}
+	return secret, true, nil
+}
+
+// saveLocked drops expired records and rewrites the file.
+func (s *Store) saveLocked() error {
+	records := make([]record, 0, len(s.records))
+	for id, rec := range s.records {
+		if time.Since(rec.CreatedAt) >= s.window {
+			delete(s.records, id)
+			continue
+		}
+		records = append(records, rec)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create idempotency store directory: %w", err)
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency store: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write idempotency store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace idempotency store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package idempotency
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	return NewStore(filepath.Join(t.TempDir(), DefaultFileName), time.Hour)
+}
+
+func fingerprint(t *testing.T, s *Store, v interface{}) string {
+	t.Helper()
+	fp, err := s.Fingerprint(v)
+	if err != nil {
+		t.Fatalf("Fingerprint: %v", err)
+	}
+	return fp
+}
+
+func TestValidKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"3f2a9c1e-retry", true},
+		{strings.Repeat("k", maxKeyLength), true},
+		{"", false},
+		{strings.Repeat("k", maxKeyLength+1), false},
+		{"tab\tkey", false},
+		{"ключ", false},
+	}
+	for _, tt := range tests {
+		if got := ValidKey(tt.key); got != tt.want {
+			t.Errorf("ValidKey(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	s := newTestStore(t)
+	a := fingerprint(t, s, map[string]string{"secret": "value"})
+
+	if b := fingerprint(t, s, map[string]string{"secret": "value"}); a != b {
+		t.Error("the same request has different fingerprints")
+	}
+	if b := fingerprint(t, s, map[string]string{"secret": "other"}); a == b {
+		t.Error("different requests have the same fingerprint")
+	}
+
+	// Fingerprints are keyed per store, so they cannot be matched against
+	// guessed requests elsewhere.
+	if b := fingerprint(t, newTestStore(t), map[string]string{"secret": "value"}); a == b {
+		t.Error("two stores produce the same fingerprint")
+	}
+
+	info, err := os.Stat(s.secretPath())
+	if err != nil {
+		t.Fatalf("secret file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("secret file mode = %o, want 600", perm)
+	}
+}
+
+func TestBeginComplete(t *testing.T) {
+	s := newTestStore(t)
+	fp := fingerprint(t, s, "request")
+
+	resp, err := s.Begin("ip:127.0.0.1", "key-1", fp)
+	if err != nil || resp != nil {
+		t.Fatalf("first Begin = %v, %v; want nil, nil", resp, err)
+	}
+
+	if _, err := s.Begin("ip:127.0.0.1", "key-1", fp); !errors.Is(err, ErrInProgress) {
+		t.Errorf("Begin while in progress: error = %v, want %v", err, ErrInProgress)
+	}
+	if _, err := s.Begin("ip:127.0.0.1", "key-1", fingerprint(t, s, "other")); !errors.Is(err, ErrConflict) {
+		t.Errorf("Begin with another request while in progress: error = %v, want %v", err, ErrConflict)
+	}
+
+	stored := Response{Status: http.StatusAccepted, Header: map[string]string{"Location": "/api/local/jobs/j1"}, Body: []byte(`{"id":"j1"}`), JobID: "j1"}
+	if err := s.Complete("ip:127.0.0.1", "key-1", stored); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	resp, err = s.Begin("ip:127.0.0.1", "key-1", fp)
+	if err != nil {
+		t.Fatalf("Begin after Complete: %v", err)
+	}
+	if resp == nil || resp.Status != stored.Status || !bytes.Equal(resp.Body, stored.Body) || resp.JobID != "j1" {
+		t.Errorf("Begin after Complete = %+v, want %+v", resp, stored)
+	}
+
+	if _, err := s.Begin("ip:127.0.0.1", "key-1", fingerprint(t, s, "other")); !errors.Is(err, ErrConflict) {
+		t.Errorf("Begin with another request: error = %v, want %v", err, ErrConflict)
+	}
+
+	// Keys are scoped per caller.
+	if resp, err := s.Begin("token:abc", "key-1", fp); err != nil || resp != nil {
+		t.Errorf("Begin for another caller = %v, %v; want nil, nil", resp, err)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	s := newTestStore(t)
+	fp := fingerprint(t, s, "request")
+
+	if _, err := s.Begin("c", "k", fp); err != nil {
+		t.Fatal(err)
+	}
+	s.Release("c", "k")
+
+	if resp, err := s.Begin("c", "k", fp); err != nil || resp != nil {
+		t.Fatalf("Begin after Release = %v, %v; want nil, nil", resp, err)
+	}
+	if err := s.Complete("c", "other", Response{}); err == nil {
+		t.Error("Complete of an unreserved key succeeded")
+	}
+}
+
+func TestReplaceAndForget(t *testing.T) {
+	s := newTestStore(t)
+	fp := fingerprint(t, s, "request")
+
+	if _, err := s.Begin("c", "k", fp); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Complete("c", "k", Response{Status: http.StatusAccepted, JobID: "j1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Replace("c", "k", Response{Status: http.StatusOK, Body: []byte("done")}); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	resp, err := s.Begin("c", "k", fp)
+	if err != nil || resp == nil || resp.Status != http.StatusOK || string(resp.Body) != "done" {
+		t.Fatalf("Begin after Replace = %+v, %v", resp, err)
+	}
+
+	if err := s.Forget("c", "k"); err != nil {
+		t.Fatalf("Forget: %v", err)
+	}
+	if resp, err := s.Begin("c", "k", fp); err != nil || resp != nil {
+		t.Fatalf("Begin after Forget = %v, %v; want nil, nil", resp, err)
+	}
+
+	if err := s.Replace("c", "missing", Response{}); err != nil {
+		t.Errorf("Replace of an unknown key: %v", err)
+	}
+	if err := s.Forget("c", "missing"); err != nil {
+		t.Errorf("Forget of an unknown key: %v", err)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+	s := NewStore(path, time.Hour)
+	fp := fingerprint(t, s, "request")
+
+	if _, err := s.Begin("c", "k", fp); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Complete("c", "k", Response{Status: http.StatusCreated, Body: []byte("created")}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewStore(path, time.Hour)
+	if got := fingerprint(t, reopened, "request"); got != fp {
+		t.Fatal("fingerprint changed after reopening the store")
+	}
+	resp, err := reopened.Begin("c", "k", fp)
+	if err != nil || resp == nil || string(resp.Body) != "created" {
+		t.Fatalf("Begin after reopening = %+v, %v", resp, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(`"request"`)) {
+		t.Error("the store file contains the request")
+	}
+}
+
+func TestRecordsWithoutSecretAreDiscarded(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+	s := NewStore(path, time.Hour)
+	fp := fingerprint(t, s, "request")
+	if _, err := s.Begin("c", "k", fp); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Complete("c", "k", Response{Status: http.StatusCreated}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(s.secretPath()); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := NewStore(path, time.Hour)
+	if resp, err := reopened.Begin("c", "k", fingerprint(t, reopened, "request")); err != nil || resp != nil {
+		t.Fatalf("Begin with a new secret = %v, %v; want nil, nil", resp, err)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+	s := NewStore(path, time.Millisecond)
+	fp := fingerprint(t, s, "request")
+
+	if _, err := s.Begin("c", "k", fp); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Complete("c", "k", Response{Status: http.StatusCreated}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	if resp, err := s.Begin("c", "k", fp); err != nil || resp != nil {
+		t.Fatalf("Begin after expiry = %v, %v; want nil, nil", resp, err)
+	}
+}
+
+func TestShortSecretIsRejected(t *testing.T) {
+	s := newTestStore(t)
+	if err := os.WriteFile(s.secretPath(), []byte("short"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Fingerprint("request"); err == nil {
+		t.Fatal("Fingerprint succeeded with a short secret")
+	}
+}
@@ -0,0 +1,156 @@
+// Package imagecache remembers which image digests each runner upstream has
+// already received, so task submissions can refer to them instead of
+// uploading the image again.
+package imagecache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/theblitlabs/parity-client/internal/utils"
+)
+
+const (
+	DefaultFileName = "uploaded_images.json"
+
+	// maxPerUpstream bounds the file; the least recently used digests are
+	// dropped first.
+	maxPerUpstream = 500
+)
+
+// Cache persists digests per upstream URL in a JSON file next to the
+// keystore. An entry only says the image was delivered once; the runner
+// may since have removed it, so callers must be ready to upload anyway.
+type Cache struct {
+	path string
+
+	mu      sync.Mutex
+	loaded  bool
+	entries map[string]map[string]time.Time
+}
+
+// New returns a Cache backed by path.
+func New(path string) *Cache {
+	return &Cache{path: path, entries: make(map[string]map[string]time.Time)}
+}
+
+// Default returns the Cache at ~/.parity/uploaded_images.json.
+func Default() *Cache {
+	return New(filepath.Join(utils.GetParityConfigDir(), DefaultFileName))
+}
+
+// Has reports whether digest was recorded for upstream. A cache that cannot
+// be read is treated as empty.
+func (c *Cache) Has(upstream, digest string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.loadLocked(); err != nil {
+		return false
+	}
+	_, ok := c.entries[upstream][digest]
+	return ok
+}
+
+// Add records that upstream has digest.
+func (c *Cache) Add(upstream, digest string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.loadLocked(); err != nil {
+		return err
+	}
+
+	digests := c.entries[upstream]
+	if digests == nil {
+		digests = make(map[string]time.Time)
+		c.entries[upstream] = digests
+	}
+	digests[digest] = time.Now().UTC()
+	trim(digests)
+
+	return c.saveLocked()
+}
+
+// Remove forgets digest for upstream, after the runner turned out not to
+// have it.
+func (c *Cache) Remove(upstream, digest string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.loadLocked(); err != nil {
+		return err
+	}
+	if _, ok := c.entries[upstream][digest]; !ok {
+		return nil
+	}
+
+	delete(c.entries[upstream], digest)
+	return c.saveLocked()
+}
+
+func trim(digests map[string]time.Time) {
+	if len(digests) <= maxPerUpstream {
+		return
+	}
+
+	keys := make([]string, 0, len(digests))
+	for digest := range digests {
+		keys = append(keys, digest)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return digests[keys[i]].Before(digests[keys[j]])
+	})
+	for _, digest := range keys[:len(keys)-maxPerUpstream] {
+		delete(digests, digest)
+	}
+}
+
+func (c *Cache) loadLocked() error {
+	if c.loaded {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		c.loaded = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read image cache: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return fmt.Errorf("failed to parse image cache: %w", err)
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]map[string]time.Time)
+	}
+	c.loaded = true
+	return nil
+}
+
+func (c *Cache) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create image cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode image cache: %w", err)
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write image cache: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to replace image cache: %w", err)
+	}
+	return nil
+}
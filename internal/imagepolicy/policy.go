@@ -0,0 +1,305 @@
+// Package imagepolicy checks task images against the rules in
+// ~/.parity/image_policy.json before they are sent to a runner: which
+// registries images may come from, how mutable tags such as latest may be
+// used, how large an image may be and which labels it must carry.
+//
+// Reference rules only need the image name and are checked as soon as a
+// task is submitted; size and label rules need the local image and are
+// checked once it has been pulled or built.
+package imagepolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/theblitlabs/parity-client/internal/docker/service"
+	"github.com/theblitlabs/parity-client/internal/utils"
+)
+
+const (
+	DefaultFileName = "image_policy.json"
+
+	defaultRegistry = "docker.io"
+)
+
+// TagRule says how mutable tags may be used.
+type TagRule string
+
+const (
+	// TagsAllow accepts mutable tags. It is the default.
+	TagsAllow TagRule = "allow"
+	// TagsRequireDigest accepts a mutable tag only when the reference is
+	// also pinned to a digest, as in alpine:latest@sha256:...
+	TagsRequireDigest TagRule = "require_digest"
+	// TagsForbid rejects mutable tags, pinned or not.
+	TagsForbid TagRule = "forbid"
+)
+
+// Policy is the contents of the policy file. Empty fields impose nothing.
+//
+// AllowedRegistries lists registry hosts, optionally followed by a
+// repository prefix, such as ghcr.io or docker.io/library. MutableTags
+// lists the tags MutableTagRule applies to, latest when empty, and "*"
+// stands for every tag; a reference without tag or digest counts as
+// latest. MaxImageSize takes Docker's binary units, such as 2g, and is
+// compared with the size the container runtime reports. RequiredLabels
+// maps label names to the value they must have, or to "" when any value
+// will do.
+type Policy struct {
+	AllowedRegistries []string          `json:"allowed_registries,omitempty"`
+	MutableTags       []string          `json:"mutable_tags,omitempty"`
+	MutableTagRule    TagRule           `json:"mutable_tag_rule,omitempty"`
+	MaxImageSize      string            `json:"max_image_size,omitempty"`
+	RequiredLabels    map[string]string `json:"required_labels,omitempty"`
+
+	maxSize int64
+}
+
+// Violation is one rule an image breaks.
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (v Violation) String() string {
+	return v.Rule + ": " + v.Message
+}
+
+// Error lists every rule an image breaks.
+type Error struct {
+	Image      string
+	Violations []Violation
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("image %s violates the image policy: %s", e.Image, strings.Join(e.Messages(), "; "))
+}
+
+// Messages returns the violations as "rule: message" strings.
+func (e *Error) Messages() []string {
+	messages := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		messages[i] = v.String()
+	}
+	return messages
+}
+
+// DefaultPath returns ~/.parity/image_policy.json.
+func DefaultPath() string {
+	return filepath.Join(utils.GetParityConfigDir(), DefaultFileName)
+}
+
+// Load reads the policy at path. A missing file is not an error and
+// yields a nil Policy, which allows every image. Unknown fields are
+// rejected so a misspelt rule is not silently ignored.
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image policy %s: %w", path, err)
+	}
+
+	var p Policy
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid image policy %s: %w", path, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("invalid image policy %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	switch p.MutableTagRule {
+	case "":
+		p.MutableTagRule = TagsAllow
+	case TagsAllow, TagsRequireDigest, TagsForbid:
+	default:
+		return fmt.Errorf("mutable_tag_rule must be %s, %s or %s", TagsAllow, TagsRequireDigest, TagsForbid)
+	}
+
+	if len(p.MutableTags) == 0 {
+		p.MutableTags = []string{"latest"}
+	}
+
+	for i, registry := range p.AllowedRegistries {
+		registry = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(registry), "/"))
+		if registry == "" {
+			return fmt.Errorf("allowed_registries contains an empty entry")
+		}
+		p.AllowedRegistries[i] = registry
+	}
+
+	if p.MaxImageSize != "" {
+		size, err := utils.ParseMemory(p.MaxImageSize)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("max_image_size %q must be a size such as 512m or 2g", p.MaxImageSize)
+		}
+		p.maxSize = size
+	}
+	return nil
+}
+
+// CheckReference applies the registry and mutable tag rules to image.
+func (p *Policy) CheckReference(image string) []Violation {
+	if p == nil {
+		return nil
+	}
+
+	ref := parseReference(image)
+	var violations []Violation
+
+	if len(p.AllowedRegistries) > 0 && !p.registryAllowed(ref) {
+		violations = append(violations, Violation{
+			Rule:    "allowed_registries",
+			Message: fmt.Sprintf("%s/%s is not from an allowed registry (%s)", ref.domain, ref.path, strings.Join(p.AllowedRegistries, ", ")),
+		})
+	}
+
+	if p.MutableTagRule != TagsAllow && ref.tag != "" && p.mutable(ref.tag) {
+		switch {
+		case p.MutableTagRule == TagsForbid:
+			violations = append(violations, Violation{
+				Rule:    "mutable_tag_rule",
+				Message: fmt.Sprintf("mutable tag %q is forbidden; use a fixed tag or a digest", ref.tag),
+			})
+		case ref.digest == "":
+			violations = append(violations, Violation{
+				Rule:    "mutable_tag_rule",
+				Message: fmt.Sprintf("mutable tag %q must be pinned to a digest, as in %s@sha256:<digest>", ref.tag, image),
+			})
+		}
+	}
+	return violations
+}
+
+// NeedsImage reports whether the policy has size or label rules, which
+// need the local image to check.
+func (p *Policy) NeedsImage() bool {
+	return p != nil && (p.maxSize > 0 || len(p.RequiredLabels) > 0)
+}
+
+// CheckImage applies the size and label rules to the local image info
+// describes.
+func (p *Policy) CheckImage(info *service.ImageInfo) []Violation {
+	if p == nil {
+		return nil
+	}
+
+	var violations []Violation
+
+	if p.maxSize > 0 {
+		switch {
+		case info.Size <= 0:
+			violations = append(violations, Violation{
+				Rule:    "max_image_size",
+				Message: "the container runtime does not report the image size",
+			})
+		case info.Size > p.maxSize:
+			violations = append(violations, Violation{
+				Rule:    "max_image_size",
+				Message: fmt.Sprintf("image is %d bytes, larger than the %s (%d bytes) allowed", info.Size, p.MaxImageSize, p.maxSize),
+			})
+		}
+	}
+
+	names := make([]string, 0, len(p.RequiredLabels))
+	for name := range p.RequiredLabels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		want := p.RequiredLabels[name]
+		got, ok := info.Labels[name]
+		switch {
+		case !ok:
+			violations = append(violations, Violation{
+				Rule:    "required_labels",
+				Message: fmt.Sprintf("label %s is missing", name),
+			})
+		case want != "" && got != want:
+			violations = append(violations, Violation{
+				Rule:    "required_labels",
+				Message: fmt.Sprintf("label %s is %q, expected %q", name, got, want),
+			})
+		}
+	}
+	return violations
+}
+
+func (p *Policy) registryAllowed(ref reference) bool {
+	repo := ref.domain + "/" + ref.path
+	for _, allowed := range p.AllowedRegistries {
+		if allowed == ref.domain || allowed == repo || strings.HasPrefix(repo, allowed+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) mutable(tag string) bool {
+	for _, t := range p.MutableTags {
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// reference is an image reference split the way Docker resolves it.
+type reference struct {
+	domain string
+	path   string
+	tag    string
+	digest string
+}
+
+// parseReference splits image into its registry, repository path, tag and
+// digest. Like Docker, the first component is the registry only when it
+// looks like a host, and references without tag or digest mean latest.
+func parseReference(image string) reference {
+	var ref reference
+	name := strings.TrimSpace(image)
+
+	if i := strings.Index(name, "@"); i >= 0 {
+		ref.digest = name[i+1:]
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		ref.tag = name[i+1:]
+		name = name[:i]
+	}
+	if ref.tag == "" && ref.digest == "" {
+		ref.tag = "latest"
+	}
+
+	ref.domain = defaultRegistry
+	ref.path = name
+	if i := strings.Index(name, "/"); i >= 0 {
+		first := name[:i]
+		if strings.ContainsAny(first, ".:") || first == "localhost" {
+			ref.domain = strings.ToLower(first)
+			ref.path = name[i+1:]
+		}
+	}
+
+	switch ref.domain {
+	case "index.docker.io", "registry-1.docker.io":
+		ref.domain = defaultRegistry
+	}
+	if ref.domain == defaultRegistry && !strings.Contains(ref.path, "/") {
+		ref.path = "library/" + ref.path
+	}
+	return ref
+}
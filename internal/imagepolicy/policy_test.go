@@ -0,0 +1,213 @@
+package imagepolicy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/theblitlabs/parity-client/internal/docker/service"
+)
+
+func writePolicy(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DefaultFileName)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func loadPolicy(t *testing.T, contents string) *Policy {
+	t.Helper()
+	p, err := Load(writePolicy(t, contents))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	return p
+}
+
+func rules(violations []Violation) []string {
+	var names []string
+	for _, v := range violations {
+		names = append(names, v.Rule)
+	}
+	return names
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	p, err := Load(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || p != nil {
+		t.Fatalf("Load of a missing file = %v, %v; want nil, nil", p, err)
+	}
+
+	// A nil policy allows everything.
+	if v := p.CheckReference("anything:latest"); len(v) != 0 {
+		t.Errorf("nil policy CheckReference = %v", v)
+	}
+	if v := p.CheckImage(&service.ImageInfo{}); len(v) != 0 {
+		t.Errorf("nil policy CheckImage = %v", v)
+	}
+	if p.NeedsImage() {
+		t.Error("nil policy needs the image")
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+	}{
+		{"unknown field", `{"allowed_registry": ["ghcr.io"]}`},
+		{"bad tag rule", `{"mutable_tag_rule": "sometimes"}`},
+		{"empty registry", `{"allowed_registries": [" "]}`},
+		{"bad size", `{"max_image_size": "huge"}`},
+		{"not JSON", `allowed_registries: [ghcr.io]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writePolicy(t, tt.contents)); err == nil {
+				t.Fatal("Load succeeded")
+			}
+		})
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		image string
+		want  reference
+	}{
+		{"alpine", reference{domain: "docker.io", path: "library/alpine", tag: "latest"}},
+		{"python:3.12", reference{domain: "docker.io", path: "library/python", tag: "3.12"}},
+		{"org/app:1.4", reference{domain: "docker.io", path: "org/app", tag: "1.4"}},
+		{"index.docker.io/library/alpine:3", reference{domain: "docker.io", path: "library/alpine", tag: "3"}},
+		{"GHCR.io/org/app@sha256:abc", reference{domain: "ghcr.io", path: "org/app", digest: "sha256:abc"}},
+		{"localhost:5000/app:dev", reference{domain: "localhost:5000", path: "app", tag: "dev"}},
+		{"localhost/parity-build:1f2e", reference{domain: "localhost", path: "parity-build", tag: "1f2e"}},
+		{"alpine:latest@sha256:abc", reference{domain: "docker.io", path: "library/alpine", tag: "latest", digest: "sha256:abc"}},
+	}
+	for _, tt := range tests {
+		if got := parseReference(tt.image); got != tt.want {
+			t.Errorf("parseReference(%q) = %+v, want %+v", tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestAllowedRegistries(t *testing.T) {
+	p := loadPolicy(t, `{"allowed_registries": ["ghcr.io/org", "Docker.io/library/"]}`)
+
+	tests := []struct {
+		image   string
+		allowed bool
+	}{
+		{"ghcr.io/org/app:1", true},
+		{"ghcr.io/org/team/app:1", true},
+		{"ghcr.io/organisation/app:1", false},
+		{"ghcr.io/other/app:1", false},
+		{"alpine:3", true},
+		{"someone/alpine:3", false},
+		{"quay.io/org/app:1", false},
+	}
+	for _, tt := range tests {
+		violations := p.CheckReference(tt.image)
+		if got := len(violations) == 0; got != tt.allowed {
+			t.Errorf("CheckReference(%q) = %v, want allowed %v", tt.image, violations, tt.allowed)
+		}
+	}
+}
+
+func TestMutableTagRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		image  string
+		want   []string
+	}{
+		{"allow by default", `{}`, "alpine", nil},
+		{"require digest for latest", `{"mutable_tag_rule": "require_digest"}`, "alpine:latest", []string{"mutable_tag_rule"}},
+		{"untagged counts as latest", `{"mutable_tag_rule": "require_digest"}`, "alpine", []string{"mutable_tag_rule"}},
+		{"pinned latest", `{"mutable_tag_rule": "require_digest"}`, "alpine:latest@sha256:abc", nil},
+		{"digest only", `{"mutable_tag_rule": "forbid"}`, "alpine@sha256:abc", nil},
+		{"fixed tag", `{"mutable_tag_rule": "forbid"}`, "alpine:3.20", nil},
+		{"forbid pinned latest", `{"mutable_tag_rule": "forbid"}`, "alpine:latest@sha256:abc", []string{"mutable_tag_rule"}},
+		{"listed tags", `{"mutable_tag_rule": "forbid", "mutable_tags": ["edge", "latest"]}`, "alpine:edge", []string{"mutable_tag_rule"}},
+		{"every tag", `{"mutable_tag_rule": "require_digest", "mutable_tags": ["*"]}`, "alpine:3.20", []string{"mutable_tag_rule"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rules(loadPolicy(t, tt.policy).CheckReference(tt.image))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckReference(%q) rules = %v, want %v", tt.image, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckImage(t *testing.T) {
+	p := loadPolicy(t, `{
+		"max_image_size": "1k",
+		"required_labels": {"org.opencontainers.image.source": "", "team": "ml"}
+	}`)
+	if !p.NeedsImage() {
+		t.Fatal("policy with size and label rules does not need the image")
+	}
+
+	tests := []struct {
+		name string
+		info service.ImageInfo
+		want []string
+	}{
+		{
+			name: "compliant",
+			info: service.ImageInfo{Size: 1024, Labels: map[string]string{"org.opencontainers.image.source": "x", "team": "ml"}},
+		},
+		{
+			name: "too large",
+			info: service.ImageInfo{Size: 1025, Labels: map[string]string{"org.opencontainers.image.source": "x", "team": "ml"}},
+			want: []string{"max_image_size"},
+		},
+		{
+			name: "size unknown",
+			info: service.ImageInfo{Labels: map[string]string{"org.opencontainers.image.source": "x", "team": "ml"}},
+			want: []string{"max_image_size"},
+		},
+		{
+			name: "labels missing or wrong",
+			info: service.ImageInfo{Size: 1, Labels: map[string]string{"team": "web"}},
+			want: []string{"required_labels", "required_labels"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rules(p.CheckImage(&tt.info)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CheckImage rules = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	p := loadPolicy(t, `{"allowed_registries": ["ghcr.io"], "mutable_tag_rule": "forbid"}`)
+	violations := p.CheckReference("alpine:latest")
+	if len(violations) != 2 {
+		t.Fatalf("CheckReference = %v, want 2 violations", violations)
+	}
+
+	var err error = &Error{Image: "alpine:latest", Violations: violations}
+	var policyErr *Error
+	if !errors.As(err, &policyErr) {
+		t.Fatal("errors.As failed")
+	}
+	msg := err.Error()
+	for _, v := range violations {
+		if !strings.Contains(msg, v.String()) {
+			t.Errorf("Error() = %q, missing %q", msg, v.String())
+		}
+	}
+	if got := policyErr.Messages(); len(got) != 2 || !strings.HasPrefix(got[0], "allowed_registries: ") {
+		t.Errorf("Messages() = %v", got)
+	}
+}
@@ -0,0 +1,385 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/theblitlabs/gologger"
+)
+
+const (
+	defaultWorkers   = 2
+	defaultQueueSize = 64
+	defaultRetention = 24 * time.Hour
+
+	// maxLogSize bounds the build output kept per job; the oldest lines
+	// are dropped first.
+	maxLogSize = 1 << 20
+)
+
+var (
+	ErrQueueFull   = errors.New("job queue is full")
+	ErrQueueClosed = errors.New("job queue is shut down")
+)
+
+// RunFunc performs the work for a job, reporting progress through h, and
+// returns the runner-side task ID once the task has been accepted.
+type RunFunc func(ctx context.Context, h *Handle) (string, error)
+
+type work struct {
+	id  string
+	run RunFunc
+}
+
+// Queue runs submitted jobs on a fixed pool of workers and keeps their state
+// in memory so callers can poll for progress.
+type Queue struct {
+	mu        sync.RWMutex
+	jobs      map[string]*Job
+	logs      map[string]*jobLog
+	watchers  map[string][]func(Job)
+	pending   chan work
+	closed    bool
+	workers   int
+	retention time.Duration
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	logger    zerolog.Logger
+}
+
+// NewQueue creates a queue with the given worker count, backlog size and
+// retention for finished jobs. Zero values fall back to 2 workers, a
+// backlog of 64 jobs and 24 hours of retention.
+func NewQueue(workers, queueSize int, retention time.Duration) *Queue {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	if retention <= 0 {
+		retention = defaultRetention
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Queue{
+		jobs:      make(map[string]*Job),
+		logs:      make(map[string]*jobLog),
+		watchers:  make(map[string][]func(Job)),
+		pending:   make(chan work, queueSize),
+		workers:   workers,
+		retention: retention,
+		ctx:       ctx,
+		cancel:    cancel,
+		logger:    gologger.Get().With().Str("component", "jobs").Logger(),
+	}
+}
+
+// Start launches the worker pool.
+func (q *Queue) Start() {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker()
+	}
+	q.logger.Info().Int("workers", q.workers).Msg("Started job workers")
+}
+
+// Stop stops accepting jobs and waits for queued and running jobs to finish.
+// If ctx expires first, running jobs are cancelled, jobs still queued fail
+// without running, and Stop returns ctx.Err() once every worker has
+// returned, so no job is left looking as if it were still in progress.
+func (q *Queue) Stop(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.pending)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		q.cancel()
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.logger.Warn().Msg("Cancelling unfinished jobs")
+	q.cancel()
+	<-done
+	return ctx.Err()
+}
+
+// Submit registers a new job and queues run on the worker pool.
+func (q *Queue) Submit(title, image string, run RunFunc) (Job, error) {
+	now := time.Now()
+	job := &Job{
+		ID:        uuid.New().String(),
+		Title:     title,
+		Image:     image,
+		Phase:     PhaseQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return Job{}, ErrQueueClosed
+	}
+
+	q.pruneLocked(now)
+
+	select {
+	case q.pending <- work{id: job.ID, run: run}:
+	default:
+		return Job{}, ErrQueueFull
+	}
+
+	q.jobs[job.ID] = job
+	return *job, nil
+}
+
+// Get returns a snapshot of the job with the given ID.
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// List returns snapshots of all retained jobs, newest first.
+func (q *Queue) List() []Job {
+	q.mu.Lock()
+	q.pruneLocked(time.Now())
+	list := make([]Job, 0, len(q.jobs))
+	for _, job := range q.jobs {
+		list = append(list, *job)
+	}
+	q.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.After(list[j].CreatedAt)
+	})
+	return list
+}
+
+// Watch calls fn with the job's final state once it has finished, straight
+// away if it already has. It returns false when the queue does not know the
+// job, such as after a restart.
+func (q *Queue) Watch(id string, fn func(Job)) bool {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	if !ok {
+		q.mu.Unlock()
+		return false
+	}
+	if job.Finished() {
+		snapshot := *job
+		q.mu.Unlock()
+		fn(snapshot)
+		return true
+	}
+	q.watchers[id] = append(q.watchers[id], fn)
+	q.mu.Unlock()
+	return true
+}
+
+// Log returns the output the job has logged so far, such as its image
+// build, and whether the job exists.
+func (q *Queue) Log(id string) (string, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if _, ok := q.jobs[id]; !ok {
+		return "", false
+	}
+	log, ok := q.logs[id]
+	if !ok {
+		return "", true
+	}
+	return log.String(), true
+}
+
+func (q *Queue) worker() {
+	defer q.wg.Done()
+
+	for w := range q.pending {
+		q.execute(w)
+	}
+}
+
+func (q *Queue) execute(w work) {
+	log := q.logger.With().Str("job_id", w.id).Logger()
+	h := &Handle{queue: q, id: w.id}
+
+	defer q.notify(w.id)
+
+	if q.ctx.Err() != nil {
+		log.Warn().Msg("Job cancelled before it started")
+		q.fail(w.id, ErrQueueClosed)
+		return
+	}
+
+	log.Info().Msg("Job started")
+
+	taskID, err := w.run(q.ctx, h)
+	if err != nil {
+		if q.ctx.Err() != nil {
+			err = fmt.Errorf("%w: %v", ErrQueueClosed, err)
+		}
+		log.Error().Err(err).Msg("Job failed")
+		q.fail(w.id, err)
+		return
+	}
+
+	log.Info().Str("task_id", taskID).Msg("Job submitted to runner")
+	q.update(w.id, func(job *Job) {
+		job.Phase = PhaseSubmitted
+		job.TaskID = taskID
+	})
+}
+
+// notify hands the finished job to the functions passed to Watch.
+func (q *Queue) notify(id string) {
+	q.mu.Lock()
+	watchers := q.watchers[id]
+	delete(q.watchers, id)
+	job, ok := q.jobs[id]
+	var snapshot Job
+	if ok {
+		snapshot = *job
+	}
+	q.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	for _, fn := range watchers {
+		fn(snapshot)
+	}
+}
+
+func (q *Queue) fail(id string, err error) {
+	q.update(id, func(job *Job) {
+		job.Phase = PhaseFailed
+		job.Error = err.Error()
+	})
+}
+
+func (q *Queue) update(id string, fn func(job *Job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return
+	}
+	fn(job)
+	job.UpdatedAt = time.Now()
+}
+
+func (q *Queue) pruneLocked(now time.Time) {
+	for id, job := range q.jobs {
+		if job.Finished() && now.Sub(job.UpdatedAt) > q.retention {
+			delete(q.jobs, id)
+			delete(q.logs, id)
+		}
+	}
+}
+
+// Handle lets a running job report its progress.
+type Handle struct {
+	queue *Queue
+	id    string
+}
+
+// ID returns the local job ID.
+func (h *Handle) ID() string {
+	return h.id
+}
+
+// SetPhase records the phase the job has entered.
+func (h *Handle) SetPhase(phase Phase) {
+	h.queue.update(h.id, func(job *Job) {
+		job.Phase = phase
+	})
+}
+
+// SetBytesUploaded records how many image bytes have reached the runner.
+func (h *Handle) SetBytesUploaded(n int64) {
+	h.queue.update(h.id, func(job *Job) {
+		job.BytesUploaded = n
+	})
+}
+
+// SetImage records the image the job submits, once it is known; jobs that
+// build their image start without one.
+func (h *Handle) SetImage(image string) {
+	h.queue.update(h.id, func(job *Job) {
+		job.Image = image
+	})
+}
+
+// SetViolations records the image policy rules the job's image broke.
+func (h *Handle) SetViolations(violations []string) {
+	h.queue.update(h.id, func(job *Job) {
+		job.Violations = violations
+	})
+}
+
+// AppendLog adds a line of output to the job's log.
+func (h *Handle) AppendLog(line string) {
+	h.queue.update(h.id, func(job *Job) {
+		log, ok := h.queue.logs[h.id]
+		if !ok {
+			log = &jobLog{}
+			h.queue.logs[h.id] = log
+		}
+		log.append(line)
+		job.HasLog = true
+	})
+}
+
+// jobLog keeps the most recent maxLogSize bytes of a job's output.
+type jobLog struct {
+	lines []string
+	size  int
+}
+
+func (l *jobLog) append(line string) {
+	l.lines = append(l.lines, line)
+	l.size += len(line) + 1
+	for l.size > maxLogSize && len(l.lines) > 1 {
+		l.size -= len(l.lines[0]) + 1
+		l.lines = l.lines[1:]
+	}
+}
+
+func (l *jobLog) String() string {
+	var b strings.Builder
+	b.Grow(l.size)
+	for _, line := range l.lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
@@ -0,0 +1,46 @@
+package jobs
+
+import "time"
+
+// Phase is the stage a local task submission job has reached.
+type Phase string
+
+const (
+	PhaseQueued Phase = "queued"
+	// PhaseStaging uploads the task's input files from the proxy host to
+	// IPFS.
+	PhaseStaging  Phase = "staging"
+	PhaseBuilding Phase = "building"
+	PhasePulling  Phase = "pulling"
+	PhaseSaving   Phase = "saving"
+	// PhaseHashing and PhaseUploading overlap because the image is hashed
+	// while it streams to the runner; a job moves to uploading once the
+	// first bytes have been sent.
+	PhaseHashing   Phase = "hashing"
+	PhaseUploading Phase = "uploading"
+	PhaseSubmitted Phase = "submitted"
+	PhaseFailed    Phase = "failed"
+)
+
+// Job is the locally tracked state of an asynchronous task submission.
+// HasLog reports whether the job has build output to read from
+// /api/local/jobs/{id}/log. Violations lists the image policy rules a
+// failed job's image broke.
+type Job struct {
+	ID            string    `json:"id"`
+	Title         string    `json:"title"`
+	Image         string    `json:"image"`
+	Phase         Phase     `json:"phase"`
+	TaskID        string    `json:"task_id,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Violations    []string  `json:"violations,omitempty"`
+	BytesUploaded int64     `json:"bytes_uploaded,omitempty"`
+	HasLog        bool      `json:"has_log,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Finished reports whether the job has reached a terminal phase.
+func (j Job) Finished() bool {
+	return j.Phase == PhaseSubmitted || j.Phase == PhaseFailed
+}
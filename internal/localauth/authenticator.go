@@ -0,0 +1,156 @@
+package localauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrIPNotAllowed = errors.New("client address is not in the allowlist")
+	ErrUnauthorized = errors.New("missing or invalid API token")
+)
+
+// Authenticator decides whether a caller may use the local proxy.
+//
+// Callers outside the IP allowlist, when one is configured, are always
+// rejected. Otherwise a valid bearer token is required, except from loopback
+// addresses and the proxy's Unix socket when requireAll is false. The socket
+// is only reachable by its owner, so the allowlist does not apply to it.
+type Authenticator struct {
+	store      *Store
+	allowlist  []*net.IPNet
+	requireAll bool
+}
+
+// NewAuthenticator builds an Authenticator from a comma-separated list of IPs
+// or CIDRs. An empty allowlist admits any address.
+func NewAuthenticator(store *Store, allowedIPs string, requireAll bool) (*Authenticator, error) {
+	allowlist, err := ParseAllowlist(allowedIPs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Authenticator{
+		store:      store,
+		allowlist:  allowlist,
+		requireAll: requireAll,
+	}, nil
+}
+
+// ParseAllowlist parses a comma-separated list of IPs or CIDRs.
+func ParseAllowlist(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid allowlist entry %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowlist entry %q: %w", entry, err)
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+// Authorize checks r and returns the matching token, if one was presented.
+// It returns ErrIPNotAllowed or ErrUnauthorized when the caller is rejected.
+func (a *Authenticator) Authorize(r *http.Request) (*Token, error) {
+	ip := RemoteIP(r)
+	local := ViaUnixSocket(r)
+
+	if !local && len(a.allowlist) > 0 && !a.allowed(ip) {
+		return nil, ErrIPNotAllowed
+	}
+
+	if plain, ok := bearerToken(r); ok {
+		token, valid := a.store.Validate(plain)
+		if !valid {
+			return nil, ErrUnauthorized
+		}
+		return &token, nil
+	}
+
+	if !a.requireAll && (local || (ip != nil && ip.IsLoopback())) {
+		return nil, nil
+	}
+
+	return nil, ErrUnauthorized
+}
+
+func (a *Authenticator) allowed(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range a.allowlist {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// RemoteIP returns the caller's address without the port, or nil when it
+// cannot be parsed.
+func RemoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+type unixSocketKey struct{}
+
+// WithUnixSocket marks ctx as belonging to a connection accepted on the
+// proxy's Unix socket. It is meant for http.Server.ConnContext.
+func WithUnixSocket(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unixSocketKey{}, true)
+}
+
+// IsLocal reports whether r came from the proxy host itself, over the Unix
+// socket or a loopback address.
+func IsLocal(r *http.Request) bool {
+	if ViaUnixSocket(r) {
+		return true
+	}
+	ip := RemoteIP(r)
+	return ip != nil && ip.IsLoopback()
+}
+
+// ViaUnixSocket reports whether r came over the proxy's Unix socket, which
+// only its owner can reach.
+func ViaUnixSocket(r *http.Request) bool {
+	local, _ := r.Context().Value(unixSocketKey{}).(bool)
+	return local
+}
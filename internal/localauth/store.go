@@ -0,0 +1,216 @@
+package localauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/theblitlabs/parity-client/internal/utils"
+)
+
+const (
+	DefaultFileName = "api_tokens.json"
+	tokenPrefix     = "prty_"
+)
+
+var ErrTokenNotFound = errors.New("API token not found")
+
+// Token is the stored metadata for an API token. Only a SHA-256 hash of the
+// secret is kept on disk.
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Store persists API tokens in a JSON file next to the keystore. It reloads
+// the file when it changes on disk, so tokens created or revoked from the CLI
+// take effect in a running proxy without a restart.
+type Store struct {
+	path string
+
+	mu      sync.Mutex
+	tokens  []Token
+	modTime time.Time
+}
+
+// NewStore returns a Store backed by path.
+func NewStore(path string) *Store {
+	return &Store{path: path}
+}
+
+// DefaultStore returns the Store at ~/.parity/api_tokens.json.
+func DefaultStore() *Store {
+	return NewStore(filepath.Join(utils.GetParityConfigDir(), DefaultFileName))
+}
+
+// Create generates a new token. The returned secret is not stored and cannot
+// be recovered later.
+func (s *Store) Create(name string) (string, Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadLocked(); err != nil {
+		return "", Token{}, err
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", Token{}, err
+	}
+	id, err := randomHex(4)
+	if err != nil {
+		return "", Token{}, err
+	}
+
+	plain := tokenPrefix + secret
+	token := Token{
+		ID:        id,
+		Name:      name,
+		Hash:      hashToken(plain),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	s.tokens = append(s.tokens, token)
+	if err := s.saveLocked(); err != nil {
+		return "", Token{}, err
+	}
+
+	return plain, token, nil
+}
+
+// List returns all stored tokens, oldest first.
+func (s *Store) List() ([]Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadLocked(); err != nil {
+		return nil, err
+	}
+
+	list := append([]Token(nil), s.tokens...)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// Revoke deletes the token with the given ID.
+func (s *Store) Revoke(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadLocked(); err != nil {
+		return err
+	}
+
+	for i, token := range s.tokens {
+		if token.ID == id {
+			s.tokens = append(s.tokens[:i], s.tokens[i+1:]...)
+			return s.saveLocked()
+		}
+	}
+
+	return ErrTokenNotFound
+}
+
+// Validate reports whether plain is a known token and returns its metadata.
+func (s *Store) Validate(plain string) (Token, bool) {
+	if !strings.HasPrefix(plain, tokenPrefix) {
+		return Token{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.loadLocked(); err != nil {
+		return Token{}, false
+	}
+
+	hash := []byte(hashToken(plain))
+	for _, token := range s.tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(token.Hash)) == 1 {
+			return token, true
+		}
+	}
+
+	return Token{}, false
+}
+
+func (s *Store) loadLocked() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.tokens = nil
+		s.modTime = time.Time{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat token store: %w", err)
+	}
+
+	if s.tokens != nil && info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read token store: %w", err)
+	}
+
+	var tokens []Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("failed to parse token store: %w", err)
+	}
+
+	s.tokens = tokens
+	s.modTime = info.ModTime()
+	return nil
+}
+
+func (s *Store) saveLocked() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create token store directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(s.tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode token store: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write token store: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace token store: %w", err)
+	}
+
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
+
+func hashToken(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/theblitlabs/parity-client/internal/version"
+)
+
+const namespace = "parity_client"
+
+// Default is the registry served on the proxy's /metrics endpoint.
+var Default = NewRegistry()
+
+var (
+	byteBuckets = []float64{1 << 20, 16 << 20, 64 << 20, 256 << 20, 512 << 20, 1 << 30, 2 << 30, 4 << 30, 8 << 30}
+	slowBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800}
+)
+
+var (
+	BuildInfo = Default.NewGaugeVec(namespace+"_build_info",
+		"Build information of the running parity-client; always 1.",
+		"version", "commit", "build_time", "go_version", "platform")
+
+	HTTPRequestsTotal = Default.NewCounterVec(namespace+"_http_requests_total",
+		"Requests handled by the local proxy, by route, method and status code.",
+		"route", "method", "status")
+
+	HTTPRequestDuration = Default.NewHistogramVec(namespace+"_http_request_duration_seconds",
+		"Time spent handling local proxy requests, by route, method and status code.",
+		DefaultBuckets, "route", "method", "status")
+
+	UpstreamErrorsTotal = Default.NewCounterVec(namespace+"_upstream_errors_total",
+		"Failed requests forwarded to the runner, by route and reason.",
+		"route", "reason")
+
+	DockerOperationDuration = Default.NewHistogramVec(namespace+"_docker_operation_duration_seconds",
+		"Time spent pulling, saving and uploading Docker images, by operation and result.",
+		slowBuckets, "operation", "result")
+
+	DockerImageBytes = Default.NewHistogramVec(namespace+"_docker_image_bytes",
+		"Size of Docker images saved and uploaded, in bytes.",
+		byteBuckets, "operation")
+)
+
+func init() {
+	info := version.GetBuildInfo()
+	BuildInfo.Set(1, info["version"], info["commit"], info["build_time"], info["go_version"], info["platform"])
+}
+
+// Handler serves the Default registry.
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// Result returns the result label for an operation that returned err.
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// Method returns the method label for an HTTP request method. Methods
+// outside the standard set are reported as other, so arbitrary method
+// names sent by clients cannot create new series.
+func Method(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
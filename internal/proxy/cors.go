@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/theblitlabs/parity-client/internal/types"
+)
+
+const defaultCORSMaxAge = 10 * time.Minute
+
+const (
+	corsAllowedMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	corsAllowedHeaders = "Authorization, Content-Type, Idempotency-Key, X-Request-ID"
+	corsExposedHeaders = "Idempotent-Replayed, Location, Retry-After, X-Request-ID"
+)
+
+// corsPolicy answers preflight requests and adds CORS headers for the
+// configured origins. A nil policy leaves responses untouched.
+type corsPolicy struct {
+	anyOrigin bool
+	origins   map[string]bool
+	maxAge    time.Duration
+}
+
+// newCORSPolicy parses a comma-separated list of origins such as
+// "http://localhost:5173,https://tools.internal"; "*" allows any origin. It
+// returns nil when the list is empty.
+func newCORSPolicy(list string, maxAge time.Duration) (*corsPolicy, error) {
+	p := &corsPolicy{
+		origins: make(map[string]bool),
+		maxAge:  durationOrDefault(maxAge, defaultCORSMaxAge),
+	}
+
+	for _, origin := range strings.Split(list, ",") {
+		origin = strings.TrimSpace(origin)
+		switch {
+		case origin == "":
+			continue
+		case origin == "*":
+			p.anyOrigin = true
+			continue
+		}
+
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("invalid origin %q: expected scheme://host[:port]", origin)
+		}
+		p.origins[u.Scheme+"://"+u.Host] = true
+	}
+
+	if !p.anyOrigin && len(p.origins) == 0 {
+		return nil, nil
+	}
+	return p, nil
+}
+
+func (p *corsPolicy) allows(origin string) bool {
+	return p.anyOrigin || p.origins[origin]
+}
+
+// wrap applies the policy in front of next. Preflight requests are answered
+// here because browsers send them without credentials.
+func (p *corsPolicy) wrap(next http.Handler) http.Handler {
+	if p == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !p.allows(origin) {
+			if preflight {
+				_ = types.WriteError(w, http.StatusForbidden, fmt.Sprintf("origin %s is not allowed", origin))
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if p.anyOrigin {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+		w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -1,12 +1,39 @@
 package proxy
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/theblitlabs/gologger"
+	"github.com/theblitlabs/parity-client/internal/accesslog"
+	"github.com/theblitlabs/parity-client/internal/client"
 	"github.com/theblitlabs/parity-client/internal/config"
+	"github.com/theblitlabs/parity-client/internal/dashboard"
+	"github.com/theblitlabs/parity-client/internal/docker/service"
 	"github.com/theblitlabs/parity-client/internal/handlers"
+	"github.com/theblitlabs/parity-client/internal/jobs"
+	"github.com/theblitlabs/parity-client/internal/localauth"
+	"github.com/theblitlabs/parity-client/internal/metrics"
+	"github.com/theblitlabs/parity-client/internal/tlsconfig"
+	"github.com/theblitlabs/parity-client/internal/upstream"
+	"github.com/theblitlabs/parity-client/pkg/requestsig"
+)
+
+const (
+	defaultReadHeaderTimeout = 10 * time.Second
+	defaultReadTimeout       = 5 * time.Minute
+	defaultWriteTimeout      = 30 * time.Minute
+	defaultIdleTimeout       = 2 * time.Minute
+	defaultShutdownTimeout   = 30 * time.Second
 )
 
 type Server struct {
@@ -14,31 +41,258 @@ type Server struct {
 	deviceID      string
 	creatorAddr   string
 	port          int
+	socketPath    string
+	tlsConfig     *tls.Config
 	requestRouter *handlers.RequestRouter
+	jobQueue      *jobs.Queue
+	upstreams     *upstream.Pool
+	accessLog     *accesslog.Logger
+	httpServer    *http.Server
 }
 
-func NewServer(cfg *config.Config, deviceID, creatorAddr string, port int) *Server {
-	return &Server{
+// NewServer creates a proxy server that forwards to the runner on behalf of
+// signer's wallet, signing every outbound request with its key.
+func NewServer(cfg *config.Config, deviceID string, signer *requestsig.Signer, port int) (*Server, error) {
+	auth, err := localauth.NewAuthenticator(localauth.DefaultStore(), cfg.Server.AllowedIPs, cfg.Server.AuthRequired)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SERVER_ALLOWED_IPS: %w", err)
+	}
+
+	jobQueue := jobs.NewQueue(cfg.Jobs.Workers, cfg.Jobs.QueueSize, cfg.Jobs.Retention)
+
+	transport, err := tlsconfig.Transport(cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid outbound TLS settings: %w", err)
+	}
+
+	upstreams, err := upstream.NewPool(
+		cfg.Runner.UpstreamURLs(),
+		cfg.Runner.LoadBalancing,
+		cfg.Runner.HealthInterval,
+		cfg.Upstream.BreakerThreshold,
+		cfg.Upstream.BreakerCooldown,
+		transport,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid runner upstreams: %w", err)
+	}
+
+	cors, err := newCORSPolicy(cfg.Server.CORSOrigins, cfg.Server.CORSMaxAge)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SERVER_CORS_ALLOWED_ORIGINS: %w", err)
+	}
+
+	tlsConfig, err := tlsconfig.Server(cfg.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy TLS settings: %w", err)
+	}
+
+	runtime, err := service.NewRuntime(cfg.Container)
+	if err != nil {
+		return nil, fmt.Errorf("invalid container runtime settings: %w", err)
+	}
+
+	accessLog, err := accesslog.New(cfg.Server.AccessLog, cfg.Server.AccessLogMaxSize, cfg.Server.AccessLogBackups)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SERVER_ACCESS_LOG: %w", err)
+	}
+
+	requestRouter, err := handlers.NewRequestRouter(cfg, deviceID, signer, runtime, jobQueue, upstreams, auth, accessLog, transport)
+	if err != nil {
+		_ = accessLog.Close()
+		return nil, err
+	}
+
+	s := &Server{
 		config:        cfg,
 		deviceID:      deviceID,
-		creatorAddr:   creatorAddr,
+		creatorAddr:   signer.Address().Hex(),
 		port:          port,
-		requestRouter: handlers.NewRequestRouter(cfg, deviceID, creatorAddr),
+		requestRouter: requestRouter,
+		jobQueue:      jobQueue,
+		upstreams:     upstreams,
+		accessLog:     accessLog,
+		tlsConfig:     tlsConfig,
+	}
+	if cfg.Server.Socket {
+		s.socketPath = client.ProxySocketPath(cfg)
 	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.requestRouter.Authorized(metrics.Handler()))
+	// The dashboard assets are public; the APIs it calls are not.
+	ui := dashboard.Handler()
+	mux.Handle("/ui", ui)
+	mux.Handle(dashboard.Prefix, ui)
+	mux.HandleFunc("/", s.requestRouter.HandleRequest)
+
+	s.httpServer = &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", cfg.Server.Host, port),
+		Handler:           cors.wrap(mux),
+		ReadHeaderTimeout: durationOrDefault(cfg.Server.ReadHeaderTimeout, defaultReadHeaderTimeout),
+		ReadTimeout:       durationOrDefault(cfg.Server.ReadTimeout, defaultReadTimeout),
+		WriteTimeout:      durationOrDefault(cfg.Server.WriteTimeout, defaultWriteTimeout),
+		IdleTimeout:       durationOrDefault(cfg.Server.IdleTimeout, defaultIdleTimeout),
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			if _, ok := c.(*net.UnixConn); ok {
+				return localauth.WithUnixSocket(ctx)
+			}
+			return ctx
+		},
+	}
+
+	return s, nil
 }
 
+// Start serves until the listener fails or the process receives SIGINT or SIGTERM.
 func (s *Server) Start() error {
-	log := gologger.Get().With().Str("component", "proxy").Logger()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return s.Run(ctx)
+}
+
+// Run binds the configured address, or the Unix socket when SERVER_SOCKET is
+// enabled, and serves until ctx is cancelled. TCP connections use TLS when a
+// certificate is configured; the socket is already restricted to its owner.
+func (s *Server) Run(ctx context.Context) error {
+	if s.socketPath != "" {
+		ln, err := listenUnix(s.socketPath)
+		if err != nil {
+			return err
+		}
+		return s.Serve(ctx, ln)
+	}
+
+	ln, err := net.Listen("tcp", s.httpServer.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.httpServer.Addr, err)
+	}
+	if s.tlsConfig != nil {
+		ln = tls.NewListener(ln, s.tlsConfig)
+	}
 
-	localAddr := fmt.Sprintf("%s:%d", s.config.Server.Host, s.port)
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts connections on ln until ctx is cancelled, then drains
+// in-flight requests and queued task jobs for up to the configured shutdown
+// timeout.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	log := gologger.Get().With().Str("component", "proxy").Logger()
 
 	log.Info().
-		Str("address", localAddr).
+		Str("address", ln.Addr().String()).
 		Str("device_id", s.deviceID).
 		Str("creator_address", s.creatorAddr).
 		Int("port", s.port).
 		Msg("Starting chain proxy server")
+	if ln.Addr().Network() == "unix" {
+		log.Info().Msg("Listening on a Unix socket only; the dashboard is not reachable from a browser")
+	} else {
+		scheme := "http://"
+		if s.tlsConfig != nil {
+			scheme = "https://"
+		}
+		log.Info().Str("url", scheme+ln.Addr().String()+dashboard.Prefix).Msg("Dashboard available")
+	}
+
+	s.jobQueue.Start()
+	s.upstreams.Start()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.httpServer.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		// ErrServerClosed means Shutdown was called directly and is
+		// responsible for draining the job queue.
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		s.upstreams.Stop()
+		s.closeAccessLog()
+		stopCtx, cancel := context.WithTimeout(context.Background(), durationOrDefault(s.config.Server.ShutdownTimeout, defaultShutdownTimeout))
+		defer cancel()
+		if stopErr := s.jobQueue.Stop(stopCtx); stopErr != nil {
+			log.Error().Err(stopErr).Msg("Failed to stop job workers")
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := durationOrDefault(s.config.Server.ShutdownTimeout, defaultShutdownTimeout)
+	log.Info().
+		Dur("timeout", timeout).
+		Msg("Shutting down chain proxy server, draining in-flight requests")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down gracefully: %w", err)
+	}
+
+	log.Info().Msg("Chain proxy server stopped")
+	return nil
+}
+
+// Shutdown stops accepting new connections and waits for in-flight requests
+// and queued task jobs to finish or ctx to expire, whichever comes first.
+// The job queue is stopped even when requests are still in flight, so
+// unfinished jobs are always cancelled and marked failed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	httpErr := s.httpServer.Shutdown(ctx)
 
-	http.HandleFunc("/", s.requestRouter.HandleRequest)
-	return http.ListenAndServe(localAddr, nil)
+	// Queued jobs may still be uploading, so keep probing until they finish.
+	var jobsErr error
+	if err := s.jobQueue.Stop(ctx); err != nil {
+		jobsErr = fmt.Errorf("failed to finish queued jobs: %w", err)
+	}
+	s.upstreams.Stop()
+	s.closeAccessLog()
+
+	return errors.Join(httpErr, jobsErr)
+}
+
+func (s *Server) closeAccessLog() {
+	if err := s.accessLog.Close(); err != nil {
+		log := gologger.Get().With().Str("component", "proxy").Logger()
+		log.Error().Err(err).Msg("Failed to close access log")
+	}
+}
+
+// listenUnix listens on path with owner-only permissions. The socket file is
+// removed again when the listener is closed.
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	if err := client.IsSocketAvailable(path); err != nil {
+		return nil, err
+	}
+
+	// Create the socket without group or other access so there is no window
+	// before the chmod below in which another user could connect.
+	oldMask := syscall.Umask(0o177)
+	ln, err := net.Listen("unix", path)
+	syscall.Umask(oldMask)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	return ln, nil
+}
+
+func durationOrDefault(d, fallback time.Duration) time.Duration {
+	if d > 0 {
+		return d
+	}
+	return fallback
 }
@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultRate  = 10
+	defaultBurst = 20
+
+	// idleTTL is how long an unused bucket is kept before being dropped.
+	idleTTL       = 10 * time.Minute
+	sweepInterval = time.Minute
+)
+
+// Rate is a token bucket refilled at PerSecond tokens per second holding up
+// to Burst tokens. A zero PerSecond means unlimited.
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+func (r Rate) unlimited() bool {
+	return r.PerSecond <= 0
+}
+
+// ParseRouteRates parses a comma-separated list of route=rate[:burst] pairs,
+// for example "task_create=0.2:5,llm=5". A rate of 0 disables limiting for
+// that route; a missing burst defaults to twice the rate, at least 1.
+func ParseRouteRates(list string) (map[string]Rate, error) {
+	rates := make(map[string]Rate)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, spec, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid route rate %q: expected route=rate[:burst]", entry)
+		}
+
+		perSecond, burstSpec, hasBurst := strings.Cut(strings.TrimSpace(spec), ":")
+		r, err := strconv.ParseFloat(perSecond, 64)
+		if err != nil || r < 0 {
+			return nil, fmt.Errorf("invalid route rate %q: rate must be a non-negative number", entry)
+		}
+
+		burst := burstFor(r)
+		if hasBurst {
+			burst, err = strconv.Atoi(burstSpec)
+			if err != nil || burst < 1 {
+				return nil, fmt.Errorf("invalid route rate %q: burst must be a positive integer", entry)
+			}
+		}
+
+		rates[strings.TrimSpace(route)] = Rate{PerSecond: r, Burst: burst}
+	}
+	return rates, nil
+}
+
+func burstFor(perSecond float64) int {
+	if burst := int(2 * perSecond); burst > 1 {
+		return burst
+	}
+	return 1
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Limiter keeps one token bucket per route and client.
+type Limiter struct {
+	def    Rate
+	routes map[string]Rate
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New creates a Limiter applying def to every route without an entry in
+// routes. A zero def falls back to 10 requests per second with a burst of
+// 20, and a zero Burst otherwise to twice PerSecond; a negative PerSecond
+// disables the default limit.
+func New(def Rate, routes map[string]Rate) *Limiter {
+	switch {
+	case def.PerSecond < 0:
+		def = Rate{}
+	case def.PerSecond == 0:
+		def.PerSecond = defaultRate
+		if def.Burst <= 0 {
+			def.Burst = defaultBurst
+		}
+	}
+	if def.Burst <= 0 {
+		def.Burst = burstFor(def.PerSecond)
+	}
+
+	return &Limiter{
+		def:     def,
+		routes:  routes,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token for client on route. When the bucket is empty it
+// returns how long the client should wait before retrying.
+func (l *Limiter) Allow(route, client string) (time.Duration, bool) {
+	r, ok := l.routes[route]
+	if !ok {
+		r = l.def
+	}
+	if r.unlimited() {
+		return 0, true
+	}
+
+	now := l.now()
+	b := l.bucket(route+"\x00"+client, r, now)
+
+	reservation := b.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return time.Second, false
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return delay, false
+	}
+	return 0, true
+}
+
+func (l *Limiter) bucket(key string, r Rate, now time.Time) *bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > sweepInterval {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > idleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(rate.Limit(r.PerSecond), r.Burst)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+	return b
+}
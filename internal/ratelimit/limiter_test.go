@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestLimiter returns a Limiter whose clock only moves when the
+// returned function is called.
+func newTestLimiter(def Rate, routes map[string]Rate) (*Limiter, func(time.Duration)) {
+	l := New(def, routes)
+	now := time.Unix(1700000000, 0)
+	l.now = func() time.Time { return now }
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestParseRouteRates(t *testing.T) {
+	rates, err := ParseRouteRates(" task_create=0.2:5, llm=5 ,storage=0,,")
+	if err != nil {
+		t.Fatalf("ParseRouteRates: %v", err)
+	}
+
+	want := map[string]Rate{
+		"task_create": {PerSecond: 0.2, Burst: 5},
+		"llm":         {PerSecond: 5, Burst: 10},
+		"storage":     {PerSecond: 0, Burst: 1},
+	}
+	if len(rates) != len(want) {
+		t.Fatalf("ParseRouteRates = %v, want %v", rates, want)
+	}
+	for route, r := range want {
+		if rates[route] != r {
+			t.Errorf("rate for %s = %+v, want %+v", route, rates[route], r)
+		}
+	}
+}
+
+func TestParseRouteRatesRejects(t *testing.T) {
+	for _, list := range []string{"llm", "llm=fast", "llm=-1", "llm=1:0", "llm=1:x"} {
+		if _, err := ParseRouteRates(list); err == nil {
+			t.Errorf("ParseRouteRates(%q) succeeded", list)
+		}
+	}
+}
+
+func TestNewDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		def  Rate
+		want Rate
+	}{
+		{"zero", Rate{}, Rate{PerSecond: defaultRate, Burst: defaultBurst}},
+		{"rate without burst", Rate{PerSecond: 4}, Rate{PerSecond: 4, Burst: 8}},
+		{"slow rate without burst", Rate{PerSecond: 0.1}, Rate{PerSecond: 0.1, Burst: 1}},
+		{"explicit", Rate{PerSecond: 3, Burst: 7}, Rate{PerSecond: 3, Burst: 7}},
+		{"disabled", Rate{PerSecond: -1}, Rate{Burst: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := New(tt.def, nil).def; got != tt.want {
+				t.Errorf("New(%+v) default = %+v, want %+v", tt.def, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowBurstThenRefill(t *testing.T) {
+	l, advance := newTestLimiter(Rate{PerSecond: 1, Burst: 3}, nil)
+
+	for i := 0; i < 3; i++ {
+		if _, ok := l.Allow("llm", "ip:127.0.0.1"); !ok {
+			t.Fatalf("request %d within the burst was limited", i+1)
+		}
+	}
+
+	wait, ok := l.Allow("llm", "ip:127.0.0.1")
+	if ok {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	if wait <= 0 || wait > time.Second {
+		t.Errorf("wait = %s, want up to 1s", wait)
+	}
+
+	// A rejected request does not use up a token.
+	advance(time.Second)
+	if _, ok := l.Allow("llm", "ip:127.0.0.1"); !ok {
+		t.Fatal("request after the refill was limited")
+	}
+	if _, ok := l.Allow("llm", "ip:127.0.0.1"); ok {
+		t.Fatal("second request after a one token refill was allowed")
+	}
+}
+
+func TestAllowSeparatesClientsAndRoutes(t *testing.T) {
+	l, _ := newTestLimiter(Rate{PerSecond: 1, Burst: 1}, nil)
+
+	if _, ok := l.Allow("llm", "token:a"); !ok {
+		t.Fatal("first request was limited")
+	}
+	if _, ok := l.Allow("llm", "token:a"); ok {
+		t.Fatal("second request from the same client was allowed")
+	}
+	if _, ok := l.Allow("llm", "token:b"); !ok {
+		t.Error("another client shares the bucket")
+	}
+	if _, ok := l.Allow("storage", "token:a"); !ok {
+		t.Error("another route shares the bucket")
+	}
+}
+
+func TestAllowRouteOverrides(t *testing.T) {
+	l, _ := newTestLimiter(Rate{PerSecond: 1, Burst: 1}, map[string]Rate{
+		"task_create": {PerSecond: 1, Burst: 2},
+		"health":      {},
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, ok := l.Allow("task_create", "c"); !ok {
+			t.Fatalf("task_create request %d was limited", i+1)
+		}
+	}
+	if _, ok := l.Allow("task_create", "c"); ok {
+		t.Error("task_create request beyond its burst was allowed")
+	}
+
+	for i := 0; i < 100; i++ {
+		if _, ok := l.Allow("health", "c"); !ok {
+			t.Fatal("unlimited route was limited")
+		}
+	}
+}
+
+func TestIdleBucketsAreDropped(t *testing.T) {
+	l, advance := newTestLimiter(Rate{PerSecond: 1, Burst: 1}, nil)
+
+	l.Allow("llm", "a")
+	advance(idleTTL + sweepInterval + time.Second)
+	l.Allow("llm", "b")
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.buckets["llm\x00a"]; ok {
+		t.Error("idle bucket was kept")
+	}
+	if _, ok := l.buckets["llm\x00b"]; !ok {
+		t.Error("active bucket was dropped")
+	}
+}
@@ -0,0 +1,112 @@
+// Package requestid carries the X-Request-ID that correlates a CLI
+// invocation, the proxy's log lines and the runner request.
+package requestid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// Header is the HTTP header carrying the request ID.
+const Header = "X-Request-ID"
+
+const maxLength = 128
+
+type contextKey struct{}
+
+// New returns a fresh request ID.
+func New() string {
+	return uuid.New().String()
+}
+
+// Valid reports whether id is safe to accept from a caller and repeat in logs
+// and headers: 1 to 128 characters from [A-Za-z0-9._:-].
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == ':', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// FromRequest returns the caller's request ID when it is valid, otherwise a
+// new one.
+func FromRequest(r *http.Request) string {
+	if id := r.Header.Get(Header); Valid(id) {
+		return id
+	}
+	return New()
+}
+
+// WithContext returns a copy of ctx carrying id.
+func WithContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or "".
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Logger returns a copy of log with a request_id field when ctx carries one.
+func Logger(ctx context.Context, log zerolog.Logger) *zerolog.Logger {
+	if id := FromContext(ctx); id != "" {
+		log = log.With().Str("request_id", id).Logger()
+	}
+	return &log
+}
+
+// Transport sets the request ID header on outbound requests that do not
+// already have one, from the request context or else from Fallback.
+type Transport struct {
+	Base     http.RoundTripper
+	Fallback string
+}
+
+// NewTransport returns a Transport wrapping base, or http.DefaultTransport if
+// base is nil.
+func NewTransport(base http.RoundTripper, fallback string) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base, Fallback: fallback}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get(Header) != "" {
+		return t.Base.RoundTrip(req)
+	}
+
+	id := FromContext(req.Context())
+	if id == "" {
+		id = t.Fallback
+	}
+	if id == "" {
+		return t.Base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(req.Context())
+	req.Header.Set(Header, id)
+	return t.Base.RoundTrip(req)
+}
+
+// InstallDefault wraps http.DefaultTransport so every client built on it
+// forwards request IDs. It must be called before any such client is created.
+func InstallDefault(fallback string) {
+	if _, ok := http.DefaultTransport.(*Transport); ok {
+		return
+	}
+	http.DefaultTransport = NewTransport(http.DefaultTransport, fallback)
+}
@@ -0,0 +1,395 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// maxCARHeader and maxCARSection bound the CAR header and each block
+	// section, so a corrupt export cannot make us allocate without limit.
+	// IPFS blocks are at most a few MiB.
+	maxCARHeader  = 1 << 20
+	maxCARSection = 8 << 20
+)
+
+// UnixFS node types, as in the Data.DataType enum of the UnixFS protobuf.
+const (
+	unixfsRaw       = 0
+	unixfsDirectory = 1
+	unixfsFile      = 2
+	unixfsMetadata  = 3
+	unixfsSymlink   = 4
+	unixfsHAMTShard = 5
+)
+
+// blockStore holds the blocks of a DAG exported by the IPFS node as a CAR
+// stream. Blocks are spooled to a temporary file and each one is checked
+// against its CID as it is read, so whatever is built from the store is the
+// content its CIDs name, however it was chunked.
+type blockStore struct {
+	file   *os.File
+	blocks map[string]blockRef
+}
+
+type blockRef struct {
+	offset int64
+	size   int
+}
+
+// readCAR reads a CARv1 stream into a block store spooled to file. It fails
+// with ErrCIDMismatch on the first block whose content does not hash to its
+// CID.
+func readCAR(r io.Reader, file *os.File) (*blockStore, error) {
+	br := bufio.NewReader(r)
+
+	headerLen, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CAR header: %w", err)
+	}
+	if headerLen == 0 || headerLen > maxCARHeader {
+		return nil, fmt.Errorf("invalid CAR header length %d", headerLen)
+	}
+	if _, err := io.CopyN(io.Discard, br, int64(headerLen)); err != nil {
+		return nil, fmt.Errorf("failed to read CAR header: %w", err)
+	}
+
+	s := &blockStore{file: file, blocks: make(map[string]blockRef)}
+	var offset int64
+	for {
+		sectionLen, err := binary.ReadUvarint(br)
+		if errors.Is(err, io.EOF) {
+			return s, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CAR section: %w", err)
+		}
+		if sectionLen == 0 || sectionLen > maxCARSection {
+			return nil, fmt.Errorf("invalid CAR section length %d", sectionLen)
+		}
+
+		section := make([]byte, sectionLen)
+		if _, err := io.ReadFull(br, section); err != nil {
+			return nil, fmt.Errorf("failed to read CAR section: %w", err)
+		}
+		n, c, err := cid.CidFromBytes(section)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CID in CAR section: %w", err)
+		}
+		data := section[n:]
+		if err := checkBlock(c, data); err != nil {
+			return nil, err
+		}
+
+		if _, err := file.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to spool block %s: %w", c, err)
+		}
+		s.blocks[string(c.Hash())] = blockRef{offset: offset, size: len(data)}
+		offset += int64(len(data))
+	}
+}
+
+// checkBlock reports whether data hashes to c.
+func checkBlock(c cid.Cid, data []byte) error {
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return fmt.Errorf("failed to hash block %s: %w", c, err)
+	}
+	if !sum.Equals(c) {
+		return fmt.Errorf("%w: block %s hashes to %s", ErrCIDMismatch, c, sum)
+	}
+	return nil
+}
+
+// get returns the content of block c. Identity CIDs carry their content
+// inline and need no block.
+func (s *blockStore) get(c cid.Cid) ([]byte, error) {
+	decoded, err := multihash.Decode(c.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("invalid multihash in %s: %w", c, err)
+	}
+	if decoded.Code == multihash.IDENTITY {
+		return decoded.Digest, nil
+	}
+
+	ref, ok := s.blocks[string(c.Hash())]
+	if !ok {
+		return nil, fmt.Errorf("block %s is missing from the export", c)
+	}
+	data := make([]byte, ref.size)
+	if _, err := s.file.ReadAt(data, ref.offset); err != nil {
+		return nil, fmt.Errorf("failed to read block %s: %w", c, err)
+	}
+	return data, nil
+}
+
+// writePath writes the UnixFS file or directory c to dest, which must not
+// exist. Symlinks are refused rather than created, so nothing written can
+// point outside dest.
+func (s *blockStore) writePath(c cid.Cid, dest string) error {
+	if c.Type() == cid.Raw {
+		return s.writeFile(c, dest)
+	}
+
+	node, fsData, err := s.unixfsNode(c)
+	if err != nil {
+		return err
+	}
+
+	switch fsData.kind {
+	case unixfsFile, unixfsRaw:
+		return s.writeFile(c, dest)
+	case unixfsDirectory:
+		if err := os.Mkdir(dest, 0o755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		for _, link := range node.links {
+			if err := checkEntryName(link.name); err != nil {
+				return fmt.Errorf("%s: %w", dest, err)
+			}
+			if err := s.writePath(link.hash, filepath.Join(dest, link.name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case unixfsHAMTShard:
+		if err := os.Mkdir(dest, 0o755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		return s.writeShard(node, fsData, dest)
+	case unixfsSymlink:
+		return fmt.Errorf("%s is a symlink, which is not downloaded", dest)
+	default:
+		return fmt.Errorf("%s has unsupported UnixFS type %d", dest, fsData.kind)
+	}
+}
+
+// writeShard writes the entries of a sharded directory node to dest. Link
+// names start with the bucket index in hex; links with nothing after it
+// are further shards of the same directory.
+func (s *blockStore) writeShard(node *pbNode, fsData *unixfsData, dest string) error {
+	if fsData.fanout == 0 {
+		return fmt.Errorf("%s: sharded directory has no fanout", dest)
+	}
+	prefixLen := len(fmt.Sprintf("%X", fsData.fanout-1))
+
+	for _, link := range node.links {
+		switch {
+		case len(link.name) < prefixLen:
+			return fmt.Errorf("%s: invalid shard link name %q", dest, link.name)
+		case len(link.name) == prefixLen:
+			child, childData, err := s.unixfsNode(link.hash)
+			if err != nil {
+				return err
+			}
+			if childData.kind != unixfsHAMTShard {
+				return fmt.Errorf("%s: shard link %q is not a shard", dest, link.name)
+			}
+			if err := s.writeShard(child, childData, dest); err != nil {
+				return err
+			}
+		default:
+			name := link.name[prefixLen:]
+			if err := checkEntryName(name); err != nil {
+				return fmt.Errorf("%s: %w", dest, err)
+			}
+			if err := s.writePath(link.hash, filepath.Join(dest, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *blockStore) writeFile(c cid.Cid, dest string) error {
+	file, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if err := s.copyFile(c, file); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to write %s: %w", dest, err)
+	}
+	return file.Close()
+}
+
+// copyFile writes the content of the UnixFS file c to w: the node's own
+// data followed by that of its children in order.
+func (s *blockStore) copyFile(c cid.Cid, w io.Writer) error {
+	if c.Type() == cid.Raw {
+		data, err := s.get(c)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	node, fsData, err := s.unixfsNode(c)
+	if err != nil {
+		return err
+	}
+	if fsData.kind != unixfsFile && fsData.kind != unixfsRaw {
+		return fmt.Errorf("block %s is not part of a file", c)
+	}
+	if _, err := w.Write(fsData.data); err != nil {
+		return err
+	}
+	for _, link := range node.links {
+		if err := s.copyFile(link.hash, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkEntryName rejects directory entry names that are not a single path
+// element.
+func checkEntryName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") {
+		return fmt.Errorf("invalid entry name %q", name)
+	}
+	return nil
+}
+
+// pbNode is a decoded dag-pb node.
+type pbNode struct {
+	links []pbLink
+	data  []byte
+}
+
+type pbLink struct {
+	hash cid.Cid
+	name string
+}
+
+// unixfsData is the UnixFS Data message carried in a dag-pb node.
+type unixfsData struct {
+	kind   uint64
+	data   []byte
+	fanout uint64
+}
+
+func (s *blockStore) unixfsNode(c cid.Cid) (*pbNode, *unixfsData, error) {
+	if c.Type() != cid.DagProtobuf {
+		return nil, nil, fmt.Errorf("block %s has unsupported codec %d", c, c.Type())
+	}
+	block, err := s.get(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	node, err := decodePBNode(block)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid dag-pb block %s: %w", c, err)
+	}
+	fsData, err := decodeUnixFSData(node.data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid UnixFS data in %s: %w", c, err)
+	}
+	return node, fsData, nil
+}
+
+// decodePBNode decodes a dag-pb PBNode: Data is field 1 and each Links
+// entry is field 2.
+func decodePBNode(b []byte) (*pbNode, error) {
+	node := &pbNode{}
+	err := decodeFields(b, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			node.data = value
+		case num == 2 && typ == protowire.BytesType:
+			link, err := decodePBLink(value)
+			if err != nil {
+				return err
+			}
+			node.links = append(node.links, link)
+		}
+		return nil
+	})
+	return node, err
+}
+
+// decodePBLink decodes a PBLink: Hash is field 1 and Name field 2.
+func decodePBLink(b []byte) (pbLink, error) {
+	var link pbLink
+	hasHash := false
+	err := decodeFields(b, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			c, err := cid.Cast(value)
+			if err != nil {
+				return fmt.Errorf("invalid link CID: %w", err)
+			}
+			link.hash = c
+			hasHash = true
+		case num == 2 && typ == protowire.BytesType:
+			link.name = string(value)
+		}
+		return nil
+	})
+	if err == nil && !hasHash {
+		err = errors.New("link has no CID")
+	}
+	return link, err
+}
+
+// decodeUnixFSData decodes a UnixFS Data message: Type is field 1, Data
+// field 2 and fanout field 6.
+func decodeUnixFSData(b []byte) (*unixfsData, error) {
+	fsData := &unixfsData{}
+	hasType := false
+	err := decodeFields(b, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(value)
+			fsData.kind = v
+			hasType = true
+		case num == 2 && typ == protowire.BytesType:
+			fsData.data = value
+		case num == 6 && typ == protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(value)
+			fsData.fanout = v
+		}
+		return nil
+	})
+	if err == nil && !hasType {
+		err = errors.New("UnixFS data has no type")
+	}
+	return fsData, err
+}
+
+// decodeFields calls fn with each field of the protobuf message b. Varint
+// values are passed still encoded, bytes values without their length.
+func decodeFields(b []byte, fn func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		m := protowire.ConsumeFieldValue(num, typ, b)
+		if m < 0 {
+			return protowire.ParseError(m)
+		}
+		value := b[:m]
+		if typ == protowire.BytesType {
+			value, _ = protowire.ConsumeBytes(value)
+		}
+		if err := fn(num, typ, value); err != nil {
+			return err
+		}
+		b = b[m:]
+	}
+	return nil
+}
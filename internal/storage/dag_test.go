@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testBlock struct {
+	cid  cid.Cid
+	data []byte
+}
+
+func rawBlock(t *testing.T, data string) testBlock {
+	t.Helper()
+	c, err := cid.V1Builder{Codec: cid.Raw, MhType: multihash.SHA2_256}.Sum([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testBlock{cid: c, data: []byte(data)}
+}
+
+type testLink struct {
+	name  string
+	block testBlock
+}
+
+// pbBlock encodes a dag-pb node carrying UnixFS data of the given type.
+func pbBlock(t *testing.T, kind uint64, data string, fanout uint64, links ...testLink) testBlock {
+	t.Helper()
+
+	var fsData []byte
+	fsData = protowire.AppendTag(fsData, 1, protowire.VarintType)
+	fsData = protowire.AppendVarint(fsData, kind)
+	if data != "" {
+		fsData = protowire.AppendTag(fsData, 2, protowire.BytesType)
+		fsData = protowire.AppendBytes(fsData, []byte(data))
+	}
+	if fanout != 0 {
+		fsData = protowire.AppendTag(fsData, 6, protowire.VarintType)
+		fsData = protowire.AppendVarint(fsData, fanout)
+	}
+
+	var node []byte
+	for _, l := range links {
+		var link []byte
+		link = protowire.AppendTag(link, 1, protowire.BytesType)
+		link = protowire.AppendBytes(link, l.block.cid.Bytes())
+		link = protowire.AppendTag(link, 2, protowire.BytesType)
+		link = protowire.AppendBytes(link, []byte(l.name))
+		node = protowire.AppendTag(node, 2, protowire.BytesType)
+		node = protowire.AppendBytes(node, link)
+	}
+	node = protowire.AppendTag(node, 1, protowire.BytesType)
+	node = protowire.AppendBytes(node, fsData)
+
+	c, err := cid.V0Builder{}.Sum(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testBlock{cid: c, data: node}
+}
+
+func fileBlock(t *testing.T, data string, links ...testLink) testBlock {
+	return pbBlock(t, unixfsFile, data, 0, links...)
+}
+
+func dirBlock(t *testing.T, links ...testLink) testBlock {
+	return pbBlock(t, unixfsDirectory, "", 0, links...)
+}
+
+func shardBlock(t *testing.T, fanout uint64, links ...testLink) testBlock {
+	return pbBlock(t, unixfsHAMTShard, "", fanout, links...)
+}
+
+// encodeCAR encodes blocks as a CARv1 stream. The header is not parsed by
+// readCAR, so any bytes do.
+func encodeCAR(blocks ...testBlock) []byte {
+	header := []byte("car header")
+	out := binary.AppendUvarint(nil, uint64(len(header)))
+	out = append(out, header...)
+	for _, b := range blocks {
+		section := append(b.cid.Bytes(), b.data...)
+		out = binary.AppendUvarint(out, uint64(len(section)))
+		out = append(out, section...)
+	}
+	return out
+}
+
+// download reads car into a block store and writes root below a new
+// temporary directory, returning the path it was written to.
+func download(t *testing.T, car []byte, root cid.Cid) (string, error) {
+	t.Helper()
+
+	spool, err := os.CreateTemp(t.TempDir(), "dag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = spool.Close() })
+
+	blocks, err := readCAR(bytes.NewReader(car), spool)
+	if err != nil {
+		return "", err
+	}
+	dest := filepath.Join(t.TempDir(), "out")
+	return dest, blocks.writePath(root, dest)
+}
+
+// readTree returns the regular files below dir by slash-separated path.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			t.Errorf("%s is not a regular file", path)
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestWritePath(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(t *testing.T) (root testBlock, blocks []testBlock)
+		want  map[string]string
+	}{
+		{
+			name: "raw leaf file",
+			build: func(t *testing.T) (testBlock, []testBlock) {
+				leaf := rawBlock(t, "hello")
+				return leaf, []testBlock{leaf}
+			},
+			want: map[string]string{".": "hello"},
+		},
+		{
+			name: "single node file",
+			build: func(t *testing.T) (testBlock, []testBlock) {
+				file := fileBlock(t, "inline")
+				return file, []testBlock{file}
+			},
+			want: map[string]string{".": "inline"},
+		},
+		{
+			name: "chunked file",
+			build: func(t *testing.T) (testBlock, []testBlock) {
+				a, b, c := rawBlock(t, "chunk one, "), rawBlock(t, "chunk two, "), rawBlock(t, "chunk three")
+				inner := fileBlock(t, "", testLink{block: b}, testLink{block: c})
+				root := fileBlock(t, "", testLink{block: a}, testLink{block: inner})
+				return root, []testBlock{root, a, inner, b, c}
+			},
+			want: map[string]string{".": "chunk one, chunk two, chunk three"},
+		},
+		{
+			name: "directory",
+			build: func(t *testing.T) (testBlock, []testBlock) {
+				a := rawBlock(t, "a")
+				b := fileBlock(t, "b")
+				sub := dirBlock(t, testLink{name: "b.txt", block: b})
+				root := dirBlock(t, testLink{name: "a.txt", block: a}, testLink{name: "sub", block: sub})
+				return root, []testBlock{root, a, sub, b}
+			},
+			want: map[string]string{"a.txt": "a", "sub/b.txt": "b"},
+		},
+		{
+			name: "sharded directory",
+			build: func(t *testing.T) (testBlock, []testBlock) {
+				a, b, c := rawBlock(t, "a"), rawBlock(t, "b"), rawBlock(t, "c")
+				inner := shardBlock(t, 256, testLink{name: "1Fb.txt", block: b}, testLink{name: "C0c.txt", block: c})
+				root := shardBlock(t, 256, testLink{name: "0Aa.txt", block: a}, testLink{name: "7E", block: inner})
+				return root, []testBlock{root, a, inner, b, c}
+			},
+			want: map[string]string{"a.txt": "a", "b.txt": "b", "c.txt": "c"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, blocks := tt.build(t)
+			dest, err := download(t, encodeCAR(blocks...), root.cid)
+			if err != nil {
+				t.Fatalf("download: %v", err)
+			}
+
+			got := readTree(t, dest)
+			if len(got) != len(tt.want) {
+				t.Fatalf("files = %v, want %v", got, tt.want)
+			}
+			for name, want := range tt.want {
+				if got[name] != want {
+					t.Errorf("%s = %q, want %q", name, got[name], want)
+				}
+			}
+		})
+	}
+}
+
+func TestWritePathRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   func(t *testing.T) (root testBlock, blocks []testBlock)
+		wantErr string
+	}{
+		{
+			name: "missing block",
+			build: func(t *testing.T) (testBlock, []testBlock) {
+				a, b := rawBlock(t, "a"), rawBlock(t, "b")
+				root := fileBlock(t, "", testLink{block: a}, testLink{block: b})
+				return root, []testBlock{root, a}
+			},
+			wantErr: "missing from the export",
+		},
+		{
+			name: "symlink",
+			build: func(t *testing.T) (testBlock, []testBlock) {
+				link := pbBlock(t, unixfsSymlink, "/etc/passwd", 0)
+				root := dirBlock(t, testLink{name: "passwd", block: link})
+				return root, []testBlock{root, link}
+			},
+			wantErr: "is a symlink",
+		},
+		{
+			name: "parent entry",
+			build: func(t *testing.T) (testBlock, []testBlock) {
+				a := rawBlock(t, "a")
+				root := dirBlock(t, testLink{name: "..", block: a})
+				return root, []testBlock{root, a}
+			},
+			wantErr: "invalid entry name",
+		},
+		{
+			name: "entry with a separator",
+			build: func(t *testing.T) (testBlock, []testBlock) {
+				a := rawBlock(t, "a")
+				root := dirBlock(t, testLink{name: "../escape", block: a})
+				return root, []testBlock{root, a}
+			},
+			wantErr: "invalid entry name",
+		},
+		{
+			name: "absolute entry",
+			build: func(t *testing.T) (testBlock, []testBlock) {
+				a := rawBlock(t, "a")
+				root := dirBlock(t, testLink{name: "/tmp/escape", block: a})
+				return root, []testBlock{root, a}
+			},
+			wantErr: "invalid entry name",
+		},
+		{
+			name: "shard entry escaping the directory",
+			build: func(t *testing.T) (testBlock, []testBlock) {
+				a := rawBlock(t, "a")
+				root := shardBlock(t, 256, testLink{name: "0A..", block: a})
+				return root, []testBlock{root, a}
+			},
+			wantErr: "invalid entry name",
+		},
+		{
+			name: "directory linked as a file chunk",
+			build: func(t *testing.T) (testBlock, []testBlock) {
+				dir := dirBlock(t)
+				root := fileBlock(t, "", testLink{block: dir})
+				return root, []testBlock{root, dir}
+			},
+			wantErr: "is not part of a file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, blocks := tt.build(t)
+			dest, err := download(t, encodeCAR(blocks...), root.cid)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("download error = %v, want %q", err, tt.wantErr)
+			}
+			if dest != "" {
+				if _, statErr := os.Lstat(filepath.Join(filepath.Dir(dest), "escape")); statErr == nil {
+					t.Error("an entry was written outside the destination")
+				}
+			}
+		})
+	}
+}
+
+func TestReadCARRejectsTamperedBlock(t *testing.T) {
+	a := rawBlock(t, "original")
+	root := fileBlock(t, "", testLink{block: a})
+	a.data = []byte("tampered")
+
+	_, err := download(t, encodeCAR(root, a), root.cid)
+	if !errors.Is(err, ErrCIDMismatch) {
+		t.Fatalf("download error = %v, want %v", err, ErrCIDMismatch)
+	}
+}
+
+func TestReadCARRejectsMalformedStream(t *testing.T) {
+	a := rawBlock(t, "a")
+	car := encodeCAR(a)
+
+	tests := []struct {
+		name string
+		car  []byte
+	}{
+		{"empty header", []byte{0}},
+		{"truncated header", car[:5]},
+		{"truncated section", car[:len(car)-1]},
+		{"oversized section", append(encodeCAR(), binary.AppendUvarint(nil, maxCARSection+1)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := download(t, tt.car, a.cid); err == nil {
+				t.Fatal("download succeeded")
+			}
+		})
+	}
+}
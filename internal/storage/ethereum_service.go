@@ -3,17 +3,23 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/google/uuid"
+	"github.com/ipfs/go-cid"
 	shell "github.com/ipfs/go-ipfs-api"
 	"github.com/theblitlabs/gologger"
 	"github.com/theblitlabs/parity-client/internal/config"
 )
 
+// ErrCIDMismatch is returned by DownloadPath when a block does not hash to
+// its CID.
+var ErrCIDMismatch = errors.New("content does not match CID")
+
 type BlockchainService struct {
 	ipfsClient *shell.Shell
 	gatewayURL string
@@ -181,6 +187,72 @@ func (f *BlockchainService) DownloadFile(ctx context.Context, cid string, output
 	return nil
 }
 
+// DownloadPath downloads the file or directory cid to outputPath, which must
+// not exist. The node exports the DAG as a CAR stream and every block is
+// checked against its CID before it is used, so what is written is exactly
+// the content the CID names, however it was chunked. Symlinks in the DAG
+// are refused rather than created. On error, whatever was already written
+// is left for the caller to remove.
+func (f *BlockchainService) DownloadPath(ctx context.Context, cidStr string, outputPath string) error {
+	log := gologger.Get()
+
+	root, err := cid.Decode(cidStr)
+	if err != nil {
+		return fmt.Errorf("invalid CID %s: %w", cidStr, err)
+	}
+
+	log.Info().
+		Str("cid", cidStr).
+		Str("output", outputPath).
+		Msg("Downloading from IPFS")
+
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	spool, err := os.CreateTemp("", "parity-dag-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		_ = spool.Close()
+		if removeErr := os.Remove(spool.Name()); removeErr != nil {
+			log.Error().Err(removeErr).Str("path", spool.Name()).Msg("Failed to remove temporary file")
+		}
+	}()
+
+	resp, err := f.ipfsClient.Request("dag/export", root.String()).Send(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to export %s from IPFS: %w", cidStr, err)
+	}
+	defer func() {
+		if closeErr := resp.Close(); closeErr != nil {
+			log.Error().Err(closeErr).Msg("Error closing IPFS response")
+		}
+	}()
+	if resp.Error != nil {
+		return fmt.Errorf("failed to export %s from IPFS: %w", cidStr, resp.Error)
+	}
+
+	blocks, err := readCAR(resp.Output, spool)
+	if err != nil {
+		log.Error().Err(err).
+			Str("cid", cidStr).
+			Msg("Failed to download from IPFS")
+		return fmt.Errorf("failed to download %s from IPFS: %w", cidStr, err)
+	}
+	if err := blocks.writePath(root, outputPath); err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("cid", cidStr).
+		Str("output", outputPath).
+		Msg("Successfully downloaded from IPFS")
+
+	return nil
+}
+
 func (f *BlockchainService) GetFileURL(cid string) string {
 	return fmt.Sprintf("%s/ipfs/%s", f.gatewayURL, cid)
 }
@@ -1,6 +1,11 @@
 package task
 
-import "github.com/theblitlabs/parity-client/internal/docker/service"
+import (
+	"sort"
+	"strings"
+
+	"github.com/theblitlabs/parity-client/internal/docker/service"
+)
 
 type Config struct {
 	Command []string       `json:"command"`
@@ -12,11 +17,61 @@ type Environment struct {
 	Config service.Config `json:"config"`
 }
 
+// Request is a task submission. It names either a pre-built Image or a
+// Build to produce one, and may limit the resources the task gets on the
+// runner, set its environment and declare the files it reads and writes.
+// Outputs are paths in the container the runner publishes to IPFS once the
+// task finishes.
 type Request struct {
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	Image       string   `json:"image"`
-	Command     []string `json:"command"`
-	ImageHash   string   `json:"image_hash"`
-	CommandHash string   `json:"command_hash"`
+	Title       string                  `json:"title"`
+	Description string                  `json:"description"`
+	Image       string                  `json:"image"`
+	Command     []string                `json:"command"`
+	ImageHash   string                  `json:"image_hash"`
+	CommandHash string                  `json:"command_hash"`
+	Build       *BuildRequest           `json:"build,omitempty"`
+	Resources   *service.ResourceConfig `json:"resources,omitempty"`
+	Env         map[string]string       `json:"env,omitempty"`
+	Secrets     Secrets                 `json:"secrets,omitempty"`
+	Inputs      []Input                 `json:"inputs,omitempty"`
+	Outputs     []string                `json:"outputs,omitempty"`
+}
+
+// Input is a file or directory mounted into the task container at Mount.
+// It is either Path, a file or directory on the proxy host uploaded to
+// IPFS before the task is submitted, or CID, content already on IPFS. Only
+// the CID and mount are sent to the runner.
+type Input struct {
+	Path  string `json:"path,omitempty"`
+	CID   string `json:"cid,omitempty"`
+	Mount string `json:"mount"`
+}
+
+// Secrets maps environment variable names to secret values, which are
+// sealed to the runner before the task leaves the proxy. It formats as its
+// names only, so printing or logging it does not reveal the values.
+type Secrets map[string]string
+
+func (s Secrets) String() string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name+"=[redacted]")
+	}
+	sort.Strings(names)
+	return "map[" + strings.Join(names, " ") + "]"
+}
+
+func (s Secrets) GoString() string {
+	return s.String()
+}
+
+// BuildRequest builds the task image from source. The build context is
+// either Context, a directory on the proxy host, or a tar uploaded with the
+// request.
+type BuildRequest struct {
+	Context string `json:"context,omitempty"`
+	// Dockerfile is relative to the build context, Dockerfile when empty.
+	Dockerfile string            `json:"dockerfile,omitempty"`
+	Args       map[string]string `json:"args,omitempty"`
+	Target     string            `json:"target,omitempty"`
 }
@@ -0,0 +1,133 @@
+// Package tlsconfig builds TLS settings for the proxy listener and for
+// outbound calls from files named in the config.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/theblitlabs/parity-client/internal/config"
+	"github.com/theblitlabs/parity-client/internal/requestid"
+)
+
+// Server returns the TLS configuration for the proxy listener, or nil when no
+// certificate is configured. A client CA file makes callers present a
+// certificate signed by one of its CAs.
+func Server(cfg config.ServerConfig) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" && cfg.TLSKeyFile == "" {
+		if cfg.TLSClientCAFile != "" {
+			return nil, errors.New("SERVER_TLS_CLIENT_CA_FILE requires SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE")
+		}
+		return nil, nil
+	}
+
+	cert, err := loadKeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if cfg.TLSClientCAFile != "" {
+		pool, err := loadPool(x509.NewCertPool(), cfg.TLSClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsCfg, nil
+}
+
+// Client returns the TLS configuration for outbound calls, or nil when
+// neither a CA bundle nor a client certificate is configured. The CA bundle
+// is trusted in addition to the system roots.
+func Client(cfg config.TLSConfig) (*tls.Config, error) {
+	if cfg.CAFile == "" && cfg.ClientCertFile == "" && cfg.ClientKeyFile == "" {
+		return nil, nil
+	}
+
+	tlsCfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CAFile != "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil || roots == nil {
+			roots = x509.NewCertPool()
+		}
+		if tlsCfg.RootCAs, err = loadPool(roots, cfg.CAFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		cert, err := loadKeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsCfg, nil
+}
+
+// Transport returns the transport for calls to the runner, the federated
+// learning server and the proxy itself: http.DefaultTransport when cfg sets
+// nothing, or else a copy of it using Client(cfg). Only clients given this
+// transport present the client certificate; calls to other hosts keep the
+// default. A request ID wrapper installed on the default transport is kept.
+func Transport(cfg config.TLSConfig) (http.RoundTripper, error) {
+	tlsCfg, err := Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsCfg == nil {
+		return http.DefaultTransport, nil
+	}
+
+	rt := http.DefaultTransport
+	wrapped, isWrapped := rt.(*requestid.Transport)
+	if isWrapped {
+		rt = wrapped.Base
+	}
+	base, ok := rt.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("cannot configure TLS on default transport of type %T", rt)
+	}
+
+	transport := base.Clone()
+	transport.TLSClientConfig = tlsCfg
+	if isWrapped {
+		return requestid.NewTransport(transport, wrapped.Fallback), nil
+	}
+	return transport, nil
+}
+
+func loadKeyPair(certFile, keyFile string) (tls.Certificate, error) {
+	if certFile == "" || keyFile == "" {
+		return tls.Certificate{}, errors.New("both a certificate and a key file are required")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to load certificate %s: %w", certFile, err)
+	}
+	return cert, nil
+}
+
+func loadPool(pool *x509.CertPool, path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
@@ -23,6 +23,12 @@ func WriteJSON(w http.ResponseWriter, statusCode int, data interface{}) error {
 	return json.NewEncoder(w).Encode(data)
 }
 
+// ViolationError is an HTTPError that lists the rules a request broke.
+type ViolationError struct {
+	HTTPError
+	Violations []string `json:"violations"`
+}
+
 func WriteError(w http.ResponseWriter, statusCode int, message string) error {
 	return WriteJSON(w, statusCode, HTTPError{
 		Status:  statusCode,
@@ -30,6 +36,13 @@ func WriteError(w http.ResponseWriter, statusCode int, message string) error {
 	})
 }
 
+func WriteViolations(w http.ResponseWriter, statusCode int, message string, violations []string) error {
+	return WriteJSON(w, statusCode, ViolationError{
+		HTTPError:  HTTPError{Status: statusCode, Message: message},
+		Violations: violations,
+	})
+}
+
 func CopyHeaders(dst, src http.Header) {
 	for header, values := range src {
 		for _, value := range values {
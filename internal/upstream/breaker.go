@@ -0,0 +1,176 @@
+package upstream
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// State is the position of a circuit breaker.
+type State string
+
+const (
+	StateClosed   State = "closed"
+	StateOpen     State = "open"
+	StateHalfOpen State = "half_open"
+)
+
+// OpenError is returned instead of forwarding a request while the breaker is
+// open.
+type OpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("runner unavailable: circuit breaker open, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// Status is a point-in-time view of a Breaker for health reporting.
+type Status struct {
+	State               State      `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAfter          string     `json:"retry_after,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+}
+
+// Breaker stops traffic to an upstream after threshold consecutive failures.
+// Once cooldown has passed it lets a single probe request through; a success
+// closes the breaker again and a failure re-opens it for another cooldown.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	openedAt  time.Time
+	probeAt   time.Time
+	lastError string
+	now       func() time.Time
+}
+
+// NewBreaker creates a closed breaker. Zero values fall back to opening
+// after 5 consecutive failures and probing again after 30s.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+
+	return &Breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     StateClosed,
+		now:       time.Now,
+	}
+}
+
+// Allow reports whether a request may be sent. When it may not, it returns
+// how long the caller should wait before trying again.
+func (b *Breaker) Allow() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	switch b.state {
+	case StateOpen:
+		if wait := b.openedAt.Add(b.cooldown).Sub(now); wait > 0 {
+			return wait, false
+		}
+		b.state = StateHalfOpen
+		b.probeAt = now
+		return 0, true
+	case StateHalfOpen:
+		// Only one probe at a time, but don't wait forever on a probe
+		// whose outcome was never reported.
+		if wait := b.probeAt.Add(b.cooldown).Sub(now); wait > 0 {
+			return wait, false
+		}
+		b.probeAt = now
+		return 0, true
+	}
+	return 0, true
+}
+
+// Available reports whether Allow would currently let a request through,
+// without claiming the half-open probe.
+func (b *Breaker) Available() bool {
+	return b.Wait() == 0
+}
+
+// Wait returns how long until the breaker will next allow a request, or zero
+// if it allows one now.
+func (b *Breaker) Wait() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var until time.Time
+	switch b.state {
+	case StateOpen:
+		until = b.openedAt.Add(b.cooldown)
+	case StateHalfOpen:
+		until = b.probeAt.Add(b.cooldown)
+	default:
+		return 0
+	}
+	if wait := until.Sub(b.now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Success records a request that reached the upstream and closes the breaker.
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = StateClosed
+	b.failures = 0
+	b.lastError = ""
+}
+
+// Failure records a request that failed because of the upstream.
+func (b *Breaker) Failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if err != nil {
+		b.lastError = err.Error()
+	}
+
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Status returns the current breaker state.
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := Status{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	if b.state == StateOpen {
+		if wait := b.openedAt.Add(b.cooldown).Sub(b.now()); wait > 0 {
+			status.RetryAfter = wait.Round(time.Second).String()
+		}
+	}
+	return status
+}
@@ -0,0 +1,132 @@
+package upstream
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTimeout     = 60 * time.Second
+	defaultRetries     = 2
+	defaultBaseBackoff = 200 * time.Millisecond
+	defaultMaxBackoff  = 5 * time.Second
+)
+
+// Policy controls how long a forwarded request may take and how it is
+// retried.
+type Policy struct {
+	Timeout       time.Duration
+	RouteTimeouts map[string]time.Duration
+	Retries       int
+	BaseBackoff   time.Duration
+	MaxBackoff    time.Duration
+}
+
+// NewPolicy builds a Policy. routeTimeouts is a comma-separated list of
+// route=duration pairs, for example "llm=10m,storage=30m". Zero values fall
+// back to a 60s timeout, 2 retries and backoff growing from 200ms to at
+// most 5s; a negative retries value disables retries.
+func NewPolicy(timeout time.Duration, routeTimeouts string, retries int, baseBackoff, maxBackoff time.Duration) (*Policy, error) {
+	overrides, err := ParseRouteTimeouts(routeTimeouts)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	switch {
+	case retries < 0:
+		retries = 0
+	case retries == 0:
+		retries = defaultRetries
+	}
+	if baseBackoff <= 0 {
+		baseBackoff = defaultBaseBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+
+	return &Policy{
+		Timeout:       timeout,
+		RouteTimeouts: overrides,
+		Retries:       retries,
+		BaseBackoff:   baseBackoff,
+		MaxBackoff:    maxBackoff,
+	}, nil
+}
+
+// ParseRouteTimeouts parses a comma-separated list of route=duration pairs.
+func ParseRouteTimeouts(list string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid route timeout %q: expected route=duration", entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid route timeout %q: expected a positive duration", entry)
+		}
+		timeouts[strings.TrimSpace(route)] = d
+	}
+	return timeouts, nil
+}
+
+// TimeoutFor returns the timeout for a route, falling back to Timeout.
+func (p *Policy) TimeoutFor(route string) time.Duration {
+	if d, ok := p.RouteTimeouts[route]; ok {
+		return d
+	}
+	return p.Timeout
+}
+
+// Attempts returns how many times req may be sent. Only idempotent requests
+// without a body are retried, since the body has already been consumed by
+// the first attempt.
+func (p *Policy) Attempts(req *http.Request) int {
+	if !idempotent(req.Method) || req.ContentLength != 0 {
+		return 1
+	}
+	return p.Retries + 1
+}
+
+// Backoff returns a jittered delay before retry number attempt (starting at 1),
+// drawn uniformly from [0, min(MaxBackoff, BaseBackoff*2^(attempt-1))].
+func (p *Policy) Backoff(attempt int) time.Duration {
+	ceiling := p.BaseBackoff
+	for i := 1; i < attempt && ceiling < p.MaxBackoff; i++ {
+		ceiling *= 2
+	}
+	if ceiling > p.MaxBackoff {
+		ceiling = p.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// RetryableStatus reports whether a runner response indicates a transient
+// failure worth retrying and counting against the breaker.
+func RetryableStatus(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
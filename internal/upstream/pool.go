@@ -0,0 +1,372 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/theblitlabs/gologger"
+)
+
+const (
+	StrategyRoundRobin   = "round_robin"
+	StrategyLeastLatency = "least_latency"
+
+	defaultHealthInterval = 15 * time.Second
+	defaultPinRetention   = 24 * time.Hour
+
+	// unhealthyThreshold consecutive failed probes eject an upstream; a
+	// single successful probe brings it back.
+	unhealthyThreshold = 2
+	probeTimeout       = 5 * time.Second
+	latencyWeight      = 0.3
+)
+
+var ErrNoUpstreams = errors.New("no runner upstreams configured")
+
+// Upstream is one runner server the proxy can forward to.
+type Upstream struct {
+	URL     string
+	breaker *Breaker
+
+	mu            sync.Mutex
+	healthy       bool
+	probeFailures int
+	latency       time.Duration
+	lastCheck     time.Time
+	lastError     string
+}
+
+// Breaker returns the circuit breaker guarding this upstream.
+func (u *Upstream) Breaker() *Breaker {
+	return u.breaker
+}
+
+// ObserveLatency folds a response time into the upstream's moving average.
+func (u *Upstream) ObserveLatency(d time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.observeLatencyLocked(d)
+}
+
+func (u *Upstream) observeLatencyLocked(d time.Duration) {
+	if u.latency == 0 {
+		u.latency = d
+		return
+	}
+	u.latency = time.Duration(latencyWeight*float64(d) + (1-latencyWeight)*float64(u.latency))
+}
+
+func (u *Upstream) snapshot() (healthy bool, latency time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.healthy, u.latency
+}
+
+// UpstreamStatus is a point-in-time view of an Upstream for health reporting.
+type UpstreamStatus struct {
+	URL       string    `json:"url"`
+	Healthy   bool      `json:"healthy"`
+	Latency   string    `json:"latency,omitempty"`
+	LastCheck time.Time `json:"last_check,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+	Breaker   Status    `json:"breaker"`
+}
+
+type pin struct {
+	upstream *Upstream
+	at       time.Time
+}
+
+// Pool balances requests across runner upstreams. It ejects upstreams that
+// fail active health probes and remembers which upstream accepted each task
+// so follow-up calls for that task are sent to the same place.
+type Pool struct {
+	upstreams []*Upstream
+	strategy  string
+	interval  time.Duration
+	client    *http.Client
+	next      atomic.Uint64
+
+	mu   sync.Mutex
+	pins map[string]pin
+
+	stop   context.CancelFunc
+	done   chan struct{}
+	logger zerolog.Logger
+}
+
+// NewPool creates a pool over a comma-separated list of runner URLs. Each
+// upstream gets its own breaker built from breakerThreshold and
+// breakerCooldown. An empty strategy means round-robin and a zero
+// healthInterval probes every 15s; zero breaker settings take NewBreaker's
+// defaults. Health probes go over transport, or http.DefaultTransport when
+// it is nil.
+func NewPool(urls, strategy string, healthInterval time.Duration, breakerThreshold int, breakerCooldown time.Duration, transport http.RoundTripper) (*Pool, error) {
+	switch strategy {
+	case "":
+		strategy = StrategyRoundRobin
+	case StrategyRoundRobin, StrategyLeastLatency:
+	default:
+		return nil, fmt.Errorf("unknown load balancing strategy %q", strategy)
+	}
+	if healthInterval <= 0 {
+		healthInterval = defaultHealthInterval
+	}
+
+	p := &Pool{
+		strategy: strategy,
+		interval: healthInterval,
+		client:   &http.Client{Timeout: probeTimeout, Transport: transport},
+		pins:     make(map[string]pin),
+		logger:   gologger.Get().With().Str("component", "upstream").Logger(),
+	}
+
+	seen := make(map[string]bool)
+	for _, raw := range strings.Split(urls, ",") {
+		raw = strings.TrimSuffix(strings.TrimSpace(raw), "/")
+		if raw == "" || seen[raw] {
+			continue
+		}
+		if u, err := url.Parse(raw); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid runner URL %q", raw)
+		}
+		seen[raw] = true
+		p.upstreams = append(p.upstreams, &Upstream{
+			URL:     raw,
+			breaker: NewBreaker(breakerThreshold, breakerCooldown),
+			healthy: true,
+		})
+	}
+
+	if len(p.upstreams) == 0 {
+		return nil, ErrNoUpstreams
+	}
+	return p, nil
+}
+
+// Start probes every upstream's /health endpoint on the configured interval
+// until Stop is called.
+func (p *Pool) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.stop = cancel
+	p.done = make(chan struct{})
+
+	go func() {
+		defer close(p.done)
+
+		p.probeAll(ctx)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.probeAll(ctx)
+			}
+		}
+	}()
+}
+
+// Stop ends health probing and waits for an in-flight probe round to finish.
+func (p *Pool) Stop() {
+	if p.stop == nil {
+		return
+	}
+	p.stop()
+	<-p.done
+}
+
+func (p *Pool) probeAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, u := range p.upstreams {
+		wg.Add(1)
+		go func(u *Upstream) {
+			defer wg.Done()
+			p.probe(ctx, u)
+		}(u)
+	}
+	wg.Wait()
+}
+
+func (p *Pool) probe(ctx context.Context, u *Upstream) {
+	start := time.Now()
+	err := p.check(ctx, u.URL)
+	if ctx.Err() != nil {
+		return
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.lastCheck = time.Now()
+	if err != nil {
+		u.lastError = err.Error()
+		u.probeFailures++
+		if u.healthy && u.probeFailures >= unhealthyThreshold {
+			u.healthy = false
+			p.logger.Warn().Err(err).Str("upstream", u.URL).Msg("Ejecting unhealthy runner upstream")
+		}
+		return
+	}
+
+	if !u.healthy {
+		p.logger.Info().Str("upstream", u.URL).Msg("Runner upstream healthy again")
+	}
+	u.healthy = true
+	u.probeFailures = 0
+	u.lastError = ""
+	u.observeLatencyLocked(time.Since(start))
+}
+
+func (p *Pool) check(ctx context.Context, baseURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Pick selects an upstream for a new request, skipping those in tried. It
+// prefers healthy upstreams whose breaker is closed; if every upstream has
+// been ejected by health probes it falls back to any whose breaker allows
+// traffic rather than refusing outright. When nothing is available it returns
+// an *OpenError with the shortest wait.
+func (p *Pool) Pick(tried map[*Upstream]bool) (*Upstream, error) {
+	var healthy, fallback []*Upstream
+	for _, u := range p.upstreams {
+		if tried[u] || !u.breaker.Available() {
+			continue
+		}
+		if ok, _ := u.snapshot(); ok {
+			healthy = append(healthy, u)
+		} else {
+			fallback = append(fallback, u)
+		}
+	}
+
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = fallback
+	}
+
+	for len(candidates) > 0 {
+		i := p.choose(candidates)
+		u := candidates[i]
+		if _, ok := u.breaker.Allow(); ok {
+			return u, nil
+		}
+		// Lost a race for the half-open probe; try the others.
+		candidates = append(candidates[:i:i], candidates[i+1:]...)
+	}
+
+	return nil, p.unavailable(tried)
+}
+
+func (p *Pool) choose(candidates []*Upstream) int {
+	if p.strategy == StrategyLeastLatency {
+		best := 0
+		_, bestLatency := candidates[0].snapshot()
+		for i := 1; i < len(candidates); i++ {
+			// Unmeasured upstreams report zero and are tried first.
+			if _, latency := candidates[i].snapshot(); latency < bestLatency {
+				best, bestLatency = i, latency
+			}
+		}
+		return best
+	}
+	return int(p.next.Add(1)-1) % len(candidates)
+}
+
+func (p *Pool) unavailable(tried map[*Upstream]bool) error {
+	var wait time.Duration
+	for _, u := range p.upstreams {
+		if tried[u] {
+			continue
+		}
+		if w := u.breaker.Wait(); w > 0 && (wait == 0 || w < wait) {
+			wait = w
+		}
+	}
+	if wait == 0 {
+		wait = time.Second
+	}
+	return &OpenError{RetryAfter: wait}
+}
+
+// Pinned returns the upstream that accepted taskID, if known.
+func (p *Pool) Pinned(taskID string) *Upstream {
+	if taskID == "" {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if pn, ok := p.pins[taskID]; ok {
+		return pn.upstream
+	}
+	return nil
+}
+
+// Pin records that taskID lives on u.
+func (p *Pool) Pin(taskID string, u *Upstream) {
+	if taskID == "" || u == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for id, pn := range p.pins {
+		if now.Sub(pn.at) > defaultPinRetention {
+			delete(p.pins, id)
+		}
+	}
+	p.pins[taskID] = pin{upstream: u, at: now}
+}
+
+// Upstreams returns every upstream in configuration order.
+func (p *Pool) Upstreams() []*Upstream {
+	return p.upstreams
+}
+
+// Status returns the state of every upstream in configuration order.
+func (p *Pool) Status() []UpstreamStatus {
+	statuses := make([]UpstreamStatus, 0, len(p.upstreams))
+	for _, u := range p.upstreams {
+		u.mu.Lock()
+		status := UpstreamStatus{
+			URL:       u.URL,
+			Healthy:   u.healthy,
+			LastCheck: u.lastCheck,
+			LastError: u.lastError,
+		}
+		if u.latency > 0 {
+			status.Latency = u.latency.String()
+		}
+		u.mu.Unlock()
+
+		status.Breaker = u.breaker.Status()
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
@@ -28,3 +28,9 @@ func EnsureConfigDir() error {
 	configDir := GetParityConfigDir()
 	return os.MkdirAll(configDir, 0o755)
 }
+
+// GetDefaultSocketPath returns where the proxy listens when SERVER_SOCKET is
+// enabled without an explicit SERVER_SOCKET_PATH.
+func GetDefaultSocketPath() string {
+	return filepath.Join(GetParityConfigDir(), "proxy.sock")
+}
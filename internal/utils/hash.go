@@ -3,23 +3,18 @@ package utils
 import (
 	"crypto/sha256"
 	"fmt"
-	"os/exec"
 	"strings"
 )
 
-func ComputeImageHash(imageName string) (string, error) {
-	cmd := exec.Command("docker", "save", imageName)
-	output, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("failed to save image for hashing: %w", err)
-	}
-
-	hash := sha256.Sum256(output)
-	return fmt.Sprintf("%x", hash), nil
-}
-
-func ComputeCommandHash(command []string) string {
+// ComputeCommandHash hashes the command joined by spaces. When resources,
+// the canonical form of the task's resource limits, is not empty it is
+// appended after a newline so the limits cannot be changed without
+// changing the hash.
+func ComputeCommandHash(command []string, resources string) string {
 	commandStr := strings.Join(command, " ")
+	if resources != "" {
+		commandStr += "\n" + resources
+	}
 	hash := sha256.Sum256([]byte(commandStr))
 	return fmt.Sprintf("%x", hash)
 }
@@ -2,17 +2,24 @@ package utils
 
 import (
 	"fmt"
+	"math"
 	"math/big"
+	"path"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ipfs/go-cid"
 )
 
 var (
 	ethereumAddressRegex = regexp.MustCompile(`^0x[a-fA-F0-9]{40}$`)
 	privateKeyRegex      = regexp.MustCompile(`^[a-fA-F0-9]{64}$`)
 	urlRegex             = regexp.MustCompile(`^https?://[^\s/$.?#].[^\s]*$`)
+	envNameRegex         = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	memoryRegex          = regexp.MustCompile(`^(\d+(?:\.\d+)?) ?([kKmMgGtT])?(?:[iI]?[bB])?$`)
 )
 
 type ValidationError struct {
@@ -130,6 +137,133 @@ func ValidateDockerImage(image string) error {
 	return nil
 }
 
+const (
+	// MinMemoryBytes is the smallest memory limit Docker accepts.
+	MinMemoryBytes = 6 << 20
+
+	MinCPUShares   = 2
+	MaxCPUShares   = 262144
+	MaxTaskTimeout = 24 * time.Hour
+)
+
+var memoryUnits = map[string]int64{
+	"":  1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+}
+
+// ParseMemory returns the number of bytes in a memory limit written as
+// Docker does, such as 512m, 1.5g, 2GiB or 1073741824. Units are binary.
+func ParseMemory(memory string) (int64, error) {
+	matches := memoryRegex.FindStringSubmatch(strings.TrimSpace(memory))
+	if matches == nil {
+		return 0, ValidationError{Field: "memory", Message: "invalid memory format, expected a number with an optional k, m, g or t unit"}
+	}
+
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, ValidationError{Field: "memory", Message: "invalid memory format, expected a number with an optional k, m, g or t unit"}
+	}
+
+	bytes := value * float64(memoryUnits[strings.ToLower(matches[2])])
+	if bytes > math.MaxInt64 {
+		return 0, ValidationError{Field: "memory", Message: "memory limit is too large"}
+	}
+	return int64(bytes), nil
+}
+
+func ValidateMemory(memory string) error {
+	bytes, err := ParseMemory(memory)
+	if err != nil {
+		return err
+	}
+
+	if bytes < MinMemoryBytes {
+		return ValidationError{Field: "memory", Message: "memory limit must be at least 6m"}
+	}
+
+	return nil
+}
+
+func ValidateCPUShares(shares int64) error {
+	if shares < MinCPUShares || shares > MaxCPUShares {
+		return ValidationError{Field: "cpu_shares", Message: fmt.Sprintf("CPU shares must be between %d and %d", MinCPUShares, MaxCPUShares)}
+	}
+
+	return nil
+}
+
+// ParseTimeout returns a task timeout written as a Go duration, such as 90s
+// or 1h30m.
+func ParseTimeout(timeout string) (time.Duration, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(timeout))
+	if err != nil {
+		return 0, ValidationError{Field: "timeout", Message: "invalid timeout format, expected a duration such as 30s or 1h30m"}
+	}
+
+	if d <= 0 {
+		return 0, ValidationError{Field: "timeout", Message: "timeout must be greater than 0"}
+	}
+
+	if d > MaxTaskTimeout {
+		return 0, ValidationError{Field: "timeout", Message: fmt.Sprintf("timeout is too long (max %s)", MaxTaskTimeout)}
+	}
+
+	return d, nil
+}
+
+// MaxSecretSize bounds a single task secret value.
+const MaxSecretSize = 64 << 10
+
+// ValidateEnvName checks that name, given for field, can be used as an
+// environment variable name.
+func ValidateEnvName(field, name string) error {
+	if name == "" {
+		return ValidationError{Field: field, Message: "variable name is required"}
+	}
+
+	if !envNameRegex.MatchString(name) {
+		return ValidationError{Field: field, Message: fmt.Sprintf("invalid variable name %q, expected letters, digits and underscores not starting with a digit", name)}
+	}
+
+	return nil
+}
+
+// ValidateCID checks that value, given for field, is a well-formed IPFS
+// content identifier.
+func ValidateCID(field, value string) error {
+	if value == "" {
+		return ValidationError{Field: field, Message: "CID is required"}
+	}
+
+	if _, err := cid.Decode(value); err != nil {
+		return ValidationError{Field: field, Message: fmt.Sprintf("invalid CID %q: %v", value, err)}
+	}
+
+	return nil
+}
+
+// ValidateContainerPath checks that p, given for field, is an absolute path
+// inside the task container other than the root, and returns it cleaned.
+func ValidateContainerPath(field, p string) (string, error) {
+	if p == "" {
+		return "", ValidationError{Field: field, Message: "path is required"}
+	}
+
+	if !path.IsAbs(p) {
+		return "", ValidationError{Field: field, Message: fmt.Sprintf("path %q must be absolute", p)}
+	}
+
+	cleaned := path.Clean(p)
+	if cleaned == "/" {
+		return "", ValidationError{Field: field, Message: "path cannot be the container root"}
+	}
+
+	return cleaned, nil
+}
+
 func ValidateReward(reward float64) error {
 	if reward <= 0 {
 		return ValidationError{Field: "reward", Message: "reward must be greater than 0"}
@@ -0,0 +1,40 @@
+package imagehash
+
+import "io"
+
+// Hasher computes an ImageHash from an archive written to it, so the hash
+// can be taken in the same pass that streams the archive elsewhere.
+// Sum must be called once writing stops, even after a failure, to release
+// the goroutine reading the archive.
+type Hasher struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+	hash ImageHash
+	err  error
+}
+
+func NewHasher() *Hasher {
+	pr, pw := io.Pipe()
+	h := &Hasher{pw: pw, done: make(chan struct{})}
+
+	go func() {
+		defer close(h.done)
+		h.hash, h.err = Compute(pr)
+		// Keep accepting writes after the end of the archive or an error
+		// so the writer is never blocked.
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+
+	return h
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	return h.pw.Write(p)
+}
+
+// Sum ends the archive and returns its hash.
+func (h *Hasher) Sum() (ImageHash, error) {
+	_ = h.pw.Close()
+	<-h.done
+	return h.hash, h.err
+}
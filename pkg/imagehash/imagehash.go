@@ -0,0 +1,258 @@
+// Package imagehash computes the content-addressed identity of a container
+// image from the tar archive produced by `docker save`, `podman save
+// --format docker-archive` or `ctr images export`.
+//
+// An image hash is the digest of the image's OCI config blob,
+//
+//	sha256:<HEX-SHA256-OF-CONFIG-JSON>
+//
+// which for Docker is also the image ID. The config lists the digest of each
+// uncompressed layer in rootfs.diff_ids, so the archive is only accepted
+// when every layer named by its manifest.json hashes to the matching entry.
+// Nothing depends on the order or timestamps of the tar entries, so the
+// runner gets the same hash by recomputing it from the archive it received.
+package imagehash
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	Algorithm = "sha256"
+
+	// maxMetadataSize bounds the JSON documents kept in memory while the
+	// archive is read; layer contents are only ever hashed.
+	maxMetadataSize = 4 << 20
+	maxLinkDepth    = 16
+)
+
+var (
+	ErrInvalidArchive = errors.New("invalid image archive")
+	ErrLayerMismatch  = errors.New("image layer does not match config")
+	ErrMismatch       = errors.New("image hash does not match")
+)
+
+// ImageHash identifies an image by its config digest and the ordered
+// digests of its uncompressed layers.
+type ImageHash struct {
+	Config string   `json:"config"`
+	Layers []string `json:"layers"`
+}
+
+// String returns the config digest, which is the image hash sent as
+// image_hash.
+func (h ImageHash) String() string {
+	return h.Config
+}
+
+// Matches reports whether digest names this image. A bare hex digest is
+// read as SHA-256.
+func (h ImageHash) Matches(digest string) bool {
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if !strings.Contains(digest, ":") {
+		digest = Algorithm + ":" + digest
+	}
+	return digest == h.Config
+}
+
+// Verify computes the hash of the archive read from r and checks that it
+// matches expected.
+func Verify(r io.Reader, expected string) (ImageHash, error) {
+	hash, err := Compute(r)
+	if err != nil {
+		return ImageHash{}, err
+	}
+	if !hash.Matches(expected) {
+		return hash, fmt.Errorf("%w: expected %s, got %s", ErrMismatch, expected, hash.Config)
+	}
+	return hash, nil
+}
+
+// entry is what Compute remembers about one file in the archive.
+type entry struct {
+	digest   string // of the stored bytes
+	diffID   string // of the decompressed bytes, for gzip layers
+	metadata []byte // the contents, for small JSON documents
+	link     string // the target, for symlinks and hard links
+}
+
+// Compute reads a single-image archive from r and returns its hash. It
+// reads r to the end of the tar archive.
+func Compute(r io.Reader) (ImageHash, error) {
+	entries := make(map[string]*entry)
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ImageHash{}, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+
+		name := cleanName(hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			e, err := readEntry(tr, hdr.Size)
+			if err != nil {
+				return ImageHash{}, fmt.Errorf("%w: reading %s: %v", ErrInvalidArchive, name, err)
+			}
+			entries[name] = e
+		case tar.TypeSymlink:
+			entries[name] = &entry{link: cleanName(path.Join(path.Dir(name), hdr.Linkname))}
+		case tar.TypeLink:
+			entries[name] = &entry{link: cleanName(hdr.Linkname)}
+		}
+	}
+
+	return fromEntries(entries)
+}
+
+func fromEntries(entries map[string]*entry) (ImageHash, error) {
+	manifestEntry, err := resolve(entries, "manifest.json")
+	if err != nil || manifestEntry.metadata == nil {
+		return ImageHash{}, fmt.Errorf("%w: no manifest.json", ErrInvalidArchive)
+	}
+
+	var manifest []struct {
+		Config string   `json:"Config"`
+		Layers []string `json:"Layers"`
+	}
+	if err := json.Unmarshal(manifestEntry.metadata, &manifest); err != nil {
+		return ImageHash{}, fmt.Errorf("%w: manifest.json: %v", ErrInvalidArchive, err)
+	}
+	if len(manifest) != 1 {
+		return ImageHash{}, fmt.Errorf("%w: expected one image, archive has %d", ErrInvalidArchive, len(manifest))
+	}
+
+	configName := cleanName(manifest[0].Config)
+	configEntry, err := resolve(entries, configName)
+	if err != nil {
+		return ImageHash{}, err
+	}
+	if configEntry.metadata == nil {
+		return ImageHash{}, fmt.Errorf("%w: config %s is not a JSON document", ErrInvalidArchive, configName)
+	}
+	if err := checkBlobName(configName, configEntry.digest); err != nil {
+		return ImageHash{}, err
+	}
+
+	var config struct {
+		RootFS struct {
+			DiffIDs []string `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	if err := json.Unmarshal(configEntry.metadata, &config); err != nil {
+		return ImageHash{}, fmt.Errorf("%w: config %s: %v", ErrInvalidArchive, configName, err)
+	}
+
+	diffIDs := config.RootFS.DiffIDs
+	layers := manifest[0].Layers
+	if len(layers) != len(diffIDs) {
+		return ImageHash{}, fmt.Errorf("%w: manifest lists %d layers, config lists %d", ErrLayerMismatch, len(layers), len(diffIDs))
+	}
+
+	for i, layer := range layers {
+		layerName := cleanName(layer)
+		layerEntry, err := resolve(entries, layerName)
+		if err != nil {
+			return ImageHash{}, err
+		}
+		if err := checkBlobName(layerName, layerEntry.digest); err != nil {
+			return ImageHash{}, err
+		}
+
+		got := layerEntry.digest
+		if layerEntry.diffID != "" {
+			got = layerEntry.diffID
+		}
+		if !strings.EqualFold(got, diffIDs[i]) {
+			return ImageHash{}, fmt.Errorf("%w: layer %d (%s) is %s, config expects %s", ErrLayerMismatch, i, layerName, got, diffIDs[i])
+		}
+	}
+
+	return ImageHash{
+		Config: configEntry.digest,
+		Layers: append([]string{}, diffIDs...),
+	}, nil
+}
+
+// readEntry hashes one file, decompressing it as well when it is gzipped,
+// and keeps it when it looks like a small JSON document.
+func readEntry(r io.Reader, size int64) (*entry, error) {
+	raw := sha256.New()
+	br := bufio.NewReader(io.TeeReader(r, raw))
+	head, _ := br.Peek(2)
+
+	e := &entry{}
+	switch {
+	case len(head) == 2 && head[0] == 0x1f && head[1] == 0x8b:
+		if gz, err := gzip.NewReader(br); err == nil {
+			diff := sha256.New()
+			if _, err := io.Copy(diff, gz); err == nil {
+				e.diffID = digestOf(diff.Sum(nil))
+			}
+		}
+	case len(head) > 0 && (head[0] == '{' || head[0] == '[') && size <= maxMetadataSize:
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return nil, err
+		}
+		e.metadata = data
+	}
+
+	if _, err := io.Copy(io.Discard, br); err != nil {
+		return nil, err
+	}
+	e.digest = digestOf(raw.Sum(nil))
+	return e, nil
+}
+
+func resolve(entries map[string]*entry, name string) (*entry, error) {
+	for i := 0; i < maxLinkDepth; i++ {
+		e, ok := entries[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: missing %s", ErrInvalidArchive, name)
+		}
+		if e.link == "" {
+			return e, nil
+		}
+		name = e.link
+	}
+	return nil, fmt.Errorf("%w: too many links resolving %s", ErrInvalidArchive, name)
+}
+
+// checkBlobName rejects content-addressed files, such as OCI layout blobs
+// at blobs/sha256/<hex>, whose contents do not hash to their name.
+func checkBlobName(name, digest string) error {
+	base := strings.TrimSuffix(path.Base(name), ".json")
+	if len(base) != sha256.Size*2 {
+		return nil
+	}
+	if _, err := hex.DecodeString(base); err != nil {
+		return nil
+	}
+	if !strings.EqualFold(Algorithm+":"+base, digest) {
+		return fmt.Errorf("%w: %s has digest %s", ErrInvalidArchive, name, digest)
+	}
+	return nil
+}
+
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func digestOf(sum []byte) string {
+	return Algorithm + ":" + hex.EncodeToString(sum)
+}
@@ -0,0 +1,286 @@
+package imagehash
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+type archiveFile struct {
+	name string
+	data []byte
+	link string // symlink target, when set
+}
+
+func sha256Digest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// buildArchive returns a docker save archive of one image with the given
+// uncompressed layers, the image's config digest, and its layer digests.
+func buildArchive(t *testing.T, layers ...[]byte) ([]archiveFile, string, []string) {
+	t.Helper()
+
+	diffIDs := make([]string, len(layers))
+	var files []archiveFile
+	var layerNames []string
+	for i, layer := range layers {
+		diffIDs[i] = sha256Digest(layer)
+		name := fmt.Sprintf("layer%d/layer.tar", i)
+		files = append(files, archiveFile{name: name, data: layer})
+		layerNames = append(layerNames, name)
+	}
+
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": "amd64",
+		"os":           "linux",
+		"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": diffIDs},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configName := fmt.Sprintf("%x.json", sha256.Sum256(config))
+
+	manifest, err := json.Marshal([]map[string]interface{}{{
+		"Config":   configName,
+		"RepoTags": []string{"example:latest"},
+		"Layers":   layerNames,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files = append(files,
+		archiveFile{name: configName, data: config},
+		archiveFile{name: "manifest.json", data: manifest},
+	)
+	return files, sha256Digest(config), diffIDs
+}
+
+func writeTar(t *testing.T, files []archiveFile) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.data)), Typeflag: tar.TypeReg}
+		if f.link != "" {
+			hdr = &tar.Header{Name: f.name, Linkname: f.link, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if f.link == "" {
+			if _, err := tw.Write(f.data); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompute(t *testing.T) {
+	files, config, layers := buildArchive(t, []byte("layer one"), []byte("layer two"))
+
+	hash, err := Compute(bytes.NewReader(writeTar(t, files)))
+	if err != nil {
+		t.Fatalf("Compute: %v", err)
+	}
+	if hash.Config != config {
+		t.Errorf("Config = %s, want %s", hash.Config, config)
+	}
+	if len(hash.Layers) != 2 || hash.Layers[0] != layers[0] || hash.Layers[1] != layers[1] {
+		t.Errorf("Layers = %v, want %v", hash.Layers, layers)
+	}
+	if hash.String() != config {
+		t.Errorf("String() = %s, want %s", hash.String(), config)
+	}
+}
+
+func TestComputeIgnoresEntryOrder(t *testing.T) {
+	files, config, _ := buildArchive(t, []byte("a"), []byte("b"))
+
+	reversed := make([]archiveFile, len(files))
+	for i, f := range files {
+		reversed[len(files)-1-i] = f
+	}
+
+	hash, err := Compute(bytes.NewReader(writeTar(t, reversed)))
+	if err != nil {
+		t.Fatalf("Compute: %v", err)
+	}
+	if hash.Config != config {
+		t.Errorf("Config = %s, want %s", hash.Config, config)
+	}
+}
+
+func TestComputeGzipLayer(t *testing.T) {
+	layer := []byte("compressed layer contents")
+	files, config, _ := buildArchive(t, layer)
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	if _, err := zw.Write(layer); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files[0].data = gz.Bytes()
+
+	hash, err := Compute(bytes.NewReader(writeTar(t, files)))
+	if err != nil {
+		t.Fatalf("Compute: %v", err)
+	}
+	if hash.Config != config {
+		t.Errorf("Config = %s, want %s", hash.Config, config)
+	}
+}
+
+func TestComputeFollowsLinks(t *testing.T) {
+	files, config, _ := buildArchive(t, []byte("shared"))
+
+	// Point the manifest's layer at a symlink to the real file, as podman
+	// and OCI layout exports do.
+	files[0].name = "blobs/layer.tar"
+	files = append(files, archiveFile{name: "layer0/layer.tar", link: "../blobs/layer.tar"})
+
+	hash, err := Compute(bytes.NewReader(writeTar(t, files)))
+	if err != nil {
+		t.Fatalf("Compute: %v", err)
+	}
+	if hash.Config != config {
+		t.Errorf("Config = %s, want %s", hash.Config, config)
+	}
+}
+
+func TestComputeRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func([]archiveFile) []archiveFile
+		want   error
+	}{
+		{
+			name: "tampered layer",
+			modify: func(files []archiveFile) []archiveFile {
+				files[0].data = []byte("something else")
+				return files
+			},
+			want: ErrLayerMismatch,
+		},
+		{
+			name: "missing layer",
+			modify: func(files []archiveFile) []archiveFile {
+				return files[1:]
+			},
+			want: ErrInvalidArchive,
+		},
+		{
+			name: "no manifest",
+			modify: func(files []archiveFile) []archiveFile {
+				return files[:len(files)-1]
+			},
+			want: ErrInvalidArchive,
+		},
+		{
+			name: "config not matching its name",
+			modify: func(files []archiveFile) []archiveFile {
+				config := files[len(files)-2]
+				config.data = append(append([]byte{}, config.data[:len(config.data)-1]...), ' ', '}')
+				files[len(files)-2] = config
+				return files
+			},
+			want: ErrInvalidArchive,
+		},
+		{
+			name: "link loop",
+			modify: func(files []archiveFile) []archiveFile {
+				files[0] = archiveFile{name: "layer0/layer.tar", link: "layer.tar"}
+				return files
+			},
+			want: ErrInvalidArchive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, _, _ := buildArchive(t, []byte("layer"))
+			_, err := Compute(bytes.NewReader(writeTar(t, tt.modify(files))))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Compute error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	files, config, _ := buildArchive(t, []byte("layer"))
+	archive := writeTar(t, files)
+
+	if _, err := Verify(bytes.NewReader(archive), config); err != nil {
+		t.Errorf("Verify with the config digest: %v", err)
+	}
+
+	other := sha256Digest([]byte("other"))
+	if _, err := Verify(bytes.NewReader(archive), other); !errors.Is(err, ErrMismatch) {
+		t.Errorf("Verify with another digest: error = %v, want %v", err, ErrMismatch)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	hash := ImageHash{Config: sha256Digest([]byte("config"))}
+	bare := hash.Config[len(Algorithm)+1:]
+
+	tests := []struct {
+		digest string
+		want   bool
+	}{
+		{hash.Config, true},
+		{bare, true},
+		{"  SHA256:" + bare + " ", true},
+		{sha256Digest([]byte("other")), false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := hash.Matches(tt.digest); got != tt.want {
+			t.Errorf("Matches(%q) = %v, want %v", tt.digest, got, tt.want)
+		}
+	}
+}
+
+func TestHasher(t *testing.T) {
+	files, config, _ := buildArchive(t, []byte("streamed"))
+	archive := writeTar(t, files)
+
+	h := NewHasher()
+	if _, err := io.Copy(h, bytes.NewReader(archive)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	hash, err := h.Sum()
+	if err != nil {
+		t.Fatalf("Sum: %v", err)
+	}
+	if hash.Config != config {
+		t.Errorf("Config = %s, want %s", hash.Config, config)
+	}
+}
+
+func TestHasherInvalidArchive(t *testing.T) {
+	h := NewHasher()
+	// Writes must not block even though the archive is rejected early.
+	if _, err := h.Write(bytes.Repeat([]byte("x"), 64<<10)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := h.Sum(); !errors.Is(err, ErrInvalidArchive) {
+		t.Fatalf("Sum error = %v, want %v", err, ErrInvalidArchive)
+	}
+}
@@ -0,0 +1,222 @@
+package requestsig
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func newTestSigner(t *testing.T) *Signer {
+	t.Helper()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewSigner(key)
+}
+
+// verifyingServer verifies every request it receives and sends the result
+// on results.
+func verifyingServer(t *testing.T, v *Verifier, results chan<- error) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err == nil {
+			_, err = v.Verify(r, HashBytes(body))
+		}
+		results <- err
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRecover(t *testing.T) {
+	s := newTestSigner(t)
+	message := Message("POST", "/api/v1/tasks", EmptyBodyHash, 1700000000, "nonce")
+
+	sig, err := s.SignMessage(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, err := Recover(message, sig)
+	if err != nil {
+		t.Fatalf("Recover: %v", err)
+	}
+	if addr != s.Address() {
+		t.Errorf("Recover = %s, want %s", addr.Hex(), s.Address().Hex())
+	}
+
+	if _, err := Recover(message, "0x1234"); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Recover of a short signature: error = %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestMessageIsCanonical(t *testing.T) {
+	a := Message("post", "/x", strings.ToUpper(EmptyBodyHash), 1, "n")
+	b := Message("POST", "/x", EmptyBodyHash, 1, "n")
+	if !bytes.Equal(a, b) {
+		t.Errorf("Message depends on method or body hash case:\n%s\n%s", a, b)
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	tests := []struct {
+		name          string
+		body          io.Reader
+		contentLength int64
+		staleHeaders  bool
+	}{
+		{"no body", nil, 0, false},
+		{"small body", strings.NewReader(`{"title":"hello"}`), 17, false},
+		{"streamed body", io.MultiReader(strings.NewReader("streamed "), strings.NewReader("body")), -1, false},
+		{"large body", bytes.NewReader(bytes.Repeat([]byte("x"), MaxBufferedBody+1)), MaxBufferedBody + 1, false},
+		{"streamed body over stale signature headers", strings.NewReader("streamed body"), -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestSigner(t)
+			results := make(chan error, 1)
+			srv := verifyingServer(t, NewVerifier(0), results)
+
+			req, err := http.NewRequest(http.MethodPost, srv.URL+"/api/v1/tasks?x=1", tt.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.ContentLength = tt.contentLength
+			if tt.staleHeaders {
+				req.Header.Set(HeaderSignature, "0xstale")
+				req.Header.Set(HeaderBodyHash, EmptyBodyHash)
+			}
+
+			client := &http.Client{Transport: NewTransport(s, nil)}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if err := <-results; err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+		})
+	}
+}
+
+func signedRequest(t *testing.T, s *Signer, body string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tasks", strings.NewReader(body))
+	if err := s.Sign(req); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return req
+}
+
+func TestVerifyRejects(t *testing.T) {
+	s := newTestSigner(t)
+	other := newTestSigner(t)
+
+	tests := []struct {
+		name   string
+		modify func(req *http.Request) string
+		want   error
+	}{
+		{
+			name: "unsigned",
+			modify: func(req *http.Request) string {
+				req.Header.Del(HeaderSignature)
+				return HashBytes([]byte("body"))
+			},
+			want: ErrMissingSignature,
+		},
+		{
+			name: "changed body",
+			modify: func(req *http.Request) string {
+				return HashBytes([]byte("other body"))
+			},
+			want: ErrBodyMismatch,
+		},
+		{
+			name: "changed path",
+			modify: func(req *http.Request) string {
+				req.URL.Path = "/api/v1/other"
+				return HashBytes([]byte("body"))
+			},
+			want: ErrInvalidSignature,
+		},
+		{
+			name: "claimed address of another wallet",
+			modify: func(req *http.Request) string {
+				req.Header.Set(HeaderAddress, other.Address().Hex())
+				return HashBytes([]byte("body"))
+			},
+			want: ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := signedRequest(t, s, "body")
+			bodyHash := tt.modify(req)
+			if _, err := NewVerifier(0).Verify(req, bodyHash); !errors.Is(err, tt.want) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsStaleTimestamp(t *testing.T) {
+	s := newTestSigner(t)
+	s.now = func() time.Time { return time.Now().Add(-10 * time.Minute) }
+	req := signedRequest(t, s, "body")
+
+	if _, err := NewVerifier(5*time.Minute).Verify(req, HashBytes([]byte("body"))); !errors.Is(err, ErrStaleTimestamp) {
+		t.Fatalf("Verify error = %v, want %v", err, ErrStaleTimestamp)
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	s := newTestSigner(t)
+	v := NewVerifier(0)
+	req := signedRequest(t, s, "body")
+
+	addr, err := v.ReadAndVerify(req, 1<<10)
+	if err != nil {
+		t.Fatalf("first ReadAndVerify: %v", err)
+	}
+	if addr != s.Address() {
+		t.Errorf("ReadAndVerify = %s, want %s", addr.Hex(), s.Address().Hex())
+	}
+
+	// The body is restored for the handler.
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != "body" {
+		t.Errorf("body after ReadAndVerify = %q, want %q", body, "body")
+	}
+
+	if _, err := v.Verify(req, HashBytes(body)); !errors.Is(err, ErrReplayedNonce) {
+		t.Fatalf("replayed Verify error = %v, want %v", err, ErrReplayedNonce)
+	}
+}
+
+func TestReadAndVerifyLimitsBody(t *testing.T) {
+	req := signedRequest(t, newTestSigner(t), strings.Repeat("x", 100))
+	if _, err := NewVerifier(0).ReadAndVerify(req, 10); err == nil {
+		t.Fatal("ReadAndVerify accepted a body over the limit")
+	}
+}
+
+func TestVerifyRejectsInvalidAddress(t *testing.T) {
+	req := signedRequest(t, newTestSigner(t), "body")
+	req.Header.Set(HeaderAddress, "not-an-address")
+	if _, err := NewVerifier(0).Verify(req, HashBytes([]byte("body"))); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Verify error = %v, want %v", err, ErrInvalidSignature)
+	}
+}
@@ -0,0 +1,188 @@
+package requestsig
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// MaxBufferedBody is the largest request body that is hashed up front and
+// signed in headers. Larger or unknown-length bodies are signed in trailers.
+const MaxBufferedBody = 1 << 20
+
+// Signer signs outbound requests with a wallet key.
+type Signer struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+	now     func() time.Time
+}
+
+// NewSigner returns a Signer for key.
+func NewSigner(key *ecdsa.PrivateKey) *Signer {
+	return &Signer{
+		key:     key,
+		address: crypto.PubkeyToAddress(key.PublicKey),
+		now:     time.Now,
+	}
+}
+
+// Address returns the address requests are signed as.
+func (s *Signer) Address() common.Address {
+	return s.address
+}
+
+// SignMessage returns the hex-encoded EIP-191 signature of message with V
+// in personal_sign form (27/28).
+func (s *Signer) SignMessage(message []byte) (string, error) {
+	sig, err := crypto.Sign(accounts.TextHash(message), s.key)
+	if err != nil {
+		return "", err
+	}
+	sig[crypto.RecoveryIDOffset] += 27
+	return hexutil.Encode(sig), nil
+}
+
+// Sign adds signature headers to req, consuming and replacing req.Body.
+// Small bodies are signed in headers; large or unknown-length bodies are
+// hashed as they are sent and signed in trailers.
+func (s *Signer) Sign(req *http.Request) error {
+	timestamp := s.now().Unix()
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(HeaderAddress, s.address.Hex())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderNonce, nonce)
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return s.signHeaders(req, EmptyBodyHash, timestamp, nonce)
+	}
+
+	if req.ContentLength >= 0 && req.ContentLength <= MaxBufferedBody {
+		body, err := io.ReadAll(req.Body)
+		if closeErr := req.Body.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read request body for signing: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.ContentLength = int64(len(body))
+		return s.signHeaders(req, HashBytes(body), timestamp, nonce)
+	}
+
+	// Trailers require a chunked body. Headers left over from an earlier
+	// signature would otherwise be sent next to the trailers.
+	req.Header.Del(HeaderBodyHash)
+	req.Header.Del(HeaderSignature)
+	req.ContentLength = -1
+	req.GetBody = nil
+	req.Trailer = http.Header{
+		HeaderBodyHash:  nil,
+		HeaderSignature: nil,
+	}
+	req.Body = &signingBody{
+		body:      req.Body,
+		hasher:    sha256.New(),
+		signer:    s,
+		req:       req,
+		timestamp: timestamp,
+		nonce:     nonce,
+	}
+	return nil
+}
+
+func (s *Signer) signHeaders(req *http.Request, bodyHash string, timestamp int64, nonce string) error {
+	sig, err := s.SignMessage(Message(req.Method, req.URL.RequestURI(), bodyHash, timestamp, nonce))
+	if err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+	req.Header.Set(HeaderBodyHash, bodyHash)
+	req.Header.Set(HeaderSignature, sig)
+	return nil
+}
+
+// signingBody hashes a streamed body and fills in the signature trailers
+// once it reaches EOF.
+type signingBody struct {
+	body      io.ReadCloser
+	hasher    hash.Hash
+	signer    *Signer
+	req       *http.Request
+	timestamp int64
+	nonce     string
+	signed    bool
+}
+
+func (b *signingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.hasher.Write(p[:n])
+	if err == io.EOF && !b.signed {
+		b.signed = true
+		bodyHash := hex.EncodeToString(b.hasher.Sum(nil))
+		sig, signErr := b.signer.SignMessage(Message(b.req.Method, b.req.URL.RequestURI(), bodyHash, b.timestamp, b.nonce))
+		if signErr != nil {
+			return n, fmt.Errorf("failed to sign request: %w", signErr)
+		}
+		b.req.Trailer.Set(HeaderBodyHash, bodyHash)
+		b.req.Trailer.Set(HeaderSignature, sig)
+	}
+	return n, err
+}
+
+func (b *signingBody) Close() error {
+	return b.body.Close()
+}
+
+func newNonce() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// Transport is an http.RoundTripper that signs every request before passing
+// it to Base.
+type Transport struct {
+	Signer *Signer
+	Base   http.RoundTripper
+}
+
+// NewTransport returns a signing Transport wrapping base, or
+// http.DefaultTransport if base is nil.
+func NewTransport(signer *Signer, base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Signer: signer, Base: base}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	signed := req.Clone(req.Context())
+	if err := t.Signer.Sign(signed); err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.Base.RoundTrip(signed)
+}
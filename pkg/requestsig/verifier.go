@@ -0,0 +1,125 @@
+package requestsig
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultMaxSkew is how far a request timestamp may drift from the
+// verifier's clock.
+const DefaultMaxSkew = 5 * time.Minute
+
+// Verifier checks signed requests and rejects replayed nonces.
+type Verifier struct {
+	maxSkew time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	nonces map[string]time.Time
+}
+
+// NewVerifier returns a Verifier accepting timestamps within maxSkew of
+// the local clock. A zero maxSkew uses DefaultMaxSkew.
+func NewVerifier(maxSkew time.Duration) *Verifier {
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxSkew
+	}
+	return &Verifier{
+		maxSkew: maxSkew,
+		now:     time.Now,
+		nonces:  make(map[string]time.Time),
+	}
+}
+
+// Verify checks r's signature given bodyHash, the hex SHA-256 of the body as
+// received, and returns the signing address. When the signature was sent in
+// trailers, r.Body must already have been read to EOF.
+func (v *Verifier) Verify(r *http.Request, bodyHash string) (common.Address, error) {
+	sig := field(r, HeaderSignature)
+	if sig == "" {
+		return common.Address{}, ErrMissingSignature
+	}
+
+	claimed := r.Header.Get(HeaderAddress)
+	nonce := r.Header.Get(HeaderNonce)
+	timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil || nonce == "" || !common.IsHexAddress(claimed) {
+		return common.Address{}, ErrInvalidSignature
+	}
+
+	if signedHash := field(r, HeaderBodyHash); !strings.EqualFold(signedHash, bodyHash) {
+		return common.Address{}, ErrBodyMismatch
+	}
+
+	now := v.now()
+	if d := now.Sub(time.Unix(timestamp, 0)); d > v.maxSkew || d < -v.maxSkew {
+		return common.Address{}, ErrStaleTimestamp
+	}
+
+	addr, err := Recover(Message(r.Method, r.URL.RequestURI(), bodyHash, timestamp, nonce), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if addr != common.HexToAddress(claimed) {
+		return common.Address{}, fmt.Errorf("%w: signed by %s, claimed %s", ErrInvalidSignature, addr.Hex(), claimed)
+	}
+
+	if !v.useNonce(addr.Hex()+":"+nonce, now) {
+		return common.Address{}, ErrReplayedNonce
+	}
+
+	return addr, nil
+}
+
+// ReadAndVerify reads up to maxBody bytes of r.Body, verifies the
+// signature and restores r.Body so handlers can read it again.
+func (v *Verifier) ReadAndVerify(r *http.Request, maxBody int64) (common.Address, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxBody+1))
+		if err != nil {
+			return common.Address{}, fmt.Errorf("failed to read request body: %w", err)
+		}
+		if int64(len(body)) > maxBody {
+			return common.Address{}, fmt.Errorf("request body exceeds %d bytes", maxBody)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	return v.Verify(r, HashBytes(body))
+}
+
+func (v *Verifier) useNonce(key string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for k, seen := range v.nonces {
+		if now.Sub(seen) > 2*v.maxSkew {
+			delete(v.nonces, k)
+		}
+	}
+
+	if _, ok := v.nonces[key]; ok {
+		return false
+	}
+	v.nonces[key] = now
+	return true
+}
+
+// field reads a signature field from the headers, falling back to
+// trailers for streamed requests.
+func field(r *http.Request, name string) string {
+	if value := r.Header.Get(name); value != "" {
+		return value
+	}
+	return r.Trailer.Get(name)
+}
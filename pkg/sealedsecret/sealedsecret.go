@@ -0,0 +1,86 @@
+// Package sealedsecret encrypts task secrets to a runner's secp256k1 public
+// key, the same kind of key as the runner's wallet, so that only that
+// runner can read them.
+//
+// A sealed secret is the standard base64 encoding of go-ethereum's ECIES
+// ciphertext (ephemeral public key, AES-128-CTR ciphertext and
+// HMAC-SHA-256 tag) with
+//
+//	s1 = "PARITY-SECRET-V1"
+//	s2 = <SECRET NAME>
+//
+// as the key derivation and MAC shared information, so a sealed value only
+// opens under the name it was sealed for.
+package sealedsecret
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/ecies"
+)
+
+const sharedInfo = "PARITY-SECRET-V1"
+
+var (
+	ErrInvalidKey    = errors.New("invalid secp256k1 public key")
+	ErrInvalidSealed = errors.New("invalid sealed secret")
+)
+
+// Seal encrypts value for the holder of pub under name.
+func Seal(pub *ecdsa.PublicKey, name string, value []byte) (string, error) {
+	ciphertext, err := ecies.Encrypt(rand.Reader, ecies.ImportECDSAPublic(pub), value, []byte(sharedInfo), []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("failed to seal secret %s: %w", name, err)
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Open decrypts a value sealed under name with the private key matching
+// the public key it was sealed to.
+func Open(key *ecdsa.PrivateKey, name, sealed string) ([]byte, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSealed, err)
+	}
+
+	value, err := ecies.ImportECDSA(key).Decrypt(ciphertext, []byte(sharedInfo), []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSealed, err)
+	}
+	return value, nil
+}
+
+// ParsePublicKey reads a hex-encoded public key, compressed (33 bytes) or
+// uncompressed (65 bytes), with or without a 0x prefix.
+func ParsePublicKey(s string) (*ecdsa.PublicKey, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(s), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	var pub *ecdsa.PublicKey
+	switch len(raw) {
+	case 33:
+		pub, err = crypto.DecompressPubkey(raw)
+	case 65:
+		pub, err = crypto.UnmarshalPubkey(raw)
+	default:
+		return nil, fmt.Errorf("%w: expected 33 or 65 bytes, got %d", ErrInvalidKey, len(raw))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return pub, nil
+}
+
+// FormatPublicKey returns pub as 0x-prefixed hex of its uncompressed form.
+func FormatPublicKey(pub *ecdsa.PublicKey) string {
+	return "0x" + hex.EncodeToString(crypto.FromECDSAPub(pub))
+}
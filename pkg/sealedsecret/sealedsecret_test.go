@@ -0,0 +1,118 @@
+package sealedsecret
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestSealOpen(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := Seal(&key.PublicKey, "API_TOKEN", []byte("s3cret"))
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if bytes.Contains([]byte(sealed), []byte("s3cret")) {
+		t.Fatal("sealed value contains the plaintext")
+	}
+
+	value, err := Open(key, "API_TOKEN", sealed)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if string(value) != "s3cret" {
+		t.Errorf("Open = %q, want %q", value, "s3cret")
+	}
+}
+
+func TestSealIsRandomized(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Seal(&key.PublicKey, "NAME", []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Seal(&key.PublicKey, "NAME", []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Error("sealing the same value twice gave the same ciphertext")
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := Seal(&key.PublicKey, "NAME", []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(sealed)
+	raw[len(raw)-1] ^= 1
+	tampered := base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name   string
+		key    *ecdsa.PrivateKey
+		secret string
+		sealed string
+	}{
+		{"another key", other, "NAME", sealed},
+		{"another name", key, "OTHER", sealed},
+		{"tampered", key, "NAME", tampered},
+		{"not base64", key, "NAME", "%%%"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Open(tt.key, tt.secret, tt.sealed); !errors.Is(err, ErrInvalidSealed) {
+				t.Fatalf("Open error = %v, want %v", err, ErrInvalidSealed)
+			}
+		})
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncompressed := FormatPublicKey(&key.PublicKey)
+	compressed := "0x" + hex.EncodeToString(crypto.CompressPubkey(&key.PublicKey))
+
+	for _, s := range []string{uncompressed, uncompressed[2:], compressed, " " + compressed + " "} {
+		pub, err := ParsePublicKey(s)
+		if err != nil {
+			t.Errorf("ParsePublicKey(%q): %v", s, err)
+			continue
+		}
+		if !pub.Equal(&key.PublicKey) {
+			t.Errorf("ParsePublicKey(%q) returned another key", s)
+		}
+	}
+
+	for _, s := range []string{"", "0x1234", "zz" + uncompressed[4:], "0x05" + uncompressed[4:]} {
+		if _, err := ParsePublicKey(s); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ParsePublicKey(%q) error = %v, want %v", s, err, ErrInvalidKey)
+		}
+	}
+}